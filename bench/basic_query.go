@@ -14,13 +14,19 @@ var _ Benchmark = (*BasicQueryBenchmark)(nil)
 
 // BasicQueryBenchmark runs a query multiple times with increasing row ids.
 type BasicQueryBenchmark struct {
-	Name       string `json:"name"`
-	MinRowID   int64  `json:"min-row-id"`
-	Iterations int    `json:"iterations"`
-	NumArgs    int    `json:"num-args"`
-	Query      string `json:"query"`
-	Index      string `json:"index"`
-	Field      string `json:"field"`
+	Name       string        `json:"name"`
+	MinRowID   int64         `json:"min-row-id"`
+	Iterations int           `json:"iterations"`
+	Duration   time.Duration `json:"duration"`
+	Warmup     time.Duration `json:"warmup"`
+	Rate       float64       `json:"rate"`
+	Arrivals   string        `json:"arrivals"`
+	Workers    int           `json:"workers"`
+	MaxLag     time.Duration `json:"max-lag"`
+	NumArgs    int           `json:"num-args"`
+	Query      string        `json:"query"`
+	Index      string        `json:"index"`
+	Field      string        `json:"field"`
 
 	Logger *log.Logger `json:"-"`
 }
@@ -46,35 +52,44 @@ func (b *BasicQueryBenchmark) Run(ctx context.Context, client *pilosa.Client, ag
 	}
 
 	// Determine minimum row id.
-	minRowID := b.MinRowID + int64(agentNum*b.Iterations)
+	minRowID := b.MinRowID + int64(agentOffset(agentNum, b.Iterations, b.Duration, b.Warmup))
 
-	var start time.Time
-	for n := 0; n < b.Iterations; n++ {
+	var query func(...*pilosa.PQLRowQuery) *pilosa.PQLRowQuery
+	switch b.Query {
+	case "Intersect":
+		query = index.Intersect
+	case "Union":
+		query = index.Union
+	case "Difference":
+		query = index.Difference
+	case "Xor":
+		query = index.Xor
+	default:
+		return result, fmt.Errorf("invalid query type: %q", b.Query)
+	}
+	nth := func(n int) *pilosa.PQLRowQuery {
 		rows := make([]*pilosa.PQLRowQuery, b.NumArgs)
 		for i := range rows {
 			rows[i] = field.Row(minRowID + int64(n))
 		}
+		return query(rows...)
+	}
 
-		var q *pilosa.PQLRowQuery
-		switch b.Query {
-		case "Intersect":
-			q = index.Intersect(rows...)
-		case "Union":
-			q = index.Union(rows...)
-		case "Difference":
-			q = index.Difference(rows...)
-		case "Xor":
-			q = index.Xor(rows...)
-		default:
-			return result, fmt.Errorf("invalid query type: %q", b.Query)
-		}
-
-		start = time.Now()
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	if b.Rate > 0 {
+		open := &OpenLoop{Rate: b.Rate, Arrivals: b.Arrivals, Workers: b.Workers, MaxLag: b.MaxLag}
+		return result, open.Run(ctx, loop, result, func(n int) Op {
+			return queryOp(client, nth(n))
+		})
+	}
+	for loop.Next() {
+		q := nth(loop.N() - 1)
+		start := time.Now()
 		_, err := client.Query(q)
-		result.Add(time.Since(start), nil)
+		loop.Add(result, time.Since(start), nil)
 		if err != nil {
 			return result, err
 		}
 	}
-	return result, nil
+	return result, loop.Finish(result)
 }
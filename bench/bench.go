@@ -2,11 +2,15 @@ package bench
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
 )
 
 // Benchmark is an interface run benchmark components. Benchmarks should Marshal
@@ -92,6 +96,66 @@ func ensureSchema(client *pilosa.Client, indexName, fieldName string, opts ...in
 	return index, field, nil
 }
 
+// schemaFields finds an existing index, and fields in it, to query. If
+// indexName is blank, one is chosen at random, and if fieldNames is
+// empty, all of the index's fields are used, in order of name, or, if use
+// isn't nil, the ones it returns true for. Named fields which use returns
+// false for are an error.
+func schemaFields(client *pilosa.Client, indexName string, fieldNames []string, use func(*pilosa.Field) bool) (*pilosa.Index, []*pilosa.Field, error) {
+	s, err := client.Schema()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "getting schema")
+	}
+
+	// deal with indexes
+	indexes := s.Indexes()
+	var index *pilosa.Index
+	if indexName == "" {
+		if len(indexes) == 0 {
+			return nil, nil, errors.New("no indexes in Pilosa, aborting.")
+		}
+		for _, idx := range indexes {
+			index = idx
+			break
+		}
+	} else {
+		var ok bool
+		index, ok = indexes[indexName]
+		if !ok {
+			return nil, nil, errors.Errorf("index '%s' not found in schema.", indexName)
+		}
+	}
+
+	// we have an index, deal with fields
+	var fields []*pilosa.Field
+	fieldsMap := index.Fields()
+	if len(fieldNames) == 0 {
+		fields = make([]*pilosa.Field, 0, len(fieldsMap))
+		for _, fld := range fieldsMap {
+			if use == nil || use(fld) {
+				fields = append(fields, fld)
+			}
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Name() < fields[j].Name() })
+	} else {
+		fields = make([]*pilosa.Field, 0, len(fieldNames))
+		for _, name := range fieldNames {
+			fld, ok := fieldsMap[name]
+			if !ok {
+				return nil, nil, errors.Errorf("field '%s' not found in index '%s'.", name, index.Name())
+			}
+			if use != nil && !use(fld) {
+				return nil, nil, errors.Errorf("can't use %s field '%s' in index '%s'", fld.Options().Type(), name, index.Name())
+			}
+			fields = append(fields, fld)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil, errors.Errorf("no fields to query in index '%s'", index.Name())
+	}
+	return index, fields, nil
+}
+
 // wrapper type to force human-readable JSON output
 type PrettyDuration time.Duration
 
@@ -253,9 +317,14 @@ func (g *QueryGenerator) RandomBitmapCall(depth, maxargs int, idmin, idmax uint6
 	}
 }
 
-// Stats object helps track timing stats.
+// Stats object helps track timing stats. Besides the min, max, mean, and
+// total, it keeps a histogram of the times, from which it reports
+// percentiles, and tracks their variance. Stats from several goroutines or
+// agents can be merged with Combine, including after a round trip through
+// JSON.
 type Stats struct {
 	sumSquareDelta float64
+	histogram      Histogram
 
 	Min     time.Duration   `json:"min"`
 	Max     time.Duration   `json:"max"`
@@ -279,6 +348,7 @@ func (s *Stats) Add(td time.Duration) {
 	if s.SaveAll {
 		s.All = append(s.All, td)
 	}
+	s.histogram.Add(td)
 	s.Num += 1
 	s.Total += td
 	if td < s.Min {
@@ -290,24 +360,103 @@ func (s *Stats) Add(td time.Duration) {
 
 	// online variance calculation
 	// https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance#Online_algorithm
-	delta := td - s.Mean
-	s.Mean += delta / time.Duration(s.Num)
-	s.sumSquareDelta += float64(delta * (td - s.Mean))
+	delta := float64(td - s.Mean)
+	s.Mean += time.Duration(delta / float64(s.Num))
+	s.sumSquareDelta += delta * float64(td-s.Mean)
 }
 
+// Combine adds the times tracked by other to s.
 func (s *Stats) Combine(other *Stats) {
+	if other.Num == 0 {
+		return
+	}
 	if other.Min < s.Min {
 		s.Min = other.Min
 	}
 	if other.Max > s.Max {
 		s.Max = other.Max
 	}
+	// parallel variance calculation, from the same article.
+	delta := float64(other.Mean - s.Mean)
+	n := float64(s.Num + other.Num)
+	s.sumSquareDelta += other.sumSquareDelta + delta*delta*float64(s.Num)*float64(other.Num)/n
+	s.histogram.Merge(&other.histogram)
 	s.Total += other.Total
 	s.Num += other.Num
 	s.Mean = s.Total / time.Duration(s.Num)
 	s.All = append(s.All, other.All...)
 }
 
+// StdDev returns the standard deviation of the times.
+func (s *Stats) StdDev() time.Duration {
+	if s.Num < 2 {
+		return 0
+	}
+	return time.Duration(math.Sqrt(s.sumSquareDelta / float64(s.Num-1)))
+}
+
+// Percentile returns the time which p percent of the times are at or
+// below. It's taken from a histogram, so it's only accurate to within
+// about 1%, but it's never outside the min and max.
+func (s *Stats) Percentile(p float64) time.Duration {
+	if s.Num == 0 {
+		return 0
+	}
+	d := s.histogram.Quantile(p / 100)
+	if d > s.Max {
+		d = s.Max
+	}
+	if d < s.Min {
+		d = s.Min
+	}
+	return d
+}
+
+// statsFields has the same fields as Stats, but not its methods, so it
+// can be encoded as part of the JSON for Stats.
+type statsFields Stats
+
+// statsJSON is the JSON form of Stats, which adds the standard
+// deviation, percentiles, and histogram. The percentiles are derived from
+// the histogram, so they're ignored when decoding.
+type statsJSON struct {
+	*statsFields
+	StdDev    time.Duration `json:"stddev"`
+	P50       time.Duration `json:"p50"`
+	P90       time.Duration `json:"p90"`
+	P99       time.Duration `json:"p99"`
+	P999      time.Duration `json:"p99.9"`
+	Histogram *Histogram    `json:"histogram"`
+}
+
+// MarshalJSON encodes the stats, with their standard deviation,
+// percentiles, and histogram.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(statsJSON{
+		statsFields: (*statsFields)(&s),
+		StdDev:      s.StdDev(),
+		P50:         s.Percentile(50),
+		P90:         s.Percentile(90),
+		P99:         s.Percentile(99),
+		P999:        s.Percentile(99.9),
+		Histogram:   &s.histogram,
+	})
+}
+
+// UnmarshalJSON decodes stats encoded by MarshalJSON, so they can be
+// combined with others.
+func (s *Stats) UnmarshalJSON(data []byte) error {
+	sj := statsJSON{statsFields: (*statsFields)(s), Histogram: &s.histogram}
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return err
+	}
+	if s.Num > 1 {
+		stdDev := float64(sj.StdDev)
+		s.sumSquareDelta = stdDev * stdDev * float64(s.Num-1)
+	}
+	return nil
+}
+
 // NumStats object helps track stats. This and Stats (which was
 // originally made specifically for time) should probably be unified.
 type NumStats struct {
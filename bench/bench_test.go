@@ -2,12 +2,18 @@ package bench_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/pilosa/go-pilosa"
 	"github.com/pilosa/tools/bench"
 )
 
@@ -91,3 +97,233 @@ func TestPrettifyDurationSlice(t *testing.T) {
 		t.Fatalf("Pretty duration slice doesn't match")
 	}
 }
+
+func TestStatsPercentiles(t *testing.T) {
+	// two halves of 1..1000µs, interleaved, as if from two goroutines.
+	a, b := bench.NewStats(), bench.NewStats()
+	for i := 1; i <= 1000; i++ {
+		s := a
+		if i%2 == 0 {
+			s = b
+		}
+		s.Add(time.Duration(i) * time.Microsecond)
+	}
+	a.Combine(b)
+	near := func(name string, got, want time.Duration) {
+		t.Helper()
+		if math.Abs(float64(got-want)) > float64(want)/100 {
+			t.Errorf("%s: expected about %v, got %v", name, want, got)
+		}
+	}
+	check := func(s *bench.Stats, num int64) {
+		t.Helper()
+		if s.Num != num || s.Min != time.Microsecond || s.Max != time.Millisecond {
+			t.Fatalf("expected %d times from 1µs to 1ms, got %d from %v to %v", num, s.Num, s.Min, s.Max)
+		}
+		near("p50", s.Percentile(50), 500*time.Microsecond)
+		near("p90", s.Percentile(90), 900*time.Microsecond)
+		near("p99", s.Percentile(99), 990*time.Microsecond)
+		near("p99.9", s.Percentile(99.9), 999*time.Microsecond)
+		near("stddev", s.StdDev(), 288819*time.Nanosecond)
+	}
+	check(a, 1000)
+
+	// stats survive a round trip through JSON, and can still be combined.
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatalf("marshaling stats: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"p99.9":`)) || !bytes.Contains(data, []byte(`"histogram":[[`)) {
+		t.Fatalf("expected percentiles and histogram in %s", data)
+	}
+	c := bench.NewStats()
+	if err := json.Unmarshal(data, c); err != nil {
+		t.Fatalf("unmarshaling stats: %v", err)
+	}
+	c.Combine(a)
+	check(c, 2000)
+}
+
+// fakeTransport runs agents by returning a result with a single time,
+// taken from the agent's number, or failing agents of the benchmark named
+// fail.
+type fakeTransport struct {
+	mu   sync.Mutex
+	runs [][]string
+}
+
+func (f *fakeTransport) RunAgent(ctx context.Context, agent int, args []string) ([]byte, error) {
+	f.mu.Lock()
+	f.runs = append(f.runs, args)
+	f.mu.Unlock()
+	if args[1] == "fail" {
+		return nil, fmt.Errorf("agent %d failed", agent)
+	}
+	var agentNum int
+	if _, err := fmt.Sscanf(args[2], "--agent-num=%d", &agentNum); err != nil {
+		return nil, err
+	}
+	result := bench.NewResult()
+	result.AgentNum = agentNum
+	result.Stats.Add(time.Duration(agentNum+1) * time.Millisecond)
+	return json.Marshal(result)
+}
+
+func TestRunPlan(t *testing.T) {
+	plan, err := bench.DecodePlan(strings.NewReader(`
+hosts = ["a:10101", "b:10101"]
+[[stages]]
+name = "load"
+agents = 3
+[[stages.benchmarks]]
+name = "import"
+config = { iterations = 100, fields = ["x", "y"] }
+[[stages.benchmarks]]
+name = "zipf"
+agents = 1
+args = ["--seed=2"]
+[[stages]]
+name = "broken"
+[[stages.benchmarks]]
+name = "fail"
+[[stages]]
+name = "never"
+[[stages.benchmarks]]
+name = "import"
+`))
+	if err != nil {
+		t.Fatalf("decoding plan: %v", err)
+	}
+	transport := &fakeTransport{}
+	report, err := bench.RunPlan(context.Background(), plan, transport)
+	if err == nil || !strings.Contains(err.Error(), "stage broken: 1 agents failed") {
+		t.Fatalf("expected the broken stage to fail, got %v", err)
+	}
+	if len(report.Stages) != 2 || len(transport.runs) != 5 {
+		t.Fatalf("expected to stop after the broken stage, got %d stages, %d agents", len(report.Stages), len(transport.runs))
+	}
+	imp := report.Stages[0].Benchmarks[0]
+	if imp.Errors != 0 || len(imp.Agents) != 3 || imp.Stats.Num != 3 || imp.Stats.Max != 3*time.Millisecond {
+		t.Fatalf("expected stats combined from 3 agents, got %d from %d agents, max %v", imp.Stats.Num, len(imp.Agents), imp.Stats.Max)
+	}
+	args := strings.Join(imp.Agents[2].Args, " ")
+	if args != "bench import --agent-num=2 --human=false --hosts=a:10101,b:10101 --fields=x,y --iterations=100" {
+		t.Fatalf("unexpected agent args: %s", args)
+	}
+	if args := report.Stages[0].Benchmarks[1].Agents[0].Args; args[len(args)-1] != "--seed=2" {
+		t.Fatalf("expected extra args at the end, got %v", args)
+	}
+	if failed := report.Stages[1].Benchmarks[0]; failed.Errors != 1 || failed.Agents[0].Error == "" {
+		t.Fatalf("expected a failed agent, got %+v", failed.Agents[0])
+	}
+	if _, err := json.Marshal(report); err != nil {
+		t.Fatalf("marshaling report: %v", err)
+	}
+
+	if _, err := bench.DecodePlan(strings.NewReader("[[stages]]\nname = \"x\"\nagnets = 2\n")); err == nil || !strings.Contains(err.Error(), "agnets") {
+		t.Fatalf("expected an error for an unknown key, got %v", err)
+	}
+}
+
+func TestLoop(t *testing.T) {
+	// iterations: warmup operations aren't counted or measured.
+	result := bench.NewResult()
+	loop := bench.NewLoop(context.Background(), 5, 0, 20*time.Millisecond)
+	for loop.Next() {
+		if !loop.Measuring() {
+			time.Sleep(5 * time.Millisecond)
+		}
+		loop.Add(result, time.Millisecond, nil)
+	}
+	if err := loop.Finish(result); err != nil {
+		t.Fatalf("finishing loop: %v", err)
+	}
+	if result.Stats.Num != 5 || result.Extra["measured-iterations"] != 5 {
+		t.Fatalf("expected 5 measured iterations, got %d, %v", result.Stats.Num, result.Extra["measured-iterations"])
+	}
+	if warm := result.Extra["warmup-iterations"].(int); warm < 1 || loop.N() != 5+warm {
+		t.Fatalf("expected warmup iterations, got %d of %d", warm, loop.N())
+	}
+
+	// duration: runs for about that long, however many iterations.
+	result = bench.NewResult()
+	loop = bench.NewLoop(context.Background(), 1, 30*time.Millisecond, 0)
+	for loop.Next() {
+		time.Sleep(time.Millisecond)
+		loop.Add(result, time.Millisecond, nil)
+	}
+	if err := loop.Finish(result); err != nil {
+		t.Fatalf("finishing loop: %v", err)
+	}
+	if result.Stats.Num < 2 || loop.Elapsed() < 30*time.Millisecond {
+		t.Fatalf("expected to run for 30ms, ran %d iterations in %v", result.Stats.Num, loop.Elapsed())
+	}
+
+	// cancellation stops the loop, and is reported.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result = bench.NewResult()
+	loop = bench.NewLoop(ctx, 100, 0, 0)
+	for loop.Next() {
+		if loop.N() == 3 {
+			cancel()
+		}
+		loop.Add(result, time.Millisecond, nil)
+	}
+	if err := loop.Finish(result); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if result.Stats.Num != 3 {
+		t.Fatalf("expected 3 iterations before canceling, got %d", result.Stats.Num)
+	}
+}
+
+func TestOpenLoop(t *testing.T) {
+	// one worker, and an op which stalls once, for longer than the queued
+	// requests are allowed to wait: they're dropped, and the stall is
+	// measured, rather than hidden by the requests not being sent.
+	var calls int
+	op := func() (*pilosa.QueryResponse, error) {
+		calls++
+		if calls == 5 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil, nil
+	}
+	result := bench.NewResult()
+	loop := bench.NewLoop(context.Background(), 40, 0, 0)
+	open := &bench.OpenLoop{Rate: 200, Workers: 1, MaxLag: 50 * time.Millisecond}
+	err := open.Run(context.Background(), loop, result, func(n int) bench.Op { return op })
+	if err != nil {
+		t.Fatalf("running: %v", err)
+	}
+	dropped, late := result.Extra["dropped"].(int64), result.Extra["late"].(int64)
+	if dropped == 0 || late == 0 {
+		t.Fatalf("expected dropped and late requests, got %d and %d", dropped, late)
+	}
+	if result.Stats.Num+dropped != 40 {
+		t.Fatalf("expected 40 requests measured or dropped, got %d and %d", result.Stats.Num, dropped)
+	}
+	if result.Stats.Max < 100*time.Millisecond {
+		t.Fatalf("expected the stall in the latencies, max is %v", result.Stats.Max)
+	}
+
+	// the first failure stops the run.
+	result = bench.NewResult()
+	loop = bench.NewLoop(context.Background(), 1000, 0, 0)
+	open = &bench.OpenLoop{Rate: 1000, Arrivals: "poisson", Workers: 4}
+	err = open.Run(context.Background(), loop, result, func(n int) bench.Op {
+		return func() (*pilosa.QueryResponse, error) {
+			if n == 10 {
+				return nil, errors.New("failed")
+			}
+			return nil, nil
+		}
+	})
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("expected failure, got %v", err)
+	}
+	if result.Stats.Num >= 1000 {
+		t.Fatalf("expected the run to stop early, got %d requests", result.Stats.Num)
+	}
+}
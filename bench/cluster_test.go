@@ -0,0 +1,95 @@
+package bench_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pilosa/go-pilosa"
+	"github.com/pilosa/pilosa/test"
+	"github.com/pilosa/tools/bench"
+)
+
+func mustClient(t *testing.T, cluster test.Cluster) *pilosa.Client {
+	t.Helper()
+	client, err := pilosa.NewClient(cluster[0].URL())
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	return client
+}
+
+func TestTPSCanceled(t *testing.T) {
+	cluster := test.MustRunCluster(t, 1)
+	defer cluster.Close()
+	client := mustClient(t, cluster)
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	field := schema.Index("i").Field("f")
+	if err := client.SyncSchema(schema); err != nil {
+		t.Fatalf("creating field: %v", err)
+	}
+	if _, err := client.Query(field.Set(1, 1)); err != nil {
+		t.Fatalf("setting bit: %v", err)
+	}
+
+	b := bench.NewTPSBenchmark()
+	b.Concurrency = 2
+	b.Duration = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	result, err := b.Run(ctx, client, 0)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline's error, got %v", err)
+	}
+	n := result.Extra["measured-iterations"].(int64)
+	if n == 0 {
+		t.Fatalf("expected the queries before the deadline in the result")
+	}
+	if result.Stats.Num != n || result.Stats.Max == 0 {
+		t.Fatalf("expected the times of %d queries in the result, got %d, max %v", n, result.Stats.Num, result.Stats.Max)
+	}
+	if tps, ok := result.Extra["tps"].(float64); !ok || tps <= 0 {
+		t.Fatalf("expected tps in the result, got %v", result.Extra["tps"])
+	}
+}
+
+func TestDiagonalAgentOffsets(t *testing.T) {
+	cluster := test.MustRunCluster(t, 1)
+	defer cluster.Close()
+	client := mustClient(t, cluster)
+
+	// running for a duration, agents don't know how many bits they'll set, so
+	// they can't start where the one before ends, as they do when run for
+	// a number of iterations.
+	counts := make([]int, 2)
+	for agent := range counts {
+		b := bench.NewDiagonalSetBitsBenchmark()
+		b.Index, b.Field = "i", "f"
+		b.Iterations = 1
+		b.Duration = 50 * time.Millisecond
+		result, err := b.Run(context.Background(), client, agent)
+		if err != nil {
+			t.Fatalf("agent %d: %v", agent, err)
+		}
+		counts[agent] = result.Extra["measured-iterations"].(int)
+		if counts[agent] < 2 {
+			t.Fatalf("agent %d: expected more than one iteration, got %d", agent, counts[agent])
+		}
+	}
+	// each bit is in its own row, so if the agents' bits overlap, there
+	// are fewer rows than bits set.
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	resp, err := client.Query(schema.Index("i").Field("f").Rows())
+	if err != nil {
+		t.Fatalf("querying rows: %v", err)
+	}
+	if rows := len(resp.Result().RowIdentifiers().IDs); rows != counts[0]+counts[1] {
+		t.Fatalf("expected %d rows from %v bits, got %d", counts[0]+counts[1], counts, rows)
+	}
+}
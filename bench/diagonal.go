@@ -11,12 +11,14 @@ import (
 
 // DiagonalSetBitsBenchmark sets bits with increasing column id and row id.
 type DiagonalSetBitsBenchmark struct {
-	Name        string `json:"name"`
-	MinRowID    int    `json:"min-row-id"`
-	MinColumnID int    `json:"min-column-id"`
-	Iterations  int    `json:"iterations"`
-	Index       string `json:"index"`
-	Field       string `json:"field"`
+	Name        string        `json:"name"`
+	MinRowID    int           `json:"min-row-id"`
+	MinColumnID int           `json:"min-column-id"`
+	Iterations  int           `json:"iterations"`
+	Duration    time.Duration `json:"duration"`
+	Warmup      time.Duration `json:"warmup"`
+	Index       string        `json:"index"`
+	Field       string        `json:"field"`
 
 	Logger *log.Logger `json:"-"`
 }
@@ -41,16 +43,19 @@ func (b *DiagonalSetBitsBenchmark) Run(ctx context.Context, client *pilosa.Clien
 		return result, err
 	}
 
-	minRowID := b.MinRowID + (agentNum * b.Iterations)
-	minColumnID := b.MinColumnID + (agentNum * b.Iterations)
+	offset := agentOffset(agentNum, b.Iterations, b.Duration, b.Warmup)
+	minRowID := b.MinRowID + offset
+	minColumnID := b.MinColumnID + offset
 
-	for n := 0; n < b.Iterations; n++ {
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	for loop.Next() {
+		n := loop.N() - 1
 		start := time.Now()
 		_, err := client.Query(field.Set(minRowID+n, minColumnID+n))
-		result.Add(time.Since(start), nil)
+		loop.Add(result, time.Since(start), nil)
 		if err != nil {
 			return result, err
 		}
 	}
-	return result, nil
+	return result, loop.Finish(result)
 }
@@ -0,0 +1,200 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+var _ Benchmark = (*GroupByBenchmark)(nil)
+
+// GroupByBenchmark runs GroupBy queries over the Rows of random fields
+// from an existing index, or, with Query "rows", Rows queries of a single
+// random field. It reports the number of groups, or rows, each query
+// returned, along with its latency. Distinct queries aren't covered, as
+// neither the client nor the server this is built against has them.
+type GroupByBenchmark struct {
+	Name       string        `json:"name"`
+	Query      string        `json:"query" help:"Query to run: groupby, or rows."`
+	Index      string        `json:"index" help:"Index to use. If blank, one is chosen randomly from the schema."`
+	Fields     []string      `json:"fields" help:"Comma separated list of set, mutex, time or bool fields. If blank, use all of them in the index schema."`
+	NumFields  int           `json:"num-fields" help:"Number of fields to group by in each query."`
+	Filters    int           `json:"filters" help:"Number of random rows to intersect as each groupby query's filter. If 0, queries aren't filtered."`
+	Limit      int64         `json:"limit" help:"Most groups for each groupby query to return. If 0, there's no limit."`
+	RowsLimit  int64         `json:"rows-limit" help:"Most rows of each field to group by, or return. If 0, there's no limit."`
+	Previous   bool          `json:"previous" help:"If true, start each field's rows after a random row, as when paging through results."`
+	MinRowID   int64         `json:"min-row-id" help:"Minimum row ID to use in filters and as the previous row."`
+	MaxRowID   int64         `json:"max-row-id" help:"Max row ID to use in filters and as the previous row."`
+	Seed       int64         `json:"seed" help:"Random seed, to which agent num is added."`
+	Iterations int           `json:"iterations" help:"Number of queries to perform."`
+	Duration   time.Duration `json:"duration" help:"Run for this long instead of a number of iterations." short:""`
+	Warmup     time.Duration `json:"warmup" help:"Run queries for this long before measuring any." short:""`
+	Rate       float64       `json:"rate" help:"If set, send this many queries per second, open-loop, instead of waiting for each query before sending the next." short:""`
+	Arrivals   string        `json:"arrivals" help:"Spacing of open-loop queries: uniform or poisson." short:""`
+	Workers    int           `json:"workers" help:"Most open-loop queries in flight at once." short:""`
+	MaxLag     time.Duration `json:"max-lag" help:"Drop open-loop queries which can't be sent within this long of when they're due. If 0, none are dropped." short:""`
+
+	Logger *log.Logger `json:"-"`
+}
+
+// NewGroupByBenchmark returns a new instance of GroupByBenchmark.
+func NewGroupByBenchmark() *GroupByBenchmark {
+	return &GroupByBenchmark{
+		Name:       "groupby",
+		Query:      "groupby",
+		NumFields:  2,
+		MaxRowID:   100,
+		Seed:       1,
+		Iterations: 100,
+		Arrivals:   "uniform",
+		Workers:    16,
+		Logger:     log.New(os.Stderr, "", log.LstdFlags),
+	}
+}
+
+// groupable reports whether a field's rows can be grouped by.
+func groupable(f *pilosa.Field) bool {
+	switch f.Options().Type() {
+	case pilosa.FieldTypeDefault, pilosa.FieldTypeSet, pilosa.FieldTypeMutex, pilosa.FieldTypeTime, pilosa.FieldTypeBool:
+		return true
+	}
+	return false
+}
+
+// Run runs the benchmark.
+func (b *GroupByBenchmark) Run(ctx context.Context, client *pilosa.Client, agentNum int) (*Result, error) {
+	result := NewResult()
+	result.AgentNum = agentNum
+	result.Configuration = b
+
+	index, fields, err := schemaFields(client, b.Index, b.Fields, groupable)
+	if err != nil {
+		return result, err
+	}
+	b.Index = index.Name()
+
+	switch b.Query {
+	case "groupby":
+		if b.NumFields < 1 || b.NumFields > len(fields) {
+			return result, fmt.Errorf("can't group by %d fields, of %d in index '%s'", b.NumFields, len(fields), b.Index)
+		}
+	case "rows":
+		if b.Filters > 0 || b.Limit > 0 {
+			return result, errors.New("filters and limit only apply to groupby queries")
+		}
+	default:
+		return result, fmt.Errorf("invalid query type: %q (must be \"groupby\" or \"rows\")", b.Query)
+	}
+	if (b.Filters > 0 || b.Previous) && b.MaxRowID <= b.MinRowID {
+		return result, fmt.Errorf("max row id %d must be greater than min row id %d", b.MaxRowID, b.MinRowID)
+	}
+
+	r := rand.New(rand.NewSource(b.Seed + int64(agentNum)))
+	var mu sync.Mutex
+	stats := NewNumStats()
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	if b.Rate > 0 {
+		open := &OpenLoop{Rate: b.Rate, Arrivals: b.Arrivals, Workers: b.Workers, MaxLag: b.MaxLag, Seed: b.Seed + int64(agentNum)}
+		err = open.Run(ctx, loop, result, func(n int) Op {
+			q := b.randomQuery(r, index, fields)
+			measuring := loop.Measuring()
+			return func() (*pilosa.QueryResponse, error) {
+				groups, err := b.query(client, q)
+				if err == nil && measuring {
+					mu.Lock()
+					stats.Add(groups)
+					mu.Unlock()
+				}
+				return nil, err
+			}
+		})
+	} else {
+		for loop.Next() {
+			q := b.randomQuery(r, index, fields)
+			start := time.Now()
+			groups, qErr := b.query(client, q)
+			loop.Add(result, time.Since(start), nil)
+			if qErr != nil {
+				return result, qErr
+			}
+			if loop.Measuring() {
+				stats.Add(groups)
+			}
+		}
+		err = loop.Finish(result)
+	}
+	result.Extra["groupstats"] = stats
+	return result, err
+}
+
+// randomQuery returns a GroupBy query of the Rows of NumFields different
+// random fields, or, for rows queries, a Rows query of one random field.
+func (b *GroupByBenchmark) randomQuery(r *rand.Rand, index *pilosa.Index, fields []*pilosa.Field) pilosa.PQLQuery {
+	if b.Query == "rows" {
+		return b.rows(r, fields[r.Intn(len(fields))])
+	}
+	rows := make([]*pilosa.PQLRowsQuery, b.NumFields)
+	for i, j := range r.Perm(len(fields))[:b.NumFields] {
+		rows[i] = b.rows(r, fields[j])
+	}
+	if b.Filters == 0 {
+		if b.Limit > 0 {
+			return index.GroupByLimit(b.Limit, rows...)
+		}
+		return index.GroupBy(rows...)
+	}
+	filters := make([]*pilosa.PQLRowQuery, b.Filters)
+	for i := range filters {
+		filters[i] = fields[r.Intn(len(fields))].Row(b.randomRowID(r))
+	}
+	filter := filters[0]
+	if len(filters) > 1 {
+		filter = index.Intersect(filters...)
+	}
+	if b.Limit > 0 {
+		return index.GroupByLimitFilter(b.Limit, filter, rows...)
+	}
+	return index.GroupByFilter(filter, rows...)
+}
+
+// rows returns a Rows query of a field, with the configured limit, and
+// starting after a random row, if Previous is set.
+func (b *GroupByBenchmark) rows(r *rand.Rand, field *pilosa.Field) *pilosa.PQLRowsQuery {
+	switch {
+	case b.Previous && b.RowsLimit > 0:
+		return field.RowsPreviousLimit(b.randomRowID(r), b.RowsLimit)
+	case b.Previous:
+		return field.RowsPrevious(b.randomRowID(r))
+	case b.RowsLimit > 0:
+		return field.RowsLimit(b.RowsLimit)
+	}
+	return field.Rows()
+}
+
+func (b *GroupByBenchmark) randomRowID(r *rand.Rand) int64 {
+	return b.MinRowID + r.Int63n(b.MaxRowID-b.MinRowID)
+}
+
+// query runs a GroupBy or Rows query, and returns the number of groups,
+// or rows, in its result.
+func (b *GroupByBenchmark) query(client *pilosa.Client, q pilosa.PQLQuery) (int64, error) {
+	resp, err := client.Query(q)
+	if err != nil {
+		return 0, errors.Wrap(err, "performing query")
+	}
+	if !resp.Success {
+		return 0, errors.Errorf("unsuccessful query: %s", resp.ErrorMessage)
+	}
+	if b.Query == "rows" {
+		ids := resp.Result().RowIdentifiers()
+		return int64(len(ids.IDs) + len(ids.Keys)), nil
+	}
+	return int64(len(resp.Result().GroupCounts())), nil
+}
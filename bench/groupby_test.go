@@ -0,0 +1,166 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pilosa/go-pilosa"
+	"github.com/pilosa/pilosa/test"
+)
+
+func TestGroupable(t *testing.T) {
+	index := pilosa.NewSchema().Index("i")
+	for _, c := range []struct {
+		field     *pilosa.Field
+		groupable bool
+	}{
+		{index.Field("default"), true},
+		{index.Field("set", pilosa.OptFieldTypeSet(pilosa.CacheTypeRanked, 100)), true},
+		{index.Field("mutex", pilosa.OptFieldTypeMutex(pilosa.CacheTypeDefault, 0)), true},
+		{index.Field("time", pilosa.OptFieldTypeTime(pilosa.TimeQuantumYearMonthDay)), true},
+		{index.Field("bool", pilosa.OptFieldTypeBool()), true},
+		{index.Field("int", pilosa.OptFieldTypeInt(0, 100)), false},
+	} {
+		if got := groupable(c.field); got != c.groupable {
+			t.Errorf("field %s: expected groupable %v, got %v", c.field.Name(), c.groupable, got)
+		}
+	}
+}
+
+func TestGroupByFields(t *testing.T) {
+	cluster := test.MustRunCluster(t, 1)
+	defer cluster.Close()
+	client, err := pilosa.NewClient(cluster[0].URL())
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatalf("getting schema: %v", err)
+	}
+	index := schema.Index("i")
+	index.Field("s")
+	index.Field("m", pilosa.OptFieldTypeMutex(pilosa.CacheTypeDefault, 0))
+	index.Field("b", pilosa.OptFieldTypeBool())
+	index.Field("n", pilosa.OptFieldTypeInt(0, 100))
+	if err := client.SyncSchema(schema); err != nil {
+		t.Fatalf("creating fields: %v", err)
+	}
+
+	for _, c := range []struct {
+		names    []string
+		expected string
+		err      string
+	}{
+		{expected: "b,m,s"},
+		{names: []string{"s", "m"}, expected: "s,m"},
+		{names: []string{"s", "n"}, err: "can't use int field 'n' in index 'i'"},
+		{names: []string{"x"}, err: "field 'x' not found"},
+	} {
+		_, fields, err := schemaFields(client, "i", c.names, groupable)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("fields %v: expected error %q, got %v", c.names, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("fields %v: %v", c.names, err)
+		}
+		names := make([]string, len(fields))
+		for i, f := range fields {
+			names[i] = f.Name()
+		}
+		if got := strings.Join(names, ","); got != c.expected {
+			t.Errorf("fields %v: expected %s, got %s", c.names, c.expected, got)
+		}
+	}
+
+	// filters and limits don't apply to rows queries, so they're refused.
+	for _, b := range []*GroupByBenchmark{
+		{Query: "rows", Index: "i", Filters: 1, MaxRowID: 10, Iterations: 1},
+		{Query: "rows", Index: "i", Limit: 10, Iterations: 1},
+	} {
+		if _, err := b.Run(context.Background(), client, 0); err == nil || !strings.Contains(err.Error(), "only apply to groupby") {
+			t.Errorf("filters %d, limit %d: expected rows query to be refused, got %v", b.Filters, b.Limit, err)
+		}
+	}
+}
+
+func TestGroupByRandomQuery(t *testing.T) {
+	index := pilosa.NewSchema().Index("i")
+	fields := []*pilosa.Field{index.Field("a"), index.Field("b"), index.Field("c"), index.Field("d")}
+	rowsCall := regexp.MustCompile(`Rows\(field='(\w)'([^)]*)\)`)
+	rowCall := regexp.MustCompile(`Row\(\w=(\d+)\)`)
+	previous := regexp.MustCompile(`previous=\d+`)
+	for _, c := range []struct {
+		b *GroupByBenchmark
+		// what the query starts with, and has in it, other than its Rows.
+		prefix   string
+		contains []string
+		rows     int
+		rowOpts  string
+		filters  int
+	}{
+		{b: &GroupByBenchmark{Query: "groupby", NumFields: 2}, prefix: "GroupBy(", rows: 2},
+		{b: &GroupByBenchmark{Query: "groupby", NumFields: 4, Limit: 5}, prefix: "GroupBy(", contains: []string{",limit=5)"}, rows: 4},
+		{b: &GroupByBenchmark{Query: "groupby", NumFields: 2, Filters: 1}, prefix: "GroupBy(", contains: []string{",filter=Row("}, rows: 2, filters: 1},
+		{b: &GroupByBenchmark{Query: "groupby", NumFields: 3, Filters: 3, Limit: 7}, prefix: "GroupBy(", contains: []string{",limit=7,filter=Intersect(Row("}, rows: 3, filters: 3},
+		{b: &GroupByBenchmark{Query: "groupby", NumFields: 2, RowsLimit: 3}, prefix: "GroupBy(", rows: 2, rowOpts: ",limit=3"},
+		{b: &GroupByBenchmark{Query: "groupby", NumFields: 2, Previous: true, RowsLimit: 3}, prefix: "GroupBy(", rows: 2, rowOpts: ",previous=N,limit=3"},
+		{b: &GroupByBenchmark{Query: "rows"}, prefix: "Rows(", rows: 1},
+		{b: &GroupByBenchmark{Query: "rows", Previous: true}, prefix: "Rows(", rows: 1, rowOpts: ",previous=N"},
+	} {
+		c.b.MinRowID, c.b.MaxRowID = 10, 20
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 20; i++ {
+			q := c.b.randomQuery(r, index, fields).Serialize().String()
+			desc := fmt.Sprintf("%+v: %s", *c.b, q)
+			if !strings.HasPrefix(q, c.prefix) {
+				t.Fatalf("%s: expected prefix %s", desc, c.prefix)
+			}
+			for _, s := range c.contains {
+				if !strings.Contains(q, s) {
+					t.Fatalf("%s: expected it to contain %s", desc, s)
+				}
+			}
+			if c.filters == 0 && strings.Contains(q, "filter=") {
+				t.Fatalf("%s: expected no filter", desc)
+			}
+			if c.b.Limit == 0 && strings.Contains(q, "),limit=") {
+				t.Fatalf("%s: expected no limit", desc)
+			}
+			// every field grouped by is different, and each one's options
+			// are the same, but for the random previous row.
+			seen := make(map[string]bool)
+			calls := rowsCall.FindAllStringSubmatch(q, -1)
+			for _, call := range calls {
+				if seen[call[1]] {
+					t.Fatalf("%s: field %s used twice", desc, call[1])
+				}
+				seen[call[1]] = true
+				opts := previous.ReplaceAllString(call[2], "previous=N")
+				if opts != c.rowOpts {
+					t.Fatalf("%s: expected rows options %q, got %q", desc, c.rowOpts, opts)
+				}
+			}
+			if len(calls) != c.rows {
+				t.Fatalf("%s: expected %d Rows calls, got %d", desc, c.rows, len(calls))
+			}
+			ids := rowCall.FindAllStringSubmatch(q, -1)
+			if len(ids) != c.filters {
+				t.Fatalf("%s: expected %d filter rows, got %d", desc, c.filters, len(ids))
+			}
+			for _, id := range ids {
+				if n, _ := strconv.Atoi(id[1]); n < 10 || n >= 20 {
+					t.Fatalf("%s: filter row %d out of range", desc, n)
+				}
+			}
+		}
+	}
+}
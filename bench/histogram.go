@@ -0,0 +1,142 @@
+package bench
+
+import (
+	"encoding/json"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// The histogram's buckets are laid out as in an HDR histogram: durations
+// below 2^histogramSubBits nanoseconds each get their own bucket, and
+// above that, each power of two is split into 2^(histogramSubBits-1)
+// equal buckets, so a duration's bucket is within 1/128 of it.
+// Durations of 2^histogramMaxBits nanoseconds (about 4.9 hours) or more
+// share the last bucket.
+const (
+	histogramSubBits  = 8
+	histogramHalf     = 1 << (histogramSubBits - 1)
+	histogramMaxBits  = 44
+	histogramBuckets  = (histogramMaxBits - histogramSubBits + 2) * histogramHalf
+	histogramMaxValue = 1<<histogramMaxBits - 1
+)
+
+// Histogram counts durations in buckets of bounded relative width, using
+// a fixed amount of memory however many durations it counts. Histograms
+// can be merged, so each goroutine or agent can keep its own and combine
+// them at the end. The zero value is an empty histogram.
+type Histogram struct {
+	counts []int64
+	total  int64
+}
+
+// histogramIndex returns the bucket holding a duration in nanoseconds.
+func histogramIndex(v int64) int {
+	if v < 0 {
+		v = 0
+	}
+	if v > histogramMaxValue {
+		v = histogramMaxValue
+	}
+	if v < 2*histogramHalf {
+		return int(v)
+	}
+	shift := uint(bits.Len64(uint64(v)) - histogramSubBits)
+	return int(shift)*histogramHalf + int(v>>shift)
+}
+
+// histogramBounds returns the lowest and highest durations in a bucket.
+func histogramBounds(idx int) (low, high int64) {
+	if idx < 2*histogramHalf {
+		return int64(idx), int64(idx)
+	}
+	shift := uint(idx/histogramHalf - 1)
+	low = int64(idx-int(shift)*histogramHalf) << shift
+	return low, low + 1<<shift - 1
+}
+
+// Add counts a duration.
+func (h *Histogram) Add(d time.Duration) {
+	h.addN(int64(d), 1)
+}
+
+func (h *Histogram) addN(v int64, n int64) {
+	if h.counts == nil {
+		h.counts = make([]int64, histogramBuckets)
+	}
+	h.counts[histogramIndex(v)] += n
+	h.total += n
+}
+
+// Count returns the number of durations counted.
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Merge adds the counts from other to h.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.total == 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make([]int64, histogramBuckets)
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+}
+
+// Quantile returns the duration which a fraction q of the counted
+// durations are at or below, as the highest duration in its bucket. It
+// returns 0 for an empty histogram.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	// the rank of the wanted duration, counting from 1, allowing for
+	// rounding errors like 0.9*100 coming out slightly over 90.
+	rank := int64(math.Ceil(q*float64(h.total) - 1e-9))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > h.total {
+		rank = h.total
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			_, high := histogramBounds(i)
+			return time.Duration(high)
+		}
+	}
+	panic("unreachable")
+}
+
+// MarshalJSON encodes the histogram as a list of the buckets which have
+// durations, each as a pair of its lowest duration, in nanoseconds, and
+// its count.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	buckets := make([][2]int64, 0)
+	for i, c := range h.counts {
+		if c != 0 {
+			low, _ := histogramBounds(i)
+			buckets = append(buckets, [2]int64{low, c})
+		}
+	}
+	return json.Marshal(buckets)
+}
+
+// UnmarshalJSON decodes a histogram encoded by MarshalJSON.
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var buckets [][2]int64
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return err
+	}
+	*h = Histogram{}
+	for _, b := range buckets {
+		h.addN(b[0], b[1])
+	}
+	return nil
+}
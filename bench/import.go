@@ -49,7 +49,7 @@ func (b *ImportBenchmark) Run(ctx context.Context, client *pilosa.Client, agentN
 	}
 
 	itr := b.RecordIterator(b.Seed + int64(agentNum))
-	err = client.ImportField(field, itr, pilosa.OptImportBatchSize(b.BufferSize))
+	err = client.ImportField(field, &cancelableRecords{RecordIterator: itr, ctx: ctx}, pilosa.OptImportBatchSize(b.BufferSize))
 	result.Extra["actual-iterations"] = itr.actualIterations
 	result.Extra["avgdelta"] = itr.avgdelta
 	return result, err
@@ -50,7 +50,7 @@ func (b *ImportRangeBenchmark) Run(ctx context.Context, client *pilosa.Client, a
 	}
 
 	itr := b.ValueIterator(b.Seed + int64(agentNum))
-	err = client.ImportField(field, itr, pilosa.OptImportBatchSize(b.BufferSize))
+	err = client.ImportField(field, &cancelableRecords{RecordIterator: itr, ctx: ctx}, pilosa.OptImportBatchSize(b.BufferSize))
 	result.Extra["actual-iterations"] = itr.actualIterations
 	result.Extra["avgdelta"] = itr.avgdelta
 	return result, err
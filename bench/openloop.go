@@ -0,0 +1,186 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pilosa/go-pilosa"
+)
+
+// openLoopQueue is the most requests which can be waiting for a worker.
+// Once it's full, requests are dropped instead.
+const openLoopQueue = 10000
+
+// Op is a single operation of an open-loop benchmark, usually a query.
+// If it returns a response, the response is kept in the result.
+type Op func() (*pilosa.QueryResponse, error)
+
+// queryOp returns an op which runs q, discarding its response, as most
+// benchmarks don't keep them.
+func queryOp(client *pilosa.Client, q pilosa.PQLQuery) Op {
+	return func() (*pilosa.QueryResponse, error) {
+		_, err := client.Query(q)
+		return nil, err
+	}
+}
+
+// OpenLoop runs a benchmark's operations open-loop: they're sent on a
+// fixed schedule, at Rate per second, whether or not earlier ones have
+// finished, rather than each waiting for the one before. Otherwise,
+// when the server stalls, fewer requests are sent, and the stall shows
+// up in only a few latencies. Latency is measured from when each
+// request should have been sent, so time spent waiting for a worker
+// counts.
+//
+// Requests which can't be sent within MaxLag of their time, or which
+// find too many requests already waiting, are dropped, and counted
+// rather than measured. Requests sent more than one interval (1/Rate)
+// late are counted as late.
+type OpenLoop struct {
+	// Rate is the number of requests to send per second.
+	Rate float64
+	// Arrivals is "uniform", for evenly spaced requests, or "poisson",
+	// for exponentially distributed gaps between them.
+	Arrivals string
+	// Workers is the most requests which can be in flight at once.
+	Workers int
+	// MaxLag, if positive, is how late a request can be sent before it's
+	// dropped.
+	MaxLag time.Duration
+	// Seed seeds the poisson arrivals.
+	Seed int64
+}
+
+// openRequest is a request to be sent by a worker.
+type openRequest struct {
+	op        Op
+	intended  time.Time
+	measuring bool
+}
+
+// Run runs ops from next until loop stops, recording their latencies in
+// result, along with the number of requests dropped and sent late, the
+// latencies measured from when they were actually sent, and the rate
+// achieved. Each iteration of the loop is a request, and next is called
+// for each, in turn, with the iteration's number, so it doesn't need to
+// be safe for concurrent use, although the ops it returns do. Run stops
+// at the first op which fails, and returns its error.
+func (o *OpenLoop) Run(ctx context.Context, loop *Loop, result *Result, next func(n int) Op) error {
+	if o.Rate <= 0 {
+		return fmt.Errorf("invalid rate %v: must be greater than 0", o.Rate)
+	}
+	interval := time.Duration(float64(time.Second) / o.Rate)
+	var gap func() time.Duration
+	switch o.Arrivals {
+	case "", "uniform":
+		gap = func() time.Duration { return interval }
+	case "poisson":
+		r := rand.New(rand.NewSource(o.Seed))
+		gap = func() time.Duration { return time.Duration(r.ExpFloat64() * float64(interval)) }
+	default:
+		return fmt.Errorf("unknown arrivals '%s' (must be \"uniform\" or \"poisson\")", o.Arrivals)
+	}
+	workers := o.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// the first failure stops the workers, and the loop below.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		dropped  int64
+		late     int64
+		done     int64
+		service  = NewStats()
+	)
+	queue := make(chan openRequest, openLoopQueue)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				sent := time.Now()
+				lag := sent.Sub(req.intended)
+				if o.MaxLag > 0 && lag > o.MaxLag {
+					if req.measuring {
+						mu.Lock()
+						dropped++
+						mu.Unlock()
+					}
+					continue
+				}
+				resp, err := req.op()
+				end := time.Now()
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				if req.measuring {
+					result.Add(end.Sub(req.intended), resp)
+					service.Add(end.Sub(sent))
+					done++
+					if lag > interval {
+						late++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	intended := time.Now()
+	for loop.Next() {
+		req := openRequest{op: next(loop.N() - 1), intended: intended, measuring: loop.Measuring()}
+		if wait := time.Until(intended); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			loop.stop(err)
+			break
+		}
+		select {
+		case queue <- req:
+		default:
+			if req.measuring {
+				mu.Lock()
+				dropped++
+				mu.Unlock()
+			}
+		}
+		intended = intended.Add(gap())
+	}
+	close(queue)
+	wg.Wait()
+
+	err := loop.Finish(result)
+	if firstErr != nil {
+		err = firstErr
+	}
+	elapsed := loop.Elapsed()
+	result.Extra["target-rate"] = o.Rate
+	if elapsed > 0 {
+		result.Extra["achieved-rate"] = float64(done) / elapsed.Seconds()
+	}
+	result.Extra["dropped"] = dropped
+	result.Extra["late"] = late
+	result.Extra["service-stats"] = service
+	return err
+}
@@ -0,0 +1,304 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// Plan describes benchmarks to run in stages. The stages run one after
+// another, and within a stage, every agent of every benchmark runs at
+// once.
+type Plan struct {
+	// Hosts are given to every agent with --hosts, unless a benchmark's
+	// config sets hosts itself.
+	Hosts  []string     `toml:"hosts"`
+	Stages []*PlanStage `toml:"stages"`
+}
+
+// PlanStage is a set of benchmarks run at the same time.
+type PlanStage struct {
+	Name string `toml:"name"`
+	// Agents is the number of agents for benchmarks which don't give
+	// their own, default 1.
+	Agents     int              `toml:"agents"`
+	Benchmarks []*PlanBenchmark `toml:"benchmarks"`
+}
+
+// PlanBenchmark is a benchmark run by one or more agents. Each agent runs
+// "bench <name>", with its config as flags, followed by any extra args.
+// The agents get agent numbers from 0 up, so they do different work.
+type PlanBenchmark struct {
+	Name   string                 `toml:"name"`
+	Agents int                    `toml:"agents"`
+	Config map[string]interface{} `toml:"config"`
+	Args   []string               `toml:"args"`
+}
+
+// ReadPlan reads a plan from a TOML file.
+func ReadPlan(path string) (*Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening plan")
+	}
+	defer f.Close()
+	return DecodePlan(f)
+}
+
+// DecodePlan decodes a plan from TOML, and checks it.
+func DecodePlan(r io.Reader) (*Plan, error) {
+	var plan Plan
+	md, err := toml.DecodeReader(r, &plan)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding plan")
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, strings.Join(key, "."))
+		}
+		return nil, fmt.Errorf("unknown keys in plan: %s", strings.Join(keys, ", "))
+	}
+	if len(plan.Stages) == 0 {
+		return nil, errors.New("plan has no stages")
+	}
+	for i, stage := range plan.Stages {
+		if stage.Name == "" {
+			stage.Name = fmt.Sprintf("stage-%d", i)
+		}
+		if stage.Agents < 0 {
+			return nil, fmt.Errorf("stage %s: invalid agent count %d", stage.Name, stage.Agents)
+		}
+		if stage.Agents == 0 {
+			stage.Agents = 1
+		}
+		if len(stage.Benchmarks) == 0 {
+			return nil, fmt.Errorf("stage %s has no benchmarks", stage.Name)
+		}
+		for _, b := range stage.Benchmarks {
+			if b.Name == "" {
+				return nil, fmt.Errorf("stage %s: benchmark without a name", stage.Name)
+			}
+			if b.Agents < 0 {
+				return nil, fmt.Errorf("stage %s, benchmark %s: invalid agent count %d", stage.Name, b.Name, b.Agents)
+			}
+			if b.Agents == 0 {
+				b.Agents = stage.Agents
+			}
+		}
+	}
+	return &plan, nil
+}
+
+// args returns the arguments for one of a benchmark's agents.
+func (b *PlanBenchmark) args(hosts []string, agentNum int) []string {
+	args := []string{"bench", b.Name, fmt.Sprintf("--agent-num=%d", agentNum), "--human=false"}
+	if _, ok := b.Config["hosts"]; !ok && len(hosts) > 0 {
+		args = append(args, "--hosts="+strings.Join(hosts, ","))
+	}
+	names := make([]string, 0, len(b.Config))
+	for name := range b.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("--%s=%s", name, flagValue(b.Config[name])))
+	}
+	return append(args, b.Args...)
+}
+
+// flagValue formats a config value from a plan as a flag's value. Lists
+// are joined with commas, as slice flags expect.
+func flagValue(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		values := make([]string, len(list))
+		for i, item := range list {
+			values[i] = flagValue(item)
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// Transport runs agents. Each agent runs pi with the given arguments, and
+// its output, the JSON for a Result, is returned. agent numbers the
+// agents in a stage from 0, across all its benchmarks, so transports can
+// spread them out.
+type Transport interface {
+	RunAgent(ctx context.Context, agent int, args []string) ([]byte, error)
+}
+
+// LocalTransport runs agents as subprocesses, running Command followed by
+// each agent's arguments.
+type LocalTransport struct {
+	Command []string
+}
+
+// RunAgent runs an agent as a subprocess.
+func (t *LocalTransport) RunAgent(ctx context.Context, agent int, args []string) ([]byte, error) {
+	return runAgentCommand(exec.CommandContext(ctx, t.Command[0], append(t.Command[1:], args...)...))
+}
+
+// SSHTransport runs agents on other hosts, using ssh, with agents
+// assigned to hosts in turn. Command is run on the hosts, followed by
+// each agent's arguments.
+type SSHTransport struct {
+	Hosts   []string
+	Command string
+}
+
+// RunAgent runs an agent on one of the hosts.
+func (t *SSHTransport) RunAgent(ctx context.Context, agent int, args []string) ([]byte, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	host := t.Hosts[agent%len(t.Hosts)]
+	return runAgentCommand(exec.CommandContext(ctx, "ssh", host, t.Command+" "+strings.Join(quoted, " ")))
+}
+
+// runAgentCommand runs an agent's command, returning its output, and
+// including what it wrote to stderr in the error if it fails.
+func runAgentCommand(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, errors.Wrapf(err, "running agent: %s", strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// PlanReport holds the results of every agent in a plan, by stage and
+// benchmark.
+type PlanReport struct {
+	Start    time.Time      `json:"start"`
+	Duration PrettyDuration `json:"duration"`
+	Stages   []*StageReport `json:"stages"`
+}
+
+// StageReport holds the results of a stage's benchmarks.
+type StageReport struct {
+	Name       string             `json:"name"`
+	Duration   PrettyDuration     `json:"duration"`
+	Benchmarks []*BenchmarkReport `json:"benchmarks"`
+}
+
+// BenchmarkReport holds the results of each of a benchmark's agents, and
+// their stats combined. Errors counts the agents which failed.
+type BenchmarkReport struct {
+	Name   string         `json:"name"`
+	Stats  *Stats         `json:"stats"`
+	Errors int            `json:"errors"`
+	Agents []*AgentReport `json:"agents"`
+}
+
+// AgentReport holds an agent's Result, as it reported it, and how long the
+// agent took. Error is set if the agent couldn't be run, or reported an
+// error.
+type AgentReport struct {
+	AgentNum int             `json:"agentnum"`
+	Args     []string        `json:"args"`
+	Duration PrettyDuration  `json:"duration"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// RunPlan runs a plan's stages in order, using t to run the agents, and
+// waiting for every agent in a stage before starting the next. It stops
+// after a stage in which any agent fails. The report covers every stage
+// which ran, even if there's an error.
+func RunPlan(ctx context.Context, plan *Plan, t Transport) (*PlanReport, error) {
+	report := &PlanReport{Start: time.Now()}
+	defer func() {
+		report.Duration = PrettyDuration(time.Since(report.Start))
+	}()
+	for _, stage := range plan.Stages {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		sr, failed := runStage(ctx, plan, stage, t)
+		report.Stages = append(report.Stages, sr)
+		if failed > 0 {
+			return report, fmt.Errorf("stage %s: %d agents failed", stage.Name, failed)
+		}
+	}
+	return report, nil
+}
+
+// runStage runs all the agents for a stage's benchmarks at once, and
+// returns their results, and the number which failed.
+func runStage(ctx context.Context, plan *Plan, stage *PlanStage, t Transport) (*StageReport, int) {
+	start := time.Now()
+	sr := &StageReport{Name: stage.Name}
+	var wg sync.WaitGroup
+	agent := 0
+	for _, b := range stage.Benchmarks {
+		br := &BenchmarkReport{Name: b.Name, Stats: NewStats(), Agents: make([]*AgentReport, b.Agents)}
+		sr.Benchmarks = append(sr.Benchmarks, br)
+		for i := range br.Agents {
+			ar := &AgentReport{AgentNum: i, Args: b.args(plan.Hosts, i)}
+			br.Agents[i] = ar
+			wg.Add(1)
+			go func(agent int) {
+				defer wg.Done()
+				before := time.Now()
+				out, err := t.RunAgent(ctx, agent, ar.Args)
+				ar.Duration = PrettyDuration(time.Since(before))
+				if err != nil {
+					ar.Error = err.Error()
+				}
+				if len(bytes.TrimSpace(out)) > 0 {
+					ar.Result = out
+				}
+			}(agent)
+			agent++
+		}
+	}
+	wg.Wait()
+	failed := 0
+	for _, br := range sr.Benchmarks {
+		for _, ar := range br.Agents {
+			// output which isn't a result can't go in the report.
+			if ar.Result != nil && !json.Valid(ar.Result) {
+				if ar.Error == "" {
+					ar.Error = fmt.Sprintf("invalid result: %q", ar.Result)
+				}
+				ar.Result = nil
+			}
+			if ar.Error == "" && ar.Result != nil {
+				var result struct {
+					Stats *Stats `json:"stats"`
+					Error string `json:"error"`
+				}
+				if err := json.Unmarshal(ar.Result, &result); err != nil {
+					ar.Error = fmt.Sprintf("decoding result: %v", err)
+				} else if result.Error != "" {
+					ar.Error = result.Error
+				} else if result.Stats != nil {
+					br.Stats.Combine(result.Stats)
+				}
+			}
+			if ar.Error == "" && ar.Result == nil {
+				ar.Error = "no result"
+			}
+			if ar.Error != "" {
+				br.Errors++
+			}
+		}
+		failed += br.Errors
+	}
+	sr.Duration = PrettyDuration(time.Since(start))
+	return sr, failed
+}
@@ -10,10 +10,16 @@ import (
 )
 
 type QueryBenchmark struct {
-	Name       string `json:"name"`
-	Query      string `json:"query"`
-	Index      string `json:"index"`
-	Iterations int    `json:"iterations"`
+	Name       string        `json:"name"`
+	Query      string        `json:"query"`
+	Index      string        `json:"index"`
+	Iterations int           `json:"iterations"`
+	Duration   time.Duration `json:"duration"`
+	Warmup     time.Duration `json:"warmup"`
+	Rate       float64       `json:"rate"`
+	Arrivals   string        `json:"arrivals"`
+	Workers    int           `json:"workers"`
+	MaxLag     time.Duration `json:"max-lag"`
 
 	Logger *log.Logger `json:"-"`
 }
@@ -37,13 +43,22 @@ func (b *QueryBenchmark) Run(ctx context.Context, client *pilosa.Client, agentNu
 		return result, err
 	}
 
-	for n := 0; n < b.Iterations; n++ {
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	if b.Rate > 0 {
+		open := &OpenLoop{Rate: b.Rate, Arrivals: b.Arrivals, Workers: b.Workers, MaxLag: b.MaxLag}
+		return result, open.Run(ctx, loop, result, func(n int) Op {
+			return func() (*pilosa.QueryResponse, error) {
+				return client.Query(index.RawQuery(b.Query))
+			}
+		})
+	}
+	for loop.Next() {
 		start := time.Now()
 		resp, err := client.Query(index.RawQuery(b.Query))
-		result.Add(time.Since(start), resp)
+		loop.Add(result, time.Since(start), resp)
 		if err != nil {
 			return result, err
 		}
 	}
-	return result, nil
+	return result, loop.Finish(result)
 }
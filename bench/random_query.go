@@ -13,16 +13,22 @@ var _ Benchmark = (*BasicQueryBenchmark)(nil)
 
 // RandomQueryBenchmark queries randomly and deterministically based on a seed.
 type RandomQueryBenchmark struct {
-	Name       string `json:"name"`
-	MaxDepth   int    `json:"max-depth"`
-	MaxArgs    int    `json:"max-args"`
-	MaxN       int    `json:"max-n"`
-	MinRowID   int64  `json:"min-row-id"`
-	MaxRowID   int64  `json:"max-row-id"`
-	Iterations int    `json:"iterations"`
-	Seed       int64  `json:"seed"`
-	Index      string `json:"index"`
-	Field      string `json:"field"`
+	Name       string        `json:"name"`
+	MaxDepth   int           `json:"max-depth"`
+	MaxArgs    int           `json:"max-args"`
+	MaxN       int           `json:"max-n"`
+	MinRowID   int64         `json:"min-row-id"`
+	MaxRowID   int64         `json:"max-row-id"`
+	Iterations int           `json:"iterations"`
+	Duration   time.Duration `json:"duration"`
+	Warmup     time.Duration `json:"warmup"`
+	Rate       float64       `json:"rate"`
+	Arrivals   string        `json:"arrivals"`
+	Workers    int           `json:"workers"`
+	MaxLag     time.Duration `json:"max-lag"`
+	Seed       int64         `json:"seed"`
+	Index      string        `json:"index"`
+	Field      string        `json:"field"`
 
 	Logger *log.Logger `json:"-"`
 }
@@ -48,13 +54,20 @@ func (b *RandomQueryBenchmark) Run(ctx context.Context, client *pilosa.Client, a
 	}
 
 	g := NewQueryGenerator(index, field, b.Seed+int64(agentNum))
-	for n := 0; n < b.Iterations; n++ {
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	if b.Rate > 0 {
+		open := &OpenLoop{Rate: b.Rate, Arrivals: b.Arrivals, Workers: b.Workers, MaxLag: b.MaxLag, Seed: b.Seed + int64(agentNum)}
+		return result, open.Run(ctx, loop, result, func(n int) Op {
+			return queryOp(client, g.Random(b.MaxN, b.MaxDepth, b.MaxArgs, uint64(b.MinRowID), uint64(b.MaxRowID-b.MinRowID)))
+		})
+	}
+	for loop.Next() {
 		start := time.Now()
 		_, err := client.Query(g.Random(b.MaxN, b.MaxDepth, b.MaxArgs, uint64(b.MinRowID), uint64(b.MaxRowID-b.MinRowID)))
-		result.Add(time.Since(start), nil)
+		loop.Add(result, time.Since(start), nil)
 		if err != nil {
 			return result, err
 		}
 	}
-	return result, nil
+	return result, loop.Finish(result)
 }
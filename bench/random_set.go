@@ -15,18 +15,20 @@ var _ Benchmark = (*RandomSetBenchmark)(nil)
 
 // RandomSetBenchmark sets bits randomly and deterministically based on a seed.
 type RandomSetBenchmark struct {
-	Name          string `json:"name"`
-	MinRowID      int64  `json:"min-row-id"`
-	MaxRowID      int64  `json:"max-row-id"`
-	MinColumnID   int64  `json:"min-column-id"`
-	MaxColumnID   int64  `json:"max-column-id"`
-	Iterations    int    `json:"iterations"`
-	BatchSize     int    `json:"batch-size"`
-	Seed          int64  `json:"seed"`
-	NumAttrs      int    `json:"num-attrs"`
-	NumAttrValues int    `json:"num-attr-values"`
-	Index         string `json:"index"`
-	Field         string `json:"field"`
+	Name          string        `json:"name"`
+	MinRowID      int64         `json:"min-row-id"`
+	MaxRowID      int64         `json:"max-row-id"`
+	MinColumnID   int64         `json:"min-column-id"`
+	MaxColumnID   int64         `json:"max-column-id"`
+	Iterations    int           `json:"iterations"`
+	Duration      time.Duration `json:"duration"`
+	Warmup        time.Duration `json:"warmup"`
+	BatchSize     int           `json:"batch-size"`
+	Seed          int64         `json:"seed"`
+	NumAttrs      int           `json:"num-attrs"`
+	NumAttrValues int           `json:"num-attr-values"`
+	Index         string        `json:"index"`
+	Field         string        `json:"field"`
 
 	Logger *log.Logger `json:"-"`
 }
@@ -57,9 +59,21 @@ func (b *RandomSetBenchmark) Run(ctx context.Context, client *pilosa.Client, age
 
 	rand := rand.New(rand.NewSource(b.Seed))
 	const letters = "abcdefghijklmnopqrstuvwxyz"
-	for n := 0; n < b.Iterations; {
+	// each iteration of the loop sets a batch of values, the last one
+	// cut short so that exactly Iterations values are measured, unless
+	// running for a duration.
+	loop := NewLoop(ctx, (b.Iterations+b.BatchSize-1)/b.BatchSize, b.Duration, b.Warmup)
+	measured := 0
+	for loop.Next() {
+		size := b.BatchSize
+		if loop.Measuring() {
+			if b.Duration <= 0 && b.Iterations-measured < size {
+				size = b.Iterations - measured
+			}
+			measured += size
+		}
 		var a []pilosa.PQLQuery
-		for i := 0; i < b.BatchSize && n < b.Iterations; i, n = i+1, n+1 {
+		for i := 0; i < size; i++ {
 			rowID := rand.Int63n(b.MaxRowID - b.MinRowID)
 			columnID := rand.Int63n(b.MaxColumnID - b.MinColumnID)
 
@@ -75,10 +89,10 @@ func (b *RandomSetBenchmark) Run(ctx context.Context, client *pilosa.Client, age
 
 		start := time.Now()
 		_, err := client.Query(index.BatchQuery(a...))
-		result.Add(time.Since(start), nil)
+		loop.Add(result, time.Since(start), nil)
 		if err != nil {
 			return result, err
 		}
 	}
-	return result, nil
+	return result, loop.Finish(result)
 }
@@ -11,18 +11,24 @@ import (
 
 // RangeQueryBenchmark runs Range query randomly.
 type RangeQueryBenchmark struct {
-	Name       string `json:"name"`
-	MaxDepth   int    `json:"max-depth"`
-	MaxArgs    int    `json:"max-args"`
-	MaxN       int    `json:"max-n"`
-	MinRange   int64  `json:"min-range"`
-	MaxRange   int64  `json:"max-range"`
-	Iterations int    `json:"iterations"`
-	Seed       int64  `json:"seed"`
-	Frame      string `json:"frame"`
-	Index      string `json:"index"`
-	Field      string `json:"field"`
-	QueryType  string `json:"type"`
+	Name       string        `json:"name"`
+	MaxDepth   int           `json:"max-depth"`
+	MaxArgs    int           `json:"max-args"`
+	MaxN       int           `json:"max-n"`
+	MinRange   int64         `json:"min-range"`
+	MaxRange   int64         `json:"max-range"`
+	Iterations int           `json:"iterations"`
+	Duration   time.Duration `json:"duration"`
+	Warmup     time.Duration `json:"warmup"`
+	Rate       float64       `json:"rate"`
+	Arrivals   string        `json:"arrivals"`
+	Workers    int           `json:"workers"`
+	MaxLag     time.Duration `json:"max-lag"`
+	Seed       int64         `json:"seed"`
+	Frame      string        `json:"frame"`
+	Index      string        `json:"index"`
+	Field      string        `json:"field"`
+	QueryType  string        `json:"type"`
 
 	Logger *log.Logger `json:"-"`
 }
@@ -48,13 +54,20 @@ func (b *RangeQueryBenchmark) Run(ctx context.Context, client *pilosa.Client, ag
 	}
 
 	g := NewQueryGenerator(index, field, b.Seed)
-	for n := 0; n < b.Iterations; n++ {
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	if b.Rate > 0 {
+		open := &OpenLoop{Rate: b.Rate, Arrivals: b.Arrivals, Workers: b.Workers, MaxLag: b.MaxLag, Seed: b.Seed}
+		return result, open.Run(ctx, loop, result, func(n int) Op {
+			return queryOp(client, g.RandomRangeQuery(b.MaxDepth, b.MaxArgs, uint64(b.MinRange), uint64(b.MaxRange)))
+		})
+	}
+	for loop.Next() {
 		start := time.Now()
 		_, err := client.Query(g.RandomRangeQuery(b.MaxDepth, b.MaxArgs, uint64(b.MinRange), uint64(b.MaxRange)))
-		result.Add(time.Since(start), nil)
+		loop.Add(result, time.Since(start), nil)
 		if err != nil {
 			return result, err
 		}
 	}
-	return result, nil
+	return result, loop.Finish(result)
 }
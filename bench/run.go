@@ -0,0 +1,177 @@
+package bench
+
+import (
+	"context"
+	"time"
+
+	"github.com/pilosa/go-pilosa"
+)
+
+// Loop runs a benchmark's operations, either for a number of iterations,
+// or, if a duration is given, for that long, after an optional warmup
+// period. Samples taken during the warmup are thrown away, so caches are
+// warm by the time anything is measured, and neither the warmup
+// iterations nor the warmup time count towards the iterations or
+// duration. The loop stops early if its context is canceled. It's used
+// like this:
+//
+//	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+//	for loop.Next() {
+//		start := time.Now()
+//		resp, err := client.Query(q)
+//		loop.Add(result, time.Since(start), resp)
+//		if err != nil {
+//			return result, err
+//		}
+//	}
+//	return result, loop.Finish(result)
+//
+// A Loop isn't safe for concurrent use; concurrent benchmarks give each
+// goroutine its own.
+type Loop struct {
+	ctx        context.Context
+	iterations int
+	duration   time.Duration
+	warmup     time.Duration
+
+	start     time.Time // when the loop started, including the warmup
+	measured  time.Time // when the warmup ended
+	end       time.Time // when the loop stopped
+	n         int
+	warm      int // iterations run during the warmup
+	measuring bool
+	err       error
+}
+
+// NewLoop returns a loop which runs for iterations iterations, or, if
+// duration is positive, for duration, ignoring iterations. The first
+// warmup of the run isn't counted, or measured.
+func NewLoop(ctx context.Context, iterations int, duration, warmup time.Duration) *Loop {
+	return &Loop{
+		ctx:        ctx,
+		iterations: iterations,
+		duration:   duration,
+		warmup:     warmup,
+	}
+}
+
+// Next starts the next iteration, and reports whether there is one.
+func (l *Loop) Next() bool {
+	if !l.end.IsZero() {
+		return false
+	}
+	if err := l.ctx.Err(); err != nil {
+		l.stop(err)
+		return false
+	}
+	now := time.Now()
+	if l.start.IsZero() {
+		l.start = now
+	}
+	if !l.measuring && now.Sub(l.start) >= l.warmup {
+		l.measuring = true
+		l.measured = now
+	}
+	if l.measuring {
+		if l.duration > 0 {
+			if now.Sub(l.measured) >= l.duration {
+				l.stop(nil)
+				return false
+			}
+		} else if l.n-l.warm >= l.iterations {
+			l.stop(nil)
+			return false
+		}
+	} else {
+		l.warm++
+	}
+	l.n++
+	return true
+}
+
+// stop stops the loop, because of err, if it's not nil.
+func (l *Loop) stop(err error) {
+	l.err = err
+	l.end = time.Now()
+}
+
+// N returns the number of iterations started so far, including the
+// warmup, so the current iteration is N()-1.
+func (l *Loop) N() int {
+	return l.n
+}
+
+// Measuring reports whether the current iteration is past the warmup, and
+// so should be measured.
+func (l *Loop) Measuring() bool {
+	return l.measuring
+}
+
+// Add adds an operation's duration, and its response, if it has one, to
+// result, unless the operation was part of the warmup.
+func (l *Loop) Add(result *Result, d time.Duration, resp *pilosa.QueryResponse) {
+	if l.measuring {
+		result.Add(d, resp)
+	}
+}
+
+// Elapsed returns the time from the end of the warmup until the loop
+// stopped, or until now if it hasn't, or zero if the warmup hasn't ended.
+func (l *Loop) Elapsed() time.Duration {
+	if !l.measuring {
+		return 0
+	}
+	if !l.end.IsZero() {
+		return l.end.Sub(l.measured)
+	}
+	return time.Since(l.measured)
+}
+
+// Finish records the number of iterations measured and how long they
+// took in result's extras, along with the number of warmup iterations if
+// there was a warmup. It returns the context's error if the loop stopped
+// because the context was canceled.
+func (l *Loop) Finish(result *Result) error {
+	result.Extra["measured-iterations"] = l.n - l.warm
+	result.Extra["measured-duration"] = PrettyDuration(l.Elapsed())
+	if l.warmup > 0 {
+		result.Extra["warmup-iterations"] = l.warm
+	}
+	return l.Err()
+}
+
+// Err returns the context's error if the loop stopped because the context
+// was canceled.
+func (l *Loop) Err() error {
+	return l.err
+}
+
+// agentSpan is how many IDs each agent gets to itself when it can't tell
+// how many iterations it will run, because it runs for a duration, or has
+// a warmup.
+const agentSpan = 1 << 20
+
+// agentOffset returns the first of an agent's IDs, counting from a
+// benchmark's minimum, so agents running the same benchmark use
+// different rows or columns. Each agent gets iterations IDs, or, if the
+// loop's length isn't a number of iterations, agentSpan.
+func agentOffset(agentNum, iterations int, duration, warmup time.Duration) int {
+	if duration > 0 || warmup > 0 {
+		return agentNum * agentSpan
+	}
+	return agentNum * iterations
+}
+
+// cancelableRecords stops an import once its context is canceled, by
+// returning the context's error instead of the next record.
+type cancelableRecords struct {
+	pilosa.RecordIterator
+	ctx context.Context
+}
+
+func (c *cancelableRecords) NextRecord() (pilosa.Record, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.RecordIterator.NextRecord()
+}
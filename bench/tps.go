@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/pilosa/go-pilosa"
@@ -14,17 +15,22 @@ import (
 )
 
 type TPSBenchmark struct {
-	Name        string   `json:"name"`
-	Intersect   bool     `json:"intersect" help:"If true, include Intersect queries in benchmark."`
-	Union       bool     `json:"union" help:"If true, include Union queries in benchmark."`
-	Difference  bool     `json:"difference" help:"If true, include Difference queries in benchmark."`
-	Xor         bool     `json:"xor" help:"If true, include XOR queries in benchmark."`
-	Fields      []string `json:"fields" help:"Comma separated list of fields. If blank, use all fields in index schema."`
-	MinRowID    int64    `json:"min-row-id" help:"Minimum row ID to use in queries."`
-	MaxRowID    int64    `json:"max-row-id" help:"Max row ID to use in queries. If 0, determine max available."`
-	Index       string   `json:"index" help:"Index to use. If blank, one is chosen randomly from the schema."`
-	Concurrency int      `json:"concurrency" help:"Run this many goroutines concurrently." short:"y"`
-	Iterations  int      `json:"iterations" help:"Each goroutine will perform this many queries."`
+	Name        string        `json:"name"`
+	Intersect   bool          `json:"intersect" help:"If true, include Intersect queries in benchmark."`
+	Union       bool          `json:"union" help:"If true, include Union queries in benchmark."`
+	Difference  bool          `json:"difference" help:"If true, include Difference queries in benchmark."`
+	Xor         bool          `json:"xor" help:"If true, include XOR queries in benchmark."`
+	Fields      []string      `json:"fields" help:"Comma separated list of fields. If blank, use all fields in index schema."`
+	MinRowID    int64         `json:"min-row-id" help:"Minimum row ID to use in queries."`
+	MaxRowID    int64         `json:"max-row-id" help:"Max row ID to use in queries. If 0, determine max available."`
+	Index       string        `json:"index" help:"Index to use. If blank, one is chosen randomly from the schema."`
+	Concurrency int           `json:"concurrency" help:"Run this many goroutines concurrently." short:"y"`
+	Iterations  int           `json:"iterations" help:"Each goroutine will perform this many queries."`
+	Duration    time.Duration `json:"duration" help:"Run each goroutine for this long instead of a number of iterations." short:""`
+	Warmup      time.Duration `json:"warmup" help:"Run queries for this long before measuring any." short:""`
+	Rate        float64       `json:"rate" help:"If set, send this many queries per second, open-loop, with up to <concurrency> in flight, instead of each goroutine waiting for its last query." short:""`
+	Arrivals    string        `json:"arrivals" help:"Spacing of open-loop queries: uniform or poisson." short:""`
+	MaxLag      time.Duration `json:"max-lag" help:"Drop open-loop queries which can't be sent within this long of when they're due. If 0, none are dropped." short:""`
 
 	// Complexity int `help:"Number of Rows calls to include in each query."`
 	// Depth int `help:"Nesting depth of queries. (e.g. Xor(Row(blah=2), Intersect(Row(ha=3), Row(blah=4))))"`
@@ -39,6 +45,7 @@ func NewTPSBenchmark() *TPSBenchmark {
 		Concurrency: runtime.NumCPU(),
 		MaxRowID:    100,
 		Iterations:  1000,
+		Arrivals:    "uniform",
 		Logger:      log.New(os.Stderr, "", log.LstdFlags),
 	}
 }
@@ -50,52 +57,11 @@ func (b *TPSBenchmark) Run(ctx context.Context, client *pilosa.Client, agentNum
 	result.Configuration = b
 
 	// get the schema to validate existence of index/fields or pick ones to use.
-	s, err := client.Schema()
+	index, fields, err := schemaFields(client, b.Index, b.Fields, nil)
 	if err != nil {
-		return result, errors.Wrap(err, "getting schema")
-	}
-
-	// deal with indexes
-	indexes := s.Indexes()
-	var index *pilosa.Index
-	if b.Index == "" {
-		if len(indexes) == 0 {
-			return result, errors.New("no indexes in Pilosa, aborting.")
-		}
-		for name, idx := range indexes {
-			b.Index = name
-			index = idx
-			break
-		}
-	} else {
-		var ok bool
-		index, ok = indexes[b.Index]
-		if !ok {
-			return result, errors.Errorf("index '%s' not found in schema.", b.Index)
-		}
-	}
-
-	// we have an index, deal with fields
-	var fields []*pilosa.Field
-	fieldsMap := index.Fields()
-	if len(b.Fields) == 0 {
-		fields = make([]*pilosa.Field, 0, len(fieldsMap))
-		for _, fld := range fieldsMap {
-			fields = append(fields, fld)
-		}
-	} else {
-		fields = make([]*pilosa.Field, 0, len(b.Fields))
-		for _, name := range b.Fields {
-			fld, ok := fieldsMap[name]
-			if !ok {
-				return result, errors.Errorf("field '%s' not found in index '%s'.", name, index.Name())
-			}
-			fields = append(fields, fld)
-		}
-	}
-	if len(fields) == 0 {
-		return result, errors.Errorf("no fields to query in index '%s'", b.Index)
+		return result, err
 	}
+	b.Index = index.Name()
 
 	queries := make([]func(...*pilosa.PQLRowQuery) *pilosa.PQLRowQuery, 0)
 	if b.Intersect {
@@ -113,49 +79,122 @@ func (b *TPSBenchmark) Run(ctx context.Context, client *pilosa.Client, agentNum
 
 	// TODO: Figure out set of rows to use for each field. For now, just apply MaxRowID to all fields.
 
-	start := time.Now()
+	if b.Rate > 0 {
+		return b.runOpenLoop(ctx, client, index, fields, queries, agentNum, result)
+	}
+
 	eg := errgroup.Group{}
 	stats := make([]*NumStats, b.Concurrency)
+	times := make([]*Stats, b.Concurrency)
+	loops := make([]*Loop, b.Concurrency)
 	for i := 0; i < b.Concurrency; i++ {
 		i := i
 		stats[i] = NewNumStats()
+		times[i] = NewStats()
+		loops[i] = NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
 		eg.Go(func() error {
-			return b.runQueries(client, index, fields, queries, i, stats[i])
+			return b.runQueries(client, index, fields, queries, i, loops[i], stats[i], times[i])
 		})
 	}
+	// if a goroutine fails, or the run is canceled, report what was
+	// measured before it stopped, along with the error.
 	err = eg.Wait()
-	duration := time.Since(start)
-	if err == nil {
-		for i := 1; i < len(stats); i++ {
+
+	// the goroutines started together, so the slowest one's measured time
+	// is the time they all took.
+	var total int
+	var duration time.Duration
+	for i, loop := range loops {
+		if i > 0 {
 			stats[0].Combine(stats[i])
 		}
-		result.Extra["countstats"] = stats[0]
-		seconds := float64(duration) / 1000000000
-		result.Extra["tps"] = float64(b.Iterations*b.Concurrency) / seconds
+		result.Stats.Combine(times[i])
+		total += loop.N()
+		if d := loop.Elapsed(); d > duration {
+			duration = d
+		}
+	}
+	result.Extra["countstats"] = stats[0]
+	result.Extra["measured-iterations"] = stats[0].Num
+	result.Extra["measured-duration"] = PrettyDuration(duration)
+	if b.Warmup > 0 {
+		result.Extra["warmup-iterations"] = int64(total) - stats[0].Num
+	}
+	if duration > 0 {
+		result.Extra["tps"] = float64(stats[0].Num) / duration.Seconds()
 	}
 	return result, err
 }
 
-func (b *TPSBenchmark) runQueries(client *pilosa.Client, index *pilosa.Index, fields []*pilosa.Field, queries []func(...*pilosa.PQLRowQuery) *pilosa.PQLRowQuery, seed int, stats *NumStats) error {
+// runQueries runs queries until loop is done, adding their counts to
+// stats and their times to times.
+func (b *TPSBenchmark) runQueries(client *pilosa.Client, index *pilosa.Index, fields []*pilosa.Field, queries []func(...*pilosa.PQLRowQuery) *pilosa.PQLRowQuery, seed int, loop *Loop, stats *NumStats, times *Stats) error {
 	r := rand.New(rand.NewSource(int64(seed)))
-	for i := 0; i < b.Iterations; i++ {
-		f1 := fields[r.Intn(len(fields))]
-		f2 := fields[r.Intn(len(fields))]
-
-		r1 := r.Int63n(b.MaxRowID) + b.MinRowID
-		r2 := r.Int63n(b.MaxRowID) + b.MinRowID
-
-		q := queries[r.Intn(len(queries))]
-
-		cntq := index.Count(q(f1.Row(r1), f2.Row(r2)))
-		resp, err := client.Query(cntq)
+	for loop.Next() {
+		q := b.randomQuery(r, index, fields, queries)
+		start := time.Now()
+		count, err := b.query(client, q)
 		if err != nil {
-			return errors.Wrap(err, "performing query")
+			return err
 		}
-		if !resp.Success {
-			return errors.Errorf("unsuccessful query: %s", resp.ErrorMessage)
+		if loop.Measuring() {
+			times.Add(time.Since(start))
+			stats.Add(count)
 		}
-		stats.Add(int64(resp.Result().Count()))
 	}
-	return nil
+	return loop.Err()
+}
+
+// runOpenLoop sends queries at a fixed rate, rather than from each
+// goroutine in turn, with up to Concurrency of them in flight.
+func (b *TPSBenchmark) runOpenLoop(ctx context.Context, client *pilosa.Client, index *pilosa.Index, fields []*pilosa.Field, queries []func(...*pilosa.PQLRowQuery) *pilosa.PQLRowQuery, agentNum int, result *Result) (*Result, error) {
+	r := rand.New(rand.NewSource(int64(agentNum)))
+	var mu sync.Mutex
+	stats := NewNumStats()
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	open := &OpenLoop{Rate: b.Rate, Arrivals: b.Arrivals, Workers: b.Concurrency, MaxLag: b.MaxLag, Seed: int64(agentNum)}
+	err := open.Run(ctx, loop, result, func(n int) Op {
+		q := b.randomQuery(r, index, fields, queries)
+		measuring := loop.Measuring()
+		return func() (*pilosa.QueryResponse, error) {
+			count, err := b.query(client, q)
+			if err == nil && measuring {
+				mu.Lock()
+				stats.Add(count)
+				mu.Unlock()
+			}
+			return nil, err
+		}
+	})
+	result.Extra["countstats"] = stats
+	if rate, ok := result.Extra["achieved-rate"]; ok {
+		result.Extra["tps"] = rate
+	}
+	return result, err
+}
+
+// randomQuery returns a Count of one of the queries, of random rows from
+// two random fields.
+func (b *TPSBenchmark) randomQuery(r *rand.Rand, index *pilosa.Index, fields []*pilosa.Field, queries []func(...*pilosa.PQLRowQuery) *pilosa.PQLRowQuery) pilosa.PQLQuery {
+	f1 := fields[r.Intn(len(fields))]
+	f2 := fields[r.Intn(len(fields))]
+
+	r1 := r.Int63n(b.MaxRowID) + b.MinRowID
+	r2 := r.Int63n(b.MaxRowID) + b.MinRowID
+
+	q := queries[r.Intn(len(queries))]
+
+	return index.Count(q(f1.Row(r1), f2.Row(r2)))
+}
+
+// query runs a Count query, and returns the count.
+func (b *TPSBenchmark) query(client *pilosa.Client, q pilosa.PQLQuery) (int64, error) {
+	resp, err := client.Query(q)
+	if err != nil {
+		return 0, errors.Wrap(err, "performing query")
+	}
+	if !resp.Success {
+		return 0, errors.Errorf("unsuccessful query: %s", resp.ErrorMessage)
+	}
+	return int64(resp.Result().Count()), nil
 }
@@ -17,20 +17,22 @@ import (
 // This distribution accepts two parameters, Exponent and Ratio, for both rows and columns.
 // It also uses PermutationGenerator to permute IDs randomly.
 type ZipfBenchmark struct {
-	Name           string  `json:"name"`
-	MinRowID       int64   `json:"min-row-id"`
-	MinColumnID    int64   `json:"min-column-id"`
-	MaxRowID       int64   `json:"max-row-id"`
-	MaxColumnID    int64   `json:"max-column-id"`
-	Iterations     int     `json:"iterations"`
-	Seed           int64   `json:"seed"`
-	Index          string  `json:"index"`
-	Field          string  `json:"field"`
-	RowExponent    float64 `json:"row-exponent"`
-	RowRatio       float64 `json:"row-ratio"`
-	ColumnExponent float64 `json:"column-exponent"`
-	ColumnRatio    float64 `json:"column-ratio"`
-	Operation      string  `json:"operation"`
+	Name           string        `json:"name"`
+	MinRowID       int64         `json:"min-row-id"`
+	MinColumnID    int64         `json:"min-column-id"`
+	MaxRowID       int64         `json:"max-row-id"`
+	MaxColumnID    int64         `json:"max-column-id"`
+	Iterations     int           `json:"iterations"`
+	Duration       time.Duration `json:"duration"`
+	Warmup         time.Duration `json:"warmup"`
+	Seed           int64         `json:"seed"`
+	Index          string        `json:"index"`
+	Field          string        `json:"field"`
+	RowExponent    float64       `json:"row-exponent"`
+	RowRatio       float64       `json:"row-ratio"`
+	ColumnExponent float64       `json:"column-exponent"`
+	ColumnRatio    float64       `json:"column-ratio"`
+	Operation      string        `json:"operation"`
 
 	Logger *log.Logger `json:"-"`
 }
@@ -71,7 +73,8 @@ func (b *ZipfBenchmark) Run(ctx context.Context, client *pilosa.Client, agentNum
 		return result, err
 	}
 
-	for n := 0; n < b.Iterations; n++ {
+	loop := NewLoop(ctx, b.Iterations, b.Duration, b.Warmup)
+	for loop.Next() {
 		// generate IDs from Zipf distribution
 		rowIDOriginal := rowRand.Uint64()
 		profIDOriginal := columnRand.Uint64()
@@ -92,12 +95,12 @@ func (b *ZipfBenchmark) Run(ctx context.Context, client *pilosa.Client, agentNum
 
 		start := time.Now()
 		_, err := client.Query(q)
-		result.Add(time.Since(start), nil)
+		loop.Add(result, time.Since(start), nil)
 		if err != nil {
 			return result, err
 		}
 	}
-	return result, err
+	return result, loop.Finish(result)
 }
 
 // Offset is the true parameter used by the Zipf distribution, but the ratio,
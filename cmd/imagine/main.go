@@ -1,6 +1,9 @@
 package main
 
 import (
+	// the imagine command serves profiles on its debug server.
+	_ "net/http/pprof"
+
 	"github.com/pilosa/tools/imagine"
 )
 
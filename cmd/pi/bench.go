@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"os"
+	"os/signal"
 
 	"github.com/pilosa/tools/bench"
 	"github.com/spf13/cobra"
@@ -36,6 +39,7 @@ agent numbers will do interesting work.
 
 	benchCmd.AddCommand(NewBasicQueryCommand())
 	benchCmd.AddCommand(NewDiagonalSetBitsCommand())
+	benchCmd.AddCommand(NewGroupByCommand())
 	benchCmd.AddCommand(NewImportCommand())
 	benchCmd.AddCommand(NewImportRangeCommand())
 	benchCmd.AddCommand(NewQueryCommand())
@@ -67,3 +71,21 @@ func PrintResults(cmd *cobra.Command, result *bench.Result, out io.Writer) error
 	}
 	return nil
 }
+
+// interruptContext returns a context which is canceled when pi is
+// interrupted, so a benchmark can stop and report what it's done so far,
+// and a function which releases it.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(interrupts)
+	}()
+	return ctx, cancel
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"os"
 
 	"github.com/pilosa/tools/bench"
@@ -29,7 +28,9 @@ overlap at all.`,
 			if err != nil {
 				return err
 			}
-			result, err := b.Run(context.Background(), client, agentNum)
+			ctx, cancel := interruptContext()
+			defer cancel()
+			result, err := b.Run(ctx, client, agentNum)
 			if err != nil {
 				result.Error = err.Error()
 			}
@@ -41,6 +42,8 @@ overlap at all.`,
 	flags.IntVar(&b.MinRowID, "min-row-id", 0, "Rows being set will all be greater than this.")
 	flags.IntVar(&b.MinColumnID, "min-column-id", 0, "Columns being set will all be greater than this.")
 	flags.IntVar(&b.Iterations, "iterations", 100, "Number of bits to set.")
+	flags.DurationVar(&b.Duration, "duration", 0, "Run for this long, instead of a number of iterations.")
+	flags.DurationVar(&b.Warmup, "warmup", 0, "Run for this long first, without measuring.")
 	flags.StringVar(&b.Index, "index", defaultIndex, "Pilosa index in which to set bits.")
 	flags.StringVar(&b.Field, "field", defaultField, "Pilosa field in which to set bits.")
 
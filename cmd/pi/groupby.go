@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jaffee/commandeer/cobrafy"
+	"github.com/pilosa/tools/bench"
+	"github.com/spf13/cobra"
+)
+
+// NewGroupByCommand subcommands
+func NewGroupByCommand() *cobra.Command {
+	b := bench.NewGroupByBenchmark()
+	com, err := cobrafy.Command(b)
+	if err != nil {
+		panic(err)
+	}
+	com.Use = b.Name
+	com.Short = "Run GroupBy and Rows query benchmark."
+	com.Long = `Run GroupBy and Rows query benchmark.
+
+This benchmark runs GroupBy queries, each grouping by the Rows of
+<num-fields> different fields chosen at random. With --filters, each
+query is filtered by the Intersect of that many random rows, and with
+--limit, it returns at most that many groups. With --query=rows, it
+runs Rows queries of a single random field instead, which --filters
+and --limit don't apply to. Distinct queries aren't covered, as
+neither the client nor the server this is built against has them.
+
+Each field's Rows can be limited with --rows-limit, and, with
+--previous, start after a random row, as when paging through results.
+Row IDs for filters, and previous rows, are chosen randomly between
+min and max.
+
+As with the tps benchmark, you must already have an index in Pilosa
+with some data in it. If no index is given, one is chosen at random,
+and if no fields are given, all the set, mutex, time and bool fields
+in the index are used; other fields can't be given. Along with the
+latencies, the number of groups (or rows) each query returned is
+reported in "groupstats".
+
+`
+
+	com.RunE = func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		b.Logger = NewLoggerFromFlags(flags)
+		client, err := NewClientFromFlags(flags)
+		if err != nil {
+			return err
+		}
+		agentNum, err := flags.GetInt("agent-num")
+		if err != nil {
+			return err
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		result, err := b.Run(ctx, client, agentNum)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		return PrintResults(cmd, result, os.Stdout)
+	}
+	return com
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"os"
 
 	"github.com/pilosa/tools/bench"
@@ -13,7 +12,7 @@ func NewImportRangeCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "import-range",
 		Short: "Import random field data into Pilosa.",
-		Long:  `import-range generates random data which can be controlled by command line flags and streams it into Pilosa's /import endpoint. Agent num has no effect`,
+		Long:  `import-range generates random data which can be controlled by command line flags and streams it into Pilosa's /import endpoint. Agent num has no effect. It imports a fixed number of values, spread across the given range, so it doesn't take --duration or --warmup.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			flags := cmd.Flags()
 			b.Logger = NewLoggerFromFlags(flags)
@@ -25,7 +24,9 @@ func NewImportRangeCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			result, err := b.Run(context.Background(), client, agentNum)
+			ctx, cancel := interruptContext()
+			defer cancel()
+			result, err := b.Run(ctx, client, agentNum)
 			if err != nil {
 				result.Error = err.Error()
 			}
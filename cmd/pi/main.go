@@ -62,6 +62,7 @@ Build Time: ` + tools.BuildTime + "\n",
 
 	rc.AddCommand(NewBenchCommand())
 	rc.AddCommand(NewReplayCommand())
+	rc.AddCommand(NewSpawnCommand())
 
 	rc.SetOutput(os.Stderr)
 	return rc
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"os"
 
 	"github.com/pilosa/tools/bench"
@@ -32,7 +31,9 @@ modifies random seed.`,
 			if err != nil {
 				return err
 			}
-			result, err := b.Run(context.Background(), client, agentNum)
+			ctx, cancel := interruptContext()
+			defer cancel()
+			result, err := b.Run(ctx, client, agentNum)
 			if err != nil {
 				result.Error = err.Error()
 			}
@@ -47,6 +48,8 @@ modifies random seed.`,
 	flags.Int64Var(&b.MaxColumnID, "max-column-id", 100000, "Maximum column id for set.")
 	flags.Int64Var(&b.Seed, "seed", 1, "Random seed.")
 	flags.IntVar(&b.Iterations, "iterations", 100, "Number of values to set.")
+	flags.DurationVar(&b.Duration, "duration", 0, "Run for this long, instead of a number of iterations.")
+	flags.DurationVar(&b.Warmup, "warmup", 0, "Run for this long first, without measuring.")
 	flags.IntVar(&b.BatchSize, "batch-size", 1, "Number of values to set per batch.")
 	flags.IntVar(&b.NumAttrs, "num-attrs", 0, "If > 0, alternate set with setrowattrs - this number of different attributes")
 	flags.IntVar(&b.NumAttrValues, "num-attr-values", 0, "If > 0, alternate set with setrowattrs - this number of different attribute values")
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"os"
 
 	"github.com/pilosa/tools/bench"
@@ -26,7 +25,9 @@ Agent num modifies random seed.`,
 			if err != nil {
 				return err
 			}
-			result, err := b.Run(context.Background(), client, agentNum)
+			ctx, cancel := interruptContext()
+			defer cancel()
+			result, err := b.Run(ctx, client, agentNum)
 			if err != nil {
 				result.Error = err.Error()
 			}
@@ -41,6 +42,12 @@ Agent num modifies random seed.`,
 	flags.Int64Var(&b.MaxRange, "max-range", 100, "Maximum range to include in queries.")
 	flags.Int64Var(&b.Seed, "seed", 1, "random seed")
 	flags.IntVar(&b.Iterations, "iterations", 100, "Number queries to perform.")
+	flags.DurationVar(&b.Duration, "duration", 0, "Run for this long, instead of a number of iterations.")
+	flags.DurationVar(&b.Warmup, "warmup", 0, "Run for this long first, without measuring.")
+	flags.Float64Var(&b.Rate, "rate", 0, "If set, send this many queries per second, open-loop, instead of waiting for each query before sending the next.")
+	flags.StringVar(&b.Arrivals, "arrivals", "uniform", "Spacing of open-loop queries: uniform or poisson.")
+	flags.IntVar(&b.Workers, "workers", 16, "Most open-loop queries in flight at once.")
+	flags.DurationVar(&b.MaxLag, "max-lag", 0, "Drop open-loop queries which can't be sent within this long of when they're due. If 0, none are dropped.")
 	flags.StringVar(&b.Field, "field", defaultField, "Field to query.")
 	flags.StringVar(&b.Index, "index", defaultIndex, "Pilosa index to use.")
 	flags.StringVar(&b.QueryType, "type", "sum", "Query type for range, default to sum")
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pilosa/tools/bench"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewSpawnCommand() *cobra.Command {
+	var (
+		hosts     []string
+		transport string
+		sshHosts  []string
+		command   string
+		output    string
+		human     bool
+	)
+	cmd := &cobra.Command{
+		Use:   "spawn <plan>",
+		Short: "Run a plan of benchmarks across multiple agents.",
+		Long: `Run a plan of benchmarks across multiple agents.
+
+The plan is a TOML file listing stages, which run one after another. Each
+stage lists benchmarks, which all run at once, each with its config and
+number of agents. Every agent runs "pi bench <benchmark>" with its config
+as flags and its own --agent-num, counting from 0 for each benchmark, so
+the agents do different work.
+
+Agents run as local subprocesses, or, with --transport=ssh, on the
+--ssh-hosts in turn. Once the plan is done, or a stage has a failed agent,
+the results of every agent, and each benchmark's combined stats, are
+written as JSON.
+
+Example plan:
+
+    hosts = ["localhost:10101"]
+
+    [[stages]]
+    name = "load"
+    [[stages.benchmarks]]
+    name = "import"
+    agents = 4
+    config = { iterations = 100000, max-row-id = 1000 }
+
+    [[stages]]
+    name = "query"
+    agents = 8
+    [[stages.benchmarks]]
+    name = "random-query"
+    config = { iterations = 1000 }
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := bench.ReadPlan(args[0])
+			if err != nil {
+				return err
+			}
+			if len(hosts) > 0 {
+				plan.Hosts = hosts
+			}
+			var t bench.Transport
+			switch transport {
+			case "local":
+				self, err := os.Executable()
+				if err != nil {
+					return errors.Wrap(err, "finding pi executable")
+				}
+				t = &bench.LocalTransport{Command: []string{self}}
+			case "ssh":
+				if len(sshHosts) == 0 {
+					return errors.New("ssh transport needs --ssh-hosts")
+				}
+				t = &bench.SSHTransport{Hosts: sshHosts, Command: command}
+			default:
+				return fmt.Errorf("unknown transport '%s'", transport)
+			}
+
+			// interrupting stops the agents, and reports what they'd done.
+			ctx, cancel := interruptContext()
+			defer cancel()
+
+			report, runErr := bench.RunPlan(ctx, plan, t)
+			out := io.Writer(os.Stdout)
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return errors.Wrap(err, "creating output file")
+				}
+				defer f.Close()
+				out = f
+			}
+			enc := json.NewEncoder(out)
+			if human {
+				enc.SetIndent("", "  ")
+			}
+			if err := enc.Encode(report); err != nil {
+				return errors.Wrap(err, "writing report")
+			}
+			return runErr
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVar(&hosts, "hosts", nil, "Comma separated list of \"host:port\" pairs of the Pilosa cluster, overriding the plan's.")
+	flags.StringVar(&transport, "transport", "local", "How to run agents: local (subprocesses) or ssh.")
+	flags.StringSliceVar(&sshHosts, "ssh-hosts", nil, "Hosts to run agents on with the ssh transport.")
+	flags.StringVar(&command, "agent-command", "pi", "Command which runs pi on the ssh hosts.")
+	flags.StringVarP(&output, "output", "o", "", "File to write the combined report to, instead of stdout.")
+	flags.BoolVar(&human, "human", true, "Make output human friendly.")
+	return cmd
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"os"
 
 	"github.com/jaffee/commandeer/cobrafy"
@@ -25,6 +24,16 @@ Pilosa <iterations> times serially. The idea is to get an
 understanding of what kind of query throughput various Pilosa
 configurations can handle.
 
+With --duration, each goroutine queries for that long instead, and with
+--warmup, queries are run for that long before any are measured, so
+that caches are warm.
+
+With --rate, queries are sent open-loop instead: at that many per
+second, whether or not earlier ones have finished, with up to
+<concurrency> in flight. Latency is then measured from when each query
+was due, so server stalls aren't hidden by fewer queries being sent,
+and queries which are sent late, or dropped, are counted.
+
 For this to be useful, you must already have an index in Pilosa with
 at least 1 field which has some data in it. I recommend the "imagine"
 tool (in this repository) for generating fake data with semi-realistic
@@ -53,7 +62,9 @@ given, all the fields in the index are used.
 		if err != nil {
 			return err
 		}
-		result, err := b.Run(context.Background(), client, agentNum)
+		ctx, cancel := interruptContext()
+		defer cancel()
+		result, err := b.Run(ctx, client, agentNum)
 		if err != nil {
 			result.Error = err.Error()
 		}
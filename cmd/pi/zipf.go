@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"os"
 
 	"github.com/pilosa/tools/bench"
@@ -32,7 +31,9 @@ maximum variation of the distribution, with higher ratio being more uniform.
 			if err != nil {
 				return err
 			}
-			result, err := b.Run(context.Background(), client, agentNum)
+			ctx, cancel := interruptContext()
+			defer cancel()
+			result, err := b.Run(ctx, client, agentNum)
 			if err != nil {
 				result.Error = err.Error()
 			}
@@ -46,6 +47,8 @@ maximum variation of the distribution, with higher ratio being more uniform.
 	flags.Int64Var(&b.MinColumnID, "min-column-id", 0, "Column id to start from.")
 	flags.Int64Var(&b.MaxColumnID, "max-column-id", 100000, "Maximum column id for set bits.")
 	flags.IntVar(&b.Iterations, "iterations", 100, "Number of bits to set.")
+	flags.DurationVar(&b.Duration, "duration", 0, "Run for this long, instead of a number of iterations.")
+	flags.DurationVar(&b.Warmup, "warmup", 0, "Run for this long first, without measuring.")
 	flags.Int64Var(&b.Seed, "seed", 1, "Seed for RNG.")
 	flags.StringVar(&b.Field, "field", "fbench", "Pilosa field in which to set bits.")
 	flags.StringVar(&b.Index, "index", "ibench", "Pilosa index to use.")
@@ -1,6 +1,7 @@
 package dx
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,7 +10,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
-	"time"
 
 	"github.com/pilosa/tools/imagine"
 	"github.com/pkg/errors"
@@ -102,27 +102,18 @@ func ingestOnInstance(conf *imagine.Config) (*Benchmark, error) {
 	bench.Type = cmdIngest
 	bench.ThreadCount = conf.ThreadCount
 
-	err := conf.ReadSpecs()
-	if err != nil {
-		return nil, errors.Wrap(err, "error reading spec from config")
-	}
-
 	client, err := initializeClient(conf.Hosts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating Pilosa client")
 	}
 
-	if err = conf.UpdateIndexes(client); err != nil {
-		return nil, errors.Wrap(err, "error updating indexes")
-	}
-
-	now := time.Now()
-	err = conf.ApplyWorkloads(client)
+	result, err := conf.Apply(context.Background(), client)
 	if err != nil {
 		return nil, errors.Wrap(err, "error applying workloads")
 	}
 
-	bench.Time.Duration = time.Since(now)
+	bench.Time.Duration = result.End.Sub(result.Start)
+	bench.Tasks = result.Tasks
 	return bench, nil
 }
 
@@ -141,11 +132,10 @@ func writeResultFile(bench *Benchmark, filename, dir string) error {
 }
 
 func newConfig(hosts []string, specFiles []string, prefix string, threadCount int) *imagine.Config {
-	conf := &imagine.Config{
-		Hosts:       hosts,
-		Prefix:      prefix,
-		ThreadCount: threadCount,
-	}
+	conf := imagine.NewConfig()
+	conf.Hosts = hosts
+	conf.Prefix = prefix
+	conf.ThreadCount = threadCount
 	conf.NewSpecsFiles(specFiles)
 
 	return conf
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/pilosa/go-pilosa"
+	"github.com/pilosa/tools/imagine"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -211,10 +212,11 @@ func (d *TimeDuration) MarshalJSON() (b []byte, err error) {
 
 // Benchmark contains the information related to an ingest or query benchmark.
 type Benchmark struct {
-	Type        string       `json:"type"`
-	Time        TimeDuration `json:"time"`
-	ThreadCount int          `json:"threadcount"`
-	Query       *Query       `json:"query,omitempty"`
+	Type        string               `json:"type"`
+	Time        TimeDuration         `json:"time"`
+	ThreadCount int                  `json:"threadcount"`
+	Query       *Query               `json:"query,omitempty"`
+	Tasks       []imagine.TaskResult `json:"tasks,omitempty"`
 }
 
 // NewBenchmark creates an empty benchmark of type cmdType.
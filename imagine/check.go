@@ -0,0 +1,406 @@
+package imagine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// maxReported is the number of individual mismatched columns to list for
+// a given row or value, to avoid flooding the output.
+const maxReported = 8
+
+// fieldCheck accumulates the expected contents of a sample of a field,
+// and compares them with what the server has.
+type fieldCheck struct {
+	field       *fieldSpec
+	dbField     *pilosa.Field
+	name        string
+	shardWidth  uint64
+	shardStride uint64
+	keyed       bool
+	// where mismatches are reported.
+	out io.Writer
+	// for keyed indexes, the column IDs corresponding to column keys
+	// we've generated in the sample.
+	columnIDs map[string]uint64
+	// set/time fields: row -> columns
+	rows map[uint64]map[uint64]struct{}
+	// mutex/int fields: column -> value
+	values map[uint64]int64
+	// number of mismatches found
+	mismatches int
+}
+
+func newFieldCheck(fs *fieldSpec, dbField *pilosa.Field, shards int) *fieldCheck {
+	fc := &fieldCheck{
+		field:      fs,
+		dbField:    dbField,
+		name:       fmt.Sprintf("%s/%s", fs.Parent.Name, fs.Name),
+		keyed:      fs.Parent.Keys,
+		shardWidth: fs.Parent.shardWidth(),
+	}
+	// sample every Nth shard, so we get about the requested number of
+	// shards from the index's nominal size, and a proportional number
+	// of any shards beyond it created by appends.
+	totalShards := (fs.Parent.Columns + fc.shardWidth - 1) / fc.shardWidth
+	fc.shardStride = 1
+	if shards > 0 && totalShards > uint64(shards) {
+		fc.shardStride = totalShards / uint64(shards)
+	}
+	if fc.keyed {
+		fc.columnIDs = make(map[string]uint64)
+	}
+	switch fs.Type {
+	case fieldTypeSet, fieldTypeTime:
+		fc.rows = make(map[uint64]map[uint64]struct{})
+	default:
+		fc.values = make(map[uint64]int64)
+	}
+	return fc
+}
+
+// sampled indicates whether a column is in one of the sampled shards.
+func (fc *fieldCheck) sampled(col uint64) bool {
+	return (col/fc.shardWidth)%fc.shardStride == 0
+}
+
+// shards lists the sampled shards up to the highest column generated.
+func (fc *fieldCheck) shards() []uint64 {
+	highest := uint64(0)
+	if fc.field.HighestColumn > 0 {
+		highest = uint64(fc.field.HighestColumn)
+	}
+	shards := make([]uint64, 0)
+	for shard := uint64(0); shard <= highest/fc.shardWidth; shard += fc.shardStride {
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+// add records a generated value, which a clear operation removes.
+func (fc *fieldCheck) add(rec pilosa.Record, op taskOperation) {
+	switch r := rec.(type) {
+	case pilosa.Column:
+		if !fc.sampled(r.ColumnID) {
+			return
+		}
+		if fc.keyed {
+			fc.columnIDs[r.ColumnKey] = r.ColumnID
+		}
+		if fc.rows != nil {
+			if op == taskOperationClear {
+				delete(fc.rows[r.RowID], r.ColumnID)
+				return
+			}
+			if fc.rows[r.RowID] == nil {
+				fc.rows[r.RowID] = make(map[uint64]struct{})
+			}
+			fc.rows[r.RowID][r.ColumnID] = struct{}{}
+		} else {
+			fc.setValue(r.ColumnID, int64(r.RowID), op)
+		}
+	case pilosa.FieldValue:
+		if !fc.sampled(r.ColumnID) {
+			return
+		}
+		if fc.keyed {
+			fc.columnIDs[r.ColumnKey] = r.ColumnID
+		}
+		fc.setValue(r.ColumnID, r.Value, op)
+	}
+}
+
+// setValue records a column's value for a mutex or int field. Clearing
+// only affects a column which still has the cleared value.
+func (fc *fieldCheck) setValue(col uint64, val int64, op taskOperation) {
+	if op != taskOperationClear {
+		fc.values[col] = val
+		return
+	}
+	if prev, ok := fc.values[col]; ok && prev == val {
+		delete(fc.values, col)
+	}
+}
+
+// query runs a query against the sampled shards, returning the sampled
+// columns of the resulting row.
+func (fc *fieldCheck) query(client *pilosa.Client, q pilosa.PQLQuery) (map[uint64]struct{}, error) {
+	var opts []interface{}
+	// With keys, the server's column IDs have nothing to do with ours,
+	// so we can't restrict the query to shards.
+	if !fc.keyed {
+		opts = append(opts, pilosa.OptQueryShards(fc.shards()...))
+	}
+	resp, err := client.Query(q, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, errors.New(resp.ErrorMessage)
+	}
+	row := resp.Result().Row()
+	cols := make(map[uint64]struct{}, len(row.Columns)+len(row.Keys))
+	for _, col := range row.Columns {
+		if fc.sampled(col) {
+			cols[col] = struct{}{}
+		}
+	}
+	for _, key := range row.Keys {
+		// keys we didn't generate aren't in the sample.
+		if col, ok := fc.columnIDs[key]; ok {
+			cols[col] = struct{}{}
+		}
+	}
+	return cols, nil
+}
+
+// compare reports differences between expected and actual columns for
+// a given row (or value).
+func (fc *fieldCheck) compare(what string, expected, actual map[uint64]struct{}) {
+	missing := make([]uint64, 0)
+	extra := make([]uint64, 0)
+	for col := range expected {
+		if _, ok := actual[col]; !ok {
+			missing = append(missing, col)
+		}
+	}
+	for col := range actual {
+		if _, ok := expected[col]; !ok {
+			extra = append(extra, col)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return
+	}
+	fc.mismatches++
+	fmt.Fprintf(fc.out, "  %s %s: %d columns expected, %d found", fc.name, what, len(expected), len(actual))
+	if len(missing) > 0 {
+		fmt.Fprintf(fc.out, ", missing %d %s", len(missing), sampleColumns(missing))
+	}
+	if len(extra) > 0 {
+		fmt.Fprintf(fc.out, ", unexpected %d %s", len(extra), sampleColumns(extra))
+	}
+	fmt.Fprintf(fc.out, "\n")
+}
+
+// sampleColumns formats the first few of a list of columns.
+func sampleColumns(cols []uint64) string {
+	sort.Slice(cols, func(i, j int) bool { return cols[i] < cols[j] })
+	if len(cols) > maxReported {
+		return fmt.Sprintf("%v...", cols[:maxReported])
+	}
+	return fmt.Sprintf("%v", cols)
+}
+
+// pickEvenly picks up to n values from a sorted list, spaced evenly.
+func pickEvenly(values []int64, n int) []int64 {
+	if n <= 0 || len(values) <= n {
+		return values
+	}
+	picked := make([]int64, n)
+	for i := range picked {
+		picked[i] = values[i*len(values)/n]
+	}
+	return picked
+}
+
+// checkRows compares rows of a set, time, mutex, or bool field.
+func (fc *fieldCheck) checkRows(client *pilosa.Client, rows int) (int, error) {
+	fs := fc.field
+	expected := fc.rows
+	if expected == nil {
+		// mutex: invert the column->row map.
+		expected = make(map[uint64]map[uint64]struct{})
+		for col, row := range fc.values {
+			if expected[uint64(row)] == nil {
+				expected[uint64(row)] = make(map[uint64]struct{})
+			}
+			expected[uint64(row)][col] = struct{}{}
+		}
+	}
+	// pick rows evenly across the field's range, not just the ones we
+	// expect to have bits, so we notice bits in rows that should be empty.
+	picked := make([]int64, 0, rows)
+	span := fs.Max - fs.Min
+	if span <= int64(rows) {
+		for row := fs.Min; row < fs.Max; row++ {
+			picked = append(picked, row)
+		}
+	} else {
+		for i := int64(0); i < int64(rows); i++ {
+			picked = append(picked, fs.Min+i*span/int64(rows))
+		}
+	}
+	var rowKeys *keyGenerator
+	var err error
+	if fs.Keys {
+		rowKeys, err = newRowKeyGenerator(fs)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, row := range picked {
+		var q *pilosa.PQLRowQuery
+		if rowKeys != nil {
+			q = fc.dbField.Row(rowKeys.Key(row))
+		} else if fs.Type == fieldTypeBool {
+			// bool rows are queried as false and true.
+			q = fc.dbField.Row(row == 1)
+		} else {
+			q = fc.dbField.Row(uint64(row))
+		}
+		actual, err := fc.query(client, q)
+		if err != nil {
+			return 0, errors.Wrapf(err, "querying %s row %d", fc.name, row)
+		}
+		fc.compare(fmt.Sprintf("row %d", row), expected[uint64(row)], actual)
+	}
+	return len(picked), nil
+}
+
+// checkValues compares the values of an int, decimal, or timestamp field.
+func (fc *fieldCheck) checkValues(client *pilosa.Client, values int) (int, error) {
+	exists := make(map[uint64]struct{}, len(fc.values))
+	byValue := make(map[int64]map[uint64]struct{})
+	var sum int64
+	for col, val := range fc.values {
+		exists[col] = struct{}{}
+		if byValue[val] == nil {
+			byValue[val] = make(map[uint64]struct{})
+		}
+		byValue[val][col] = struct{}{}
+		sum += val
+	}
+	actual, err := fc.query(client, fc.dbField.NotNull())
+	if err != nil {
+		return 0, errors.Wrapf(err, "querying %s existence", fc.name)
+	}
+	fc.compare("not-null", exists, actual)
+	// Sum can only be limited to our sample by shards.
+	if !fc.keyed {
+		resp, err := client.Query(fc.dbField.Sum(nil), pilosa.OptQueryShards(fc.shards()...))
+		if err != nil {
+			return 0, errors.Wrapf(err, "querying %s sum", fc.name)
+		}
+		if !resp.Success {
+			return 0, errors.Errorf("querying %s sum: %s", fc.name, resp.ErrorMessage)
+		}
+		vc := resp.Result()
+		if vc.Value() != sum || vc.Count() != int64(len(fc.values)) {
+			fc.mismatches++
+			fmt.Fprintf(fc.out, "  %s sum: expected %d over %d columns, found %d over %d columns\n",
+				fc.name, sum, len(fc.values), vc.Value(), vc.Count())
+		}
+	}
+	distinct := make([]int64, 0, len(byValue))
+	for val := range byValue {
+		distinct = append(distinct, val)
+	}
+	sort.Slice(distinct, func(i, j int) bool { return distinct[i] < distinct[j] })
+	picked := pickEvenly(distinct, values)
+	for _, val := range picked {
+		actual, err := fc.query(client, fc.dbField.Equals(int(val)))
+		if err != nil {
+			return 0, errors.Wrapf(err, "querying %s value %d", fc.name, val)
+		}
+		fc.compare(fmt.Sprintf("value %d", val), byValue[val], actual)
+	}
+	return len(picked), nil
+}
+
+// CheckWorkloads regenerates the data every workload would produce,
+// without importing it, and compares a sample of it with the data
+// in the server. Set, mutex, and time fields are compared row by row;
+// int fields are compared by existence, sum, and specific values.
+func (conf *Config) CheckWorkloads(client *pilosa.Client) error {
+	if conf.dbSchema == nil {
+		if err := conf.loadDBSchema(client); err != nil {
+			return err
+		}
+	}
+	// generators which append track the highest column seen in the field
+	// spec, so we need to start from scratch to generate the same columns.
+	for _, index := range conf.indexes {
+		for _, fs := range index.FieldsByName {
+			for ; fs != nil; fs = fs.Next {
+				fs.HighestColumn = 0
+			}
+		}
+	}
+	checks := make(map[string]*fieldCheck)
+	names := make([]string, 0)
+	for _, nwl := range conf.workloads {
+		for _, wl := range nwl.Workloads {
+			// Tasks are run in order, so later writes to mutex or int
+			// values win. This matches imports unless tasks in the same
+			// workload, or window, overlap.
+			err := wl.eachWindow(func(_ int, tasks []*taskSpec) error {
+				for _, task := range tasks {
+					if err := conf.canceled(); err != nil {
+						return err
+					}
+					name := fmt.Sprintf("%s/%s", task.Index, task.Field)
+					fc := checks[name]
+					if fc == nil {
+						dbField := conf.dbSchema[task.IndexFullName][task.Field]
+						if dbField == nil {
+							return fmt.Errorf("index '%s', field '%s' not found in schema", task.IndexFullName, task.Field)
+						}
+						fc = newFieldCheck(task.FieldSpec, dbField, conf.CheckShards)
+						fc.out = conf.output()
+						checks[name] = fc
+						names = append(names, name)
+					}
+					itr, _, err := NewGenerator(task, nil, name)
+					if err != nil {
+						return err
+					}
+					for {
+						rec, err := itr.NextRecord()
+						if err == io.EOF {
+							break
+						}
+						if err != nil {
+							return errors.Wrapf(err, "generating %s", name)
+						}
+						fc.add(rec, task.Operation)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	sort.Strings(names)
+	failed := 0
+	for _, name := range names {
+		if err := conf.canceled(); err != nil {
+			return err
+		}
+		fc := checks[name]
+		var checked int
+		var err error
+		if fc.field.Type.intBacked() {
+			checked, err = fc.checkValues(client, conf.CheckRows)
+		} else {
+			checked, err = fc.checkRows(client, conf.CheckRows)
+		}
+		if err != nil {
+			return err
+		}
+		if fc.mismatches > 0 {
+			failed++
+		}
+		conf.printf("  %s: checked %d rows/values in %d shards, %d mismatches\n", name, checked, len(fc.shards()), fc.mismatches)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fields did not match", failed, len(names))
+	}
+	return nil
+}
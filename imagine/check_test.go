@@ -0,0 +1,135 @@
+package imagine
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestFieldCheckAdd(t *testing.T) {
+	set, clear := taskOperationSet, taskOperationClear
+	// with a shard width of 16 and 4 shards sampled out of 8, columns
+	// 16-31 and 48-63 aren't sampled.
+	index := &indexSpec{Name: "i", Columns: 128, ShardWidth: 16}
+	for _, c := range []struct {
+		name   string
+		typ    fieldType
+		recs   []gopilosa.Record
+		ops    []taskOperation
+		rows   map[uint64][]uint64
+		values map[uint64]int64
+	}{
+		{
+			name: "set",
+			typ:  fieldTypeSet,
+			recs: []gopilosa.Record{gopilosa.Column{RowID: 1, ColumnID: 3}, gopilosa.Column{RowID: 1, ColumnID: 20}, gopilosa.Column{RowID: 2, ColumnID: 35}},
+			ops:  []taskOperation{set, set, set},
+			rows: map[uint64][]uint64{1: {3}, 2: {35}},
+		},
+		{
+			name: "set-clear",
+			typ:  fieldTypeSet,
+			recs: []gopilosa.Record{gopilosa.Column{RowID: 1, ColumnID: 3}, gopilosa.Column{RowID: 1, ColumnID: 4}, gopilosa.Column{RowID: 1, ColumnID: 3}, gopilosa.Column{RowID: 2, ColumnID: 4}},
+			ops:  []taskOperation{set, set, clear, clear},
+			rows: map[uint64][]uint64{1: {4}},
+		},
+		{
+			name:   "mutex",
+			typ:    fieldTypeMutex,
+			recs:   []gopilosa.Record{gopilosa.Column{RowID: 1, ColumnID: 3}, gopilosa.Column{RowID: 2, ColumnID: 3}, gopilosa.Column{RowID: 1, ColumnID: 50}},
+			ops:    []taskOperation{set, set, set},
+			values: map[uint64]int64{3: 2},
+		},
+		{
+			name:   "mutex-clear",
+			typ:    fieldTypeMutex,
+			recs:   []gopilosa.Record{gopilosa.Column{RowID: 1, ColumnID: 3}, gopilosa.Column{RowID: 1, ColumnID: 4}, gopilosa.Column{RowID: 2, ColumnID: 3}, gopilosa.Column{RowID: 1, ColumnID: 4}},
+			ops:    []taskOperation{set, set, clear, clear},
+			values: map[uint64]int64{3: 1},
+		},
+		{
+			name:   "int",
+			typ:    fieldTypeInt,
+			recs:   []gopilosa.Record{gopilosa.FieldValue{ColumnID: 3, Value: -5}, gopilosa.FieldValue{ColumnID: 60, Value: 7}, gopilosa.FieldValue{ColumnID: 70, Value: 9}, gopilosa.FieldValue{ColumnID: 70, Value: 9}},
+			ops:    []taskOperation{set, set, set, clear},
+			values: map[uint64]int64{3: -5},
+		},
+	} {
+		fc := newFieldCheck(&fieldSpec{Parent: index, Name: "f", Type: c.typ}, nil, 4)
+		for i, rec := range c.recs {
+			fc.add(rec, c.ops[i])
+		}
+		rows := make(map[uint64][]uint64)
+		for row, cols := range fc.rows {
+			for col := range cols {
+				rows[row] = append(rows[row], col)
+			}
+		}
+		for _, cols := range rows {
+			sort.Slice(cols, func(i, j int) bool { return cols[i] < cols[j] })
+		}
+		if fmt.Sprint(rows) != fmt.Sprint(c.rows) {
+			t.Errorf("%s: expected rows %v, got %v", c.name, c.rows, rows)
+		}
+		if fmt.Sprint(fc.values) != fmt.Sprint(c.values) {
+			t.Errorf("%s: expected values %v, got %v", c.name, c.values, fc.values)
+		}
+	}
+}
+
+func TestFieldCheckShards(t *testing.T) {
+	for _, c := range []struct {
+		columns, shardWidth uint64
+		shards              int
+		highest             int64
+		expected            []uint64
+	}{
+		{columns: 100, shardWidth: 0, shards: 4, highest: 99, expected: []uint64{0}},
+		{columns: 128, shardWidth: 16, shards: 0, highest: 127, expected: []uint64{0, 1, 2, 3, 4, 5, 6, 7}},
+		{columns: 128, shardWidth: 16, shards: 4, highest: 127, expected: []uint64{0, 2, 4, 6}},
+		{columns: 128, shardWidth: 16, shards: 3, highest: 127, expected: []uint64{0, 2, 4, 6}},
+		{columns: 128, shardWidth: 16, shards: 4, highest: 40, expected: []uint64{0, 2}},
+		// appends beyond the index's size are sampled at the same rate.
+		{columns: 128, shardWidth: 16, shards: 2, highest: 200, expected: []uint64{0, 4, 8, 12}},
+		{columns: 128, shardWidth: 16, shards: 100, highest: 0, expected: []uint64{0}},
+	} {
+		fs := &fieldSpec{Parent: &indexSpec{Columns: c.columns, ShardWidth: c.shardWidth}, Type: fieldTypeSet, HighestColumn: c.highest}
+		fc := newFieldCheck(fs, nil, c.shards)
+		shards := fc.shards()
+		if fmt.Sprint(shards) != fmt.Sprint(c.expected) {
+			t.Errorf("%d columns, width %d, %d shards, highest %d: expected shards %v, got %v",
+				c.columns, c.shardWidth, c.shards, c.highest, c.expected, shards)
+		}
+		width := fs.Parent.shardWidth()
+		for _, shard := range shards {
+			if !fc.sampled(shard*width) || !fc.sampled(shard*width+width-1) {
+				t.Errorf("%d columns, width %d, %d shards: shard %d listed but not sampled", c.columns, c.shardWidth, c.shards, shard)
+			}
+		}
+	}
+}
+
+func TestPickEvenly(t *testing.T) {
+	values := []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	for _, c := range []struct {
+		values   []int64
+		n        int
+		expected []int64
+	}{
+		{values: values, n: 0, expected: values},
+		{values: values, n: 10, expected: values},
+		{values: values, n: 20, expected: values},
+		{values: values, n: 1, expected: []int64{0}},
+		{values: values, n: 2, expected: []int64{0, 5}},
+		{values: values, n: 3, expected: []int64{0, 3, 6}},
+		{values: values, n: 4, expected: []int64{0, 2, 5, 7}},
+		{values: nil, n: 3, expected: nil},
+	} {
+		picked := pickEvenly(c.values, c.n)
+		if fmt.Sprint(picked) != fmt.Sprint(c.expected) {
+			t.Errorf("picking %d of %v: expected %v, got %v", c.n, c.values, c.expected, picked)
+		}
+	}
+}
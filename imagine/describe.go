@@ -0,0 +1,96 @@
+package imagine
+
+//go:generate enumer -type=describeFormat -trimprefix=describeFormat -text -transform=kebab -output enums_describeformat.go
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+)
+
+type describeFormat int
+
+const (
+	describeFormatText describeFormat = iota
+	describeFormatJSON
+)
+
+// The JSON description of a spec is the spec itself, after cleanup, with
+// an estimate of the bits each task will generate added.
+type specDescription struct {
+	*tomlSpec
+	Workloads []workloadDescription
+}
+
+type workloadDescription struct {
+	*workloadSpec
+	Tasks []taskDescription
+}
+
+type taskDescription struct {
+	*taskSpec
+	EstimatedBits uint64
+}
+
+// describeSpecsJSON writes a JSON description of the fully resolved specs.
+func describeSpecsJSON(w io.Writer, specs []*tomlSpec) error {
+	descs := make([]specDescription, len(specs))
+	for i, spec := range specs {
+		descs[i] = specDescription{tomlSpec: spec, Workloads: make([]workloadDescription, len(spec.Workloads))}
+		for j, wl := range spec.Workloads {
+			tasks := make([]taskDescription, len(wl.Tasks))
+			for k, task := range wl.Tasks {
+				tasks[k] = taskDescription{taskSpec: task, EstimatedBits: task.estimatedBits()}
+			}
+			descs[i].Workloads[j] = workloadDescription{workloadSpec: wl, Tasks: tasks}
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(descs)
+}
+
+// estimatedBits estimates the number of bits a task will generate, from
+// the densities of its field. Fields with one value per column get one
+// bit per column, scaled by density. Set and time fields try every row of
+// every column, each with its own density. fastSparse fields generate
+// one bit per column of the task, or per unique column, if the index
+// has them.
+func (ts *taskSpec) estimatedBits() uint64 {
+	fs := ts.FieldSpec
+	cols := float64(*ts.Columns)
+	if fs.FastSparse {
+		if fs.Parent.UniqueColumns != 0 {
+			return uint64(math.Round(cols * float64(fs.Parent.UniqueColumns) / float64(fs.Parent.Columns)))
+		}
+		return *ts.Columns
+	}
+	if fs.Type.singleValue() || ts.ColumnOrder == valueOrderZipf {
+		return uint64(math.Round(cols * math.Min(fs.Density, 1)))
+	}
+	var perColumn float64
+	for row := fs.Min; row < fs.Max; row++ {
+		perColumn += fs.expectedDensity(row)
+	}
+	return uint64(math.Round(cols * perColumn))
+}
+
+// expectedDensity computes the chance that a given row of a set field
+// has a bit in a given column. With a chance less than 1, a column uses
+// this field spec or the next one, so the densities are mixed.
+func (fs *fieldSpec) expectedDensity(row int64) float64 {
+	density := fs.Density
+	if fs.ValueRule == densityTypeZipf {
+		// see zipfDensityGenerator
+		density = fs.Density * math.Pow((float64(row)+fs.ZipfV)/fs.ZipfV, -fs.ZipfS)
+	}
+	density = math.Min(density, 1)
+	if *fs.Chance == 1 {
+		return density
+	}
+	var next float64
+	if fs.Next != nil {
+		next = fs.Next.expectedDensity(row)
+	}
+	return *fs.Chance*density + (1-*fs.Chance)*next
+}
@@ -7,9 +7,9 @@ import (
 	"fmt"
 )
 
-const _fieldTypeName = "undefintsetmutextime"
+const _fieldTypeName = "undefintsetmutextimebooldecimaltimestamp"
 
-var _fieldTypeIndex = [...]uint8{0, 5, 8, 11, 16, 20}
+var _fieldTypeIndex = [...]uint8{0, 5, 8, 11, 16, 20, 24, 31, 40}
 
 func (i fieldType) String() string {
 	if i < 0 || i >= fieldType(len(_fieldTypeIndex)-1) {
@@ -18,7 +18,7 @@ func (i fieldType) String() string {
 	return _fieldTypeName[_fieldTypeIndex[i]:_fieldTypeIndex[i+1]]
 }
 
-var _fieldTypeValues = []fieldType{0, 1, 2, 3, 4}
+var _fieldTypeValues = []fieldType{0, 1, 2, 3, 4, 5, 6, 7}
 
 var _fieldTypeNameToValueMap = map[string]fieldType{
 	_fieldTypeName[0:5]:   0,
@@ -26,6 +26,9 @@ var _fieldTypeNameToValueMap = map[string]fieldType{
 	_fieldTypeName[8:11]:  2,
 	_fieldTypeName[11:16]: 3,
 	_fieldTypeName[16:20]: 4,
+	_fieldTypeName[20:24]: 5,
+	_fieldTypeName[24:31]: 6,
+	_fieldTypeName[31:40]: 7,
 }
 
 // fieldTypeString retrieves an enum value from the enum constants string name.
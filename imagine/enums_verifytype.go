@@ -7,9 +7,9 @@ import (
 	"fmt"
 )
 
-const _verifyTypeName = "errornonepurgeupdatecreate"
+const _verifyTypeName = "errornonepurgeupdatecreatemigrate"
 
-var _verifyTypeIndex = [...]uint8{0, 5, 9, 14, 20, 26}
+var _verifyTypeIndex = [...]uint8{0, 5, 9, 14, 20, 26, 33}
 
 func (i verifyType) String() string {
 	if i < 0 || i >= verifyType(len(_verifyTypeIndex)-1) {
@@ -18,7 +18,7 @@ func (i verifyType) String() string {
 	return _verifyTypeName[_verifyTypeIndex[i]:_verifyTypeIndex[i+1]]
 }
 
-var _verifyTypeValues = []verifyType{0, 1, 2, 3, 4}
+var _verifyTypeValues = []verifyType{0, 1, 2, 3, 4, 5}
 
 var _verifyTypeNameToValueMap = map[string]verifyType{
 	_verifyTypeName[0:5]:   0,
@@ -26,6 +26,7 @@ var _verifyTypeNameToValueMap = map[string]verifyType{
 	_verifyTypeName[9:14]:  2,
 	_verifyTypeName[14:20]: 3,
 	_verifyTypeName[20:26]: 4,
+	_verifyTypeName[26:33]: 5,
 }
 
 // verifyTypeString retrieves an enum value from the enum constants string name.
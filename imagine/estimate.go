@@ -0,0 +1,177 @@
+package imagine
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// containerWidth is the number of bits covered by a roaring container.
+	containerWidth = 1 << 16
+	// arrayMaxSize is the most values a roaring array container holds
+	// before it becomes a bitmap.
+	arrayMaxSize = 4096
+	// bitmapSize is the size, in bytes, of a roaring bitmap container.
+	bitmapSize = containerWidth / 8
+	// containerOverhead is an approximate per-container cost for the
+	// server's bookkeeping, beyond the container's own data.
+	containerOverhead = 64
+)
+
+// sizeEstimate is a rough estimate of how much data a field, or a group
+// of fields, will have. It's computed from the field's spec, assuming that
+// bits are spread randomly across each row.
+type sizeEstimate struct {
+	bits, containers, bytes float64
+	shards                  uint64
+}
+
+func (e *sizeEstimate) add(other sizeEstimate) {
+	e.bits += other.bits
+	e.containers += other.containers
+	e.bytes += other.bytes
+	if other.shards > e.shards {
+		e.shards = other.shards
+	}
+}
+
+func (e sizeEstimate) String() string {
+	return fmt.Sprintf("%d shards, %.0f bits, %.0f containers, %s", e.shards, e.bits, e.containers, humanBytes(e.bytes))
+}
+
+// addRow adds a row whose columns each have the given chance of having
+// a bit, and which is stored in the given number of views.
+func (e *sizeEstimate) addRow(density float64, columns uint64, views int) {
+	density = math.Min(density, 1)
+	if density <= 0 {
+		return
+	}
+	// the chance that a container has at least one bit in it.
+	used := 1 - math.Pow(1-density, containerWidth)
+	containers := math.Ceil(float64(columns)/containerWidth) * used
+	perContainer := math.Min(density*containerWidth/used, containerWidth)
+	size := float64(bitmapSize)
+	if perContainer <= arrayMaxSize {
+		size = perContainer * 2
+	}
+	e.bits += float64(columns) * density * float64(views)
+	e.containers += containers * float64(views)
+	e.bytes += containers * (size + containerOverhead) * float64(views)
+}
+
+// estimateSize estimates the size of a field's data, for every column
+// of its index.
+func (fs *fieldSpec) estimateSize() (e sizeEstimate) {
+	columns := fs.Parent.Columns
+	shardWidth := fs.Parent.shardWidth()
+	e.shards = (columns + shardWidth - 1) / shardWidth
+	views := 1
+	if fs.Type == fieldTypeTime {
+		// a bit in a time field is also set in a view for each unit of
+		// its time quantum. spreading them across many views makes
+		// more, smaller, containers, so this is an underestimate.
+		views += len(fs.Quantum.String())
+	}
+	rows := fs.Max - fs.Min
+	switch {
+	case fs.FastSparse:
+		// fastSparse makes one bit per column, or per unique column,
+		// spread across the rows.
+		perColumn := 1.0
+		if fs.Parent.UniqueColumns != 0 {
+			perColumn = float64(fs.Parent.UniqueColumns) / float64(columns)
+		}
+		for row := fs.Min; row < fs.Max; row++ {
+			e.addRow(perColumn/float64(rows), columns, views)
+		}
+	case fs.Type.intBacked():
+		// an int field has a row marking which columns have values,
+		// plus a row for each bit of the values, which are each set
+		// about half the time.
+		density := math.Min(fs.Density, 1)
+		e.addRow(density, columns, views)
+		for i := 0; i < bits.Len64(uint64(rows)); i++ {
+			e.addRow(density/2, columns, views)
+		}
+	case fs.Type == fieldTypeMutex, fs.Type == fieldTypeBool:
+		// a mutex or bool field has one value per column, split across
+		// the rows by its value distribution.
+		density := math.Min(fs.Density, 1)
+		weights := make([]float64, rows)
+		var total float64
+		for k := range weights {
+			weights[k] = 1
+			if fs.ValueRule == densityTypeZipf {
+				weights[k] = math.Pow(fs.ZipfV+float64(k), -fs.ZipfS)
+			}
+			total += weights[k]
+		}
+		for _, w := range weights {
+			e.addRow(density*w/total, columns, views)
+		}
+	default:
+		for row := fs.Min; row < fs.Max; row++ {
+			e.addRow(fs.expectedDensity(row), columns, views)
+		}
+	}
+	return e
+}
+
+// EstimateSizes prints estimated sizes for each field of each index, and
+// returns the total.
+func (conf *Config) EstimateSizes() (total sizeEstimate) {
+	indexNames := make([]string, 0, len(conf.indexes))
+	for name := range conf.indexes {
+		indexNames = append(indexNames, name)
+	}
+	sort.Strings(indexNames)
+	conf.printf("estimated sizes:\n")
+	for _, name := range indexNames {
+		index := conf.indexes[name]
+		fieldNames := make([]string, 0, len(index.FieldsByName))
+		for name := range index.FieldsByName {
+			fieldNames = append(fieldNames, name)
+		}
+		sort.Strings(fieldNames)
+		var indexTotal sizeEstimate
+		fields := make([]sizeEstimate, len(fieldNames))
+		for i, name := range fieldNames {
+			fields[i] = index.FieldsByName[name].estimateSize()
+			indexTotal.add(fields[i])
+		}
+		conf.printf("  index %s: %v\n", index.FullName, indexTotal)
+		for i, name := range fieldNames {
+			conf.printf("    %s: %v\n", name, fields[i])
+		}
+		total.add(indexTotal)
+	}
+	conf.printf(" total: %v\n", total)
+	return total
+}
+
+// checkEstimate compares an estimated size with the memory available
+// across the cluster, assuming data is spread evenly and not replicated.
+func checkEstimate(out io.Writer, total sizeEstimate, memory uint64, nodes int) {
+	available := float64(memory) * float64(nodes)
+	fmt.Fprintf(out, "estimated data size %s, %s available across %d nodes\n", humanBytes(total.bytes), humanBytes(available), nodes)
+	switch {
+	case total.bytes > available:
+		fmt.Fprintf(out, "warning: estimated data size is larger than server memory, dataset probably won't fit\n")
+	case total.bytes > available/2:
+		fmt.Fprintf(out, "warning: estimated data size is over half of server memory, dataset may not fit\n")
+	}
+}
+
+// humanBytes formats a byte count using binary units.
+func humanBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
@@ -0,0 +1,56 @@
+package imagine
+
+import (
+	"io"
+	"math"
+	"testing"
+)
+
+func TestEstimatedBits(t *testing.T) {
+	zipf := &fieldSpec{Type: fieldTypeSet, Max: 10, Chance: float64p(0.5), DensityScale: uint64p(2097152), Density: 0.8, ValueRule: densityTypeZipf, ZipfV: 2, ZipfS: 2}
+	specs := map[string]*taskSpec{
+		"set":    {FieldSpec: &fieldSpec{Type: fieldTypeSet, Max: 10, Chance: float64p(1.0), DensityScale: uint64p(2097152), Density: 0.25}},
+		"chance": {FieldSpec: &fieldSpec{Type: fieldTypeSet, Max: 10, Chance: float64p(0.7), DensityScale: uint64p(2097152), Density: 0.1, Next: zipf}},
+		"mutex":  {FieldSpec: &fieldSpec{Type: fieldTypeMutex, Max: 10, Chance: float64p(1.0), DensityScale: uint64p(2097152), Density: 0.6}},
+	}
+	for name, spec := range specs {
+		spec.FieldSpec.Parent = &indexSpec{Columns: 20000}
+		spec.Parent = &workloadSpec{}
+		spec.Columns = uint64p(20000)
+		spec.Seed = int64p(2)
+		itr, _, err := NewGenerator(spec, nil, "")
+		if err != nil {
+			t.Fatalf("%s: creating generator: %v", name, err)
+		}
+		var bits float64
+		for _, err := itr.NextRecord(); err != io.EOF; _, err = itr.NextRecord() {
+			if err != nil {
+				t.Fatalf("%s: generating: %v", name, err)
+			}
+			bits++
+		}
+		estimate := float64(spec.estimatedBits())
+		if bits < estimate*0.95 || bits > estimate*1.05 {
+			t.Errorf("%s: estimated %.0f bits, generated %.0f", name, estimate, bits)
+		}
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	full := &fieldSpec{Type: fieldTypeSet, Max: 4, Chance: float64p(1.0), Density: 1.0, Parent: &indexSpec{Columns: 3 << 20}}
+	e := full.estimateSize()
+	if e.shards != 3 || e.bits != 4*(3<<20) || e.containers != 4*48 {
+		t.Fatalf("full set field: expected 3 shards, %d bits, 192 containers, got %v", 4*(3<<20), e)
+	}
+	if e.bytes != e.containers*(bitmapSize+containerOverhead) {
+		t.Fatalf("full set field: expected bitmap containers, got %.0f bytes", e.bytes)
+	}
+	sparse := &fieldSpec{Type: fieldTypeMutex, Max: 10, Chance: float64p(1.0), Density: 0.01, Parent: &indexSpec{Columns: 1 << 20}}
+	e = sparse.estimateSize()
+	if math.Abs(e.bits-0.01*(1<<20)) > 1 {
+		t.Fatalf("sparse mutex field: expected %d bits, got %.0f", (1<<20)/100, e.bits)
+	}
+	if e.bytes >= e.containers*(bitmapSize+containerOverhead)/2 {
+		t.Fatalf("sparse mutex field: expected array containers, got %.0f bytes for %.0f containers", e.bytes, e.containers)
+	}
+}
@@ -0,0 +1,295 @@
+package imagine
+
+//go:generate enumer -type=outputFormat -trimprefix=outputFormat -text -transform=kebab -output enums_outputformat.go
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/pilosa/roaring"
+	"github.com/pkg/errors"
+)
+
+type outputFormat int
+
+const (
+	outputFormatCSV outputFormat = iota
+	outputFormatNDJSON
+	outputFormatRoaring
+)
+
+// pilosaTimeFormat is the timestamp format the Pilosa CSV importer accepts.
+const pilosaTimeFormat = "2006-01-02T15:04"
+
+// recordWriter writes generated records somewhere other than a server.
+type recordWriter interface {
+	Write(rec pilosa.Record) error
+	Close() error
+}
+
+// exportName picks a file name for a task's data. Tasks are numbered
+// within their workload, because split tasks, or later tasks, often
+// write the same field. Clear tasks are labeled, because their data
+// has to be imported with the importer's clear option.
+func exportName(task *taskSpec, idx int) string {
+	name := fmt.Sprintf("%s-%03d-%s-%s", task.Parent.Name, idx, task.Index, task.Field)
+	if task.Operation == taskOperationClear {
+		name += "-clear"
+	}
+	return name
+}
+
+// ExportTask writes the records from a task's generator to files in
+// the configured output directory, in each of the configured formats.
+func (conf *Config) ExportTask(task *taskSpec, itr CountingIterator, name string) (err error) {
+	writers := make([]recordWriter, 0, len(conf.outFormats))
+	defer func() {
+		for _, w := range writers {
+			if cErr := w.Close(); err == nil {
+				err = cErr
+			}
+		}
+	}()
+	for _, format := range conf.outFormats {
+		path := filepath.Join(conf.OutputDir, name)
+		var w recordWriter
+		switch format {
+		case outputFormatCSV:
+			w, err = newTextWriter(path+".csv", writeCSVRecord)
+		case outputFormatNDJSON:
+			w, err = newTextWriter(path+".ndjson", writeJSONRecord)
+		case outputFormatRoaring:
+			// Int, decimal, and timestamp fields are stored as bit-sliced
+			// integers, and keys are translated by the server, so neither
+			// can be written as plain bitmaps.
+			fs := task.FieldSpec
+			if fs.Type.intBacked() || fs.Keys || fs.Parent.Keys {
+				conf.printf("   %s: skipping roaring output, only supported for unkeyed set, mutex, bool, and time fields\n", name)
+				continue
+			}
+			w = newRoaringWriter(path, fs)
+		}
+		if err != nil {
+			return err
+		}
+		writers = append(writers, w)
+	}
+	for {
+		rec, err := itr.NextRecord()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "generating %s", name)
+		}
+		for _, w := range writers {
+			if err := w.Write(rec); err != nil {
+				return errors.Wrapf(err, "writing %s", name)
+			}
+		}
+	}
+}
+
+// textWriter writes one line per record to a file.
+type textWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	write func(w *bufio.Writer, rec pilosa.Record) error
+}
+
+func newTextWriter(path string, write func(w *bufio.Writer, rec pilosa.Record) error) (*textWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &textWriter{f: f, w: bufio.NewWriter(f), write: write}, nil
+}
+
+func (t *textWriter) Write(rec pilosa.Record) error {
+	return t.write(t.w, rec)
+}
+
+func (t *textWriter) Close() error {
+	err := t.w.Flush()
+	if cErr := t.f.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// writeCSVRecord writes records the way `pilosa import` reads them:
+// row,column[,timestamp] for set, mutex, and time fields, and
+// column,value for int fields, with keys in place of IDs where the
+// index or field uses them. The importer doesn't accept a header line,
+// so there isn't one. Generated keys never need quoting.
+func writeCSVRecord(w *bufio.Writer, rec pilosa.Record) (err error) {
+	switch r := rec.(type) {
+	case pilosa.Column:
+		row, col := columnIdentifiers(r)
+		if r.Timestamp != 0 {
+			_, err = fmt.Fprintf(w, "%v,%v,%s\n", row, col, time.Unix(0, r.Timestamp).UTC().Format(pilosaTimeFormat))
+		} else {
+			_, err = fmt.Fprintf(w, "%v,%v\n", row, col)
+		}
+	case pilosa.FieldValue:
+		var col interface{} = r.ColumnID
+		if r.ColumnKey != "" {
+			col = r.ColumnKey
+		}
+		_, err = fmt.Fprintf(w, "%v,%d\n", col, r.Value)
+	}
+	return err
+}
+
+// jsonRecord is the newline-delimited JSON form of a record. Row and
+// Column are keys or IDs.
+type jsonRecord struct {
+	Row       interface{} `json:"row,omitempty"`
+	Column    interface{} `json:"column"`
+	Value     *int64      `json:"value,omitempty"`
+	Timestamp string      `json:"timestamp,omitempty"`
+}
+
+// writeJSONRecord writes a record as a single line of JSON.
+func writeJSONRecord(w *bufio.Writer, rec pilosa.Record) error {
+	var j jsonRecord
+	switch r := rec.(type) {
+	case pilosa.Column:
+		j.Row, j.Column = columnIdentifiers(r)
+		if r.Timestamp != 0 {
+			j.Timestamp = time.Unix(0, r.Timestamp).UTC().Format(time.RFC3339Nano)
+		}
+	case pilosa.FieldValue:
+		j.Column = r.ColumnID
+		if r.ColumnKey != "" {
+			j.Column = r.ColumnKey
+		}
+		j.Value = &r.Value
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+// columnIdentifiers returns the row and column of a pilosa.Column, as
+// keys if it has them, or IDs.
+func columnIdentifiers(r pilosa.Column) (row, col interface{}) {
+	row, col = r.RowID, r.ColumnID
+	if r.RowKey != "" {
+		row = r.RowKey
+	}
+	if r.ColumnKey != "" {
+		col = r.ColumnKey
+	}
+	return row, col
+}
+
+// roaringWriter accumulates a task's bits into a bitmap for each view
+// of each shard, then writes each bitmap to its own file, named
+// <path>/<view>/<shard>.roaring. The bitmaps use the same layout as a
+// Pilosa fragment, so each file holds exactly the data the server would
+// have for that view of that shard. All of a task's bitmaps are held in
+// memory until it completes.
+type roaringWriter struct {
+	path       string
+	quantum    string
+	shardWidth uint64
+	shards     map[uint64]map[string]*roaring.Bitmap
+}
+
+func newRoaringWriter(path string, fs *fieldSpec) *roaringWriter {
+	w := &roaringWriter{path: path, shardWidth: fs.Parent.shardWidth(), shards: make(map[uint64]map[string]*roaring.Bitmap)}
+	if fs.Type == fieldTypeTime {
+		w.quantum = fs.Quantum.String()
+	}
+	return w
+}
+
+func (w *roaringWriter) Write(rec pilosa.Record) error {
+	r, ok := rec.(pilosa.Column)
+	if !ok {
+		return fmt.Errorf("can't write %T as roaring", rec)
+	}
+	shard := r.ColumnID / w.shardWidth
+	views := w.shards[shard]
+	if views == nil {
+		views = make(map[string]*roaring.Bitmap)
+		w.shards[shard] = views
+	}
+	pos := r.RowID*w.shardWidth + r.ColumnID%w.shardWidth
+	w.add(views, "standard", pos)
+	if r.Timestamp != 0 {
+		t := time.Unix(0, r.Timestamp).UTC()
+		for _, unit := range w.quantum {
+			w.add(views, "standard_"+t.Format(timeViewFormats[unit]), pos)
+		}
+	}
+	return nil
+}
+
+// timeViewFormats are the time formats Pilosa uses to name the views for
+// each unit of a time quantum.
+var timeViewFormats = map[rune]string{
+	'Y': "2006",
+	'M': "200601",
+	'D': "20060102",
+	'H': "2006010215",
+}
+
+func (w *roaringWriter) add(views map[string]*roaring.Bitmap, view string, pos uint64) {
+	bm := views[view]
+	if bm == nil {
+		bm = roaring.NewBTreeBitmap()
+		views[view] = bm
+	}
+	bm.DirectAdd(pos)
+}
+
+func (w *roaringWriter) Close() error {
+	shards := make([]uint64, 0, len(w.shards))
+	for shard := range w.shards {
+		shards = append(shards, shard)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i] < shards[j] })
+	for _, shard := range shards {
+		for view, bm := range w.shards[shard] {
+			dir := filepath.Join(w.path, view)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if err := writeBitmap(filepath.Join(dir, fmt.Sprintf("%d.roaring", shard)), bm); err != nil {
+				return err
+			}
+		}
+		// let the shard's memory go as soon as we're done with it.
+		delete(w.shards, shard)
+	}
+	return nil
+}
+
+func writeBitmap(path string, bm *roaring.Bitmap) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	_, err = bm.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	return errors.Wrapf(err, "writing %s", path)
+}
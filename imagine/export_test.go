@@ -0,0 +1,105 @@
+package imagine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/pilosa/roaring"
+)
+
+func TestExportTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagine-export")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	spec := &taskSpec{
+		FieldSpec: &fieldSpec{
+			Parent:       &indexSpec{Columns: 10},
+			Type:         fieldTypeSet,
+			Max:          2,
+			Chance:       float64p(1.0),
+			DensityScale: uint64p(2097152),
+			Density:      1.0,
+		},
+		ColumnOrder:    valueOrderLinear,
+		DimensionOrder: dimensionOrderRow,
+		Columns:        uint64p(10),
+		RowOrder:       valueOrderLinear,
+		Seed:           int64p(0),
+	}
+	sg, err := newSetGenerator(spec, nil, "updateid")
+	if err != nil {
+		t.Fatalf("getting new set generator: %v", err)
+	}
+	conf := &Config{OutputDir: dir, outFormats: []outputFormat{outputFormatCSV, outputFormatNDJSON, outputFormatRoaring}}
+	err = conf.ExportTask(spec, sg, "test")
+	if err != nil {
+		t.Fatalf("exporting: %v", err)
+	}
+	csv, err := ioutil.ReadFile(filepath.Join(dir, "test.csv"))
+	if err != nil {
+		t.Fatalf("reading csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(csv)), "\n")
+	if len(lines) != 20 || lines[0] != "0,0" || lines[19] != "1,9" {
+		t.Fatalf("unexpected csv output: %q", lines)
+	}
+	ndjson, err := ioutil.ReadFile(filepath.Join(dir, "test.ndjson"))
+	if err != nil {
+		t.Fatalf("reading ndjson: %v", err)
+	}
+	lines = strings.Split(strings.TrimSpace(string(ndjson)), "\n")
+	if len(lines) != 20 || lines[10] != `{"row":1,"column":0}` {
+		t.Fatalf("unexpected ndjson output: %q", lines)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "test", "standard", "0.roaring"))
+	if err != nil {
+		t.Fatalf("reading roaring: %v", err)
+	}
+	bm := roaring.NewBTreeBitmap()
+	err = bm.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("decoding roaring: %v", err)
+	}
+	if bm.Count() != 20 || !bm.Contains(gopilosa.DefaultShardWidth+9) {
+		t.Fatalf("unexpected roaring bitmap: %d bits", bm.Count())
+	}
+}
+
+func TestRoaringWriterShardWidth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagine-roaring")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fs := &fieldSpec{Parent: &indexSpec{Columns: 10, ShardWidth: 4}, Type: fieldTypeSet}
+	w := newRoaringWriter(dir, fs)
+	for _, rec := range []gopilosa.Column{{RowID: 0, ColumnID: 1}, {RowID: 2, ColumnID: 5}, {RowID: 1, ColumnID: 9}} {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("writing %v: %v", rec, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+	// each shard's bits are at row*width + column%width.
+	for shard, pos := range []uint64{1, 2*4 + 1, 1*4 + 1} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "standard", fmt.Sprintf("%d.roaring", shard)))
+		if err != nil {
+			t.Fatalf("reading shard %d: %v", shard, err)
+		}
+		bm := roaring.NewBTreeBitmap()
+		if err := bm.UnmarshalBinary(data); err != nil {
+			t.Fatalf("decoding shard %d: %v", shard, err)
+		}
+		if bm.Count() != 1 || !bm.Contains(pos) {
+			t.Fatalf("shard %d: expected only bit %d, got %v", shard, pos, bm.Slice())
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package imagine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// fanOutChunk is the number of records sent to each cluster at a time.
+const fanOutChunk = 1024
+
+// fanOutDepth is the number of chunks which can be waiting for each
+// cluster. The slowest cluster limits how fast records are generated.
+const fanOutDepth = 16
+
+// cluster is one of several clusters which get the same data. It keeps
+// track of how importing into it has gone, separately from the others.
+type cluster struct {
+	name   string
+	client *pilosa.Client
+
+	mu         sync.Mutex
+	batches    int64
+	records    int64
+	importTime time.Duration
+	maxBatch   time.Duration
+	failures   int
+	lastErr    error
+}
+
+// newCluster makes a client for a cluster, given as "host:port" pairs
+// joined by "+".
+func newCluster(hosts string, opts ...pilosa.ClientOption) (*cluster, error) {
+	uris := make([]*pilosa.URI, 0)
+	for _, host := range strings.Split(hosts, "+") {
+		uri, err := pilosa.NewURIFromAddress(host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cluster '%s'", hosts)
+		}
+		uris = append(uris, uri)
+	}
+	client, err := pilosa.NewClient(pilosa.NewClusterWithHost(uris...), opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cluster '%s'", hosts)
+	}
+	return &cluster{name: hosts, client: client}, nil
+}
+
+// importField imports records into the cluster, recording the time each
+// batch takes, and whether the import failed. onBatch, if not nil, is
+// called after each batch.
+func (c *cluster) importField(field *pilosa.Field, itr pilosa.RecordIterator, opts []pilosa.ImportOption, onBatch func()) error {
+	statusChan := make(chan pilosa.ImportStatusUpdate, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for u := range statusChan {
+			c.mu.Lock()
+			c.batches++
+			c.records += int64(u.ImportedCount)
+			c.importTime += u.Time
+			if u.Time > c.maxBatch {
+				c.maxBatch = u.Time
+			}
+			c.mu.Unlock()
+			if onBatch != nil {
+				onBatch()
+			}
+		}
+	}()
+	opts = append(opts[:len(opts):len(opts)], pilosa.OptImportStatusChannel(statusChan))
+	err := c.client.ImportField(field, itr, opts...)
+	close(statusChan)
+	<-done
+	if err != nil {
+		c.mu.Lock()
+		c.failures++
+		c.lastErr = err
+		c.mu.Unlock()
+		return errors.Wrapf(err, "cluster '%s'", c.name)
+	}
+	return nil
+}
+
+// Summary describes the imports into the cluster so far.
+func (c *cluster) Summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var mean time.Duration
+	if c.batches > 0 {
+		mean = c.importTime / time.Duration(c.batches)
+	}
+	summary := fmt.Sprintf("%s: %d records in %d batches, %v total batch time, %v mean batch, %v max",
+		c.name, c.records, c.batches, c.importTime.Round(time.Millisecond), mean.Round(time.Microsecond), c.maxBatch.Round(time.Microsecond))
+	if c.failures > 0 {
+		summary += fmt.Sprintf(", %d failed imports, last: %v", c.failures, c.lastErr)
+	}
+	return summary
+}
+
+// result reports the imports into the cluster so far.
+func (c *cluster) result() ClusterResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cr := ClusterResult{
+		Name:       c.name,
+		Records:    c.records,
+		Batches:    c.batches,
+		ImportTime: c.importTime,
+		MaxBatch:   c.maxBatch,
+		Failures:   c.failures,
+	}
+	if c.lastErr != nil {
+		cr.LastError = c.lastErr.Error()
+	}
+	return cr
+}
+
+// fanOutImport generates a task's records once, and imports them into
+// every cluster. Each cluster imports in its own goroutine, from chunks
+// of records sent to it over a channel. A cluster whose import fails
+// stops receiving records, but the others carry on. onBatch, if not nil,
+// is called after each batch imported into the first cluster.
+func fanOutImport(clusters []*cluster, field *pilosa.Field, itr pilosa.RecordIterator, opts []pilosa.ImportOption, onBatch func()) error {
+	feeds := make([]*feedIterator, len(clusters))
+	errs := make([]error, len(clusters))
+	var imports sync.WaitGroup
+	for i, c := range clusters {
+		feeds[i] = &feedIterator{chunks: make(chan []pilosa.Record, fanOutDepth)}
+		imports.Add(1)
+		go func(i int, c *cluster) {
+			defer imports.Done()
+			var batch func()
+			if i == 0 {
+				batch = onBatch
+			}
+			errs[i] = c.importField(field, feeds[i], opts, batch)
+			// a failed import stops reading, so take the rest of the
+			// records so the others aren't held up.
+			for range feeds[i].chunks {
+			}
+		}(i, c)
+	}
+	var genErr error
+	chunk := make([]pilosa.Record, 0, fanOutChunk)
+	for {
+		rec, err := itr.NextRecord()
+		if err != nil {
+			if err != io.EOF {
+				genErr = err
+			}
+			break
+		}
+		chunk = append(chunk, rec)
+		if len(chunk) == fanOutChunk {
+			for _, feed := range feeds {
+				feed.chunks <- chunk
+			}
+			// the clusters share the chunk, so it can't be reused.
+			chunk = make([]pilosa.Record, 0, fanOutChunk)
+		}
+	}
+	for _, feed := range feeds {
+		if len(chunk) > 0 {
+			feed.chunks <- chunk
+		}
+		close(feed.chunks)
+	}
+	imports.Wait()
+	if genErr != nil {
+		return genErr
+	}
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// feedIterator produces the records sent to it in chunks.
+type feedIterator struct {
+	chunks chan []pilosa.Record
+	chunk  []pilosa.Record
+}
+
+func (f *feedIterator) NextRecord() (pilosa.Record, error) {
+	for len(f.chunk) == 0 {
+		chunk, ok := <-f.chunks
+		if !ok {
+			return nil, io.EOF
+		}
+		f.chunk = chunk
+	}
+	rec := f.chunk[0]
+	f.chunk = f.chunk[1:]
+	return rec, nil
+}
@@ -0,0 +1,77 @@
+package imagine
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestFanOutImport(t *testing.T) {
+	// nothing listens here, so every import fails.
+	srv := httptest.NewServer(nil)
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close()
+	var clusters []*cluster
+	for i := 0; i < 2; i++ {
+		c, err := newCluster(addr, gopilosa.OptClientRetries(0))
+		if err != nil {
+			t.Fatalf("creating cluster: %v", err)
+		}
+		clusters = append(clusters, c)
+	}
+	field := gopilosa.NewSchema().Index("i").Field("f")
+	fs := &fieldSpec{Type: fieldTypeMutex, Max: 10, Density: 1.0, DensityScale: uint64p(2097152), Chance: float64p(1.0)}
+	// more records than the clusters' channels can hold, so a failed
+	// cluster which stopped reading would block the others.
+	columns := uint64(fanOutChunk * fanOutDepth * 4)
+	spec := &taskSpec{FieldSpec: fs, Parent: &workloadSpec{}, Columns: uint64p(columns), Seed: int64p(1)}
+	itr, _, err := NewGenerator(spec, nil, "")
+	if err != nil {
+		t.Fatalf("creating generator: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- fanOutImport(clusters, field, itr, nil, nil)
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("fan-out import blocked after failures")
+	}
+	if err == nil || strings.Count(err.Error(), addr) != 2 {
+		t.Fatalf("expected errors from both clusters, got %v", err)
+	}
+	for _, c := range clusters {
+		if c.failures != 1 || c.batches != 0 {
+			t.Fatalf("expected one failure and no batches, got %s", c.Summary())
+		}
+	}
+
+	// a feed produces its chunks' records in order, then EOF.
+	feed := &feedIterator{chunks: make(chan []gopilosa.Record, 3)}
+	for i := 0; i < 3; i++ {
+		chunk := make([]gopilosa.Record, i)
+		for j := range chunk {
+			chunk[j] = gopilosa.Column{RowID: uint64(i), ColumnID: uint64(j)}
+		}
+		feed.chunks <- chunk
+	}
+	close(feed.chunks)
+	var got []gopilosa.Record
+	for rec, err := feed.NextRecord(); err != io.EOF; rec, err = feed.NextRecord() {
+		got = append(got, rec)
+	}
+	want := []gopilosa.Record{
+		gopilosa.Column{RowID: 1, ColumnID: 0},
+		gopilosa.Column{RowID: 2, ColumnID: 0},
+		gopilosa.Column{RowID: 2, ColumnID: 1},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"math/rand"
+	"math/bits"
+	"sort"
 	"sync"
-	"time"
 
 	"github.com/molecula/apophenia"
 	pilosa "github.com/pilosa/go-pilosa"
@@ -16,10 +16,13 @@ import (
 type genfunc func(*taskSpec, chan taskUpdate, string) (CountingIterator, error)
 
 var newGenerators = map[fieldType]genfunc{
-	fieldTypeSet:   newSetGenerator,
-	fieldTypeTime:  newSetGenerator,
-	fieldTypeMutex: newMutexGenerator,
-	fieldTypeInt:   newIntGenerator,
+	fieldTypeSet:       newSetGenerator,
+	fieldTypeTime:      newSetGenerator,
+	fieldTypeMutex:     newMutexGenerator,
+	fieldTypeInt:       newIntGenerator,
+	fieldTypeBool:      newMutexGenerator,
+	fieldTypeDecimal:   newIntGenerator,
+	fieldTypeTimestamp: newIntGenerator,
 }
 
 // A generator needs to be able to generate columns and rows, sequentially.
@@ -36,6 +39,22 @@ type CountingIterator interface {
 	Values() (int64, int64)
 }
 
+// generatorPosition describes how far a generator has gotten through a
+// task. Columns and rows are the counts shown in status updates; tries
+// and values are what's needed to return to the same place.
+type generatorPosition struct {
+	Columns, Rows int64
+	Tries, Values int64
+}
+
+// seekableGenerator is a generator which can report its position, and
+// be moved to a position reported by another generator for the same task,
+// so an interrupted task can pick up where it stopped.
+type seekableGenerator interface {
+	Position() generatorPosition
+	SeekTo(pos generatorPosition)
+}
+
 // NewGenerator makes a generator which will generate the values for the
 // given task.
 func NewGenerator(ts *taskSpec, updateChan chan taskUpdate, updateID string) (CountingIterator, []pilosa.ImportOption, error) {
@@ -53,9 +72,22 @@ func NewGenerator(ts *taskSpec, updateChan chan taskUpdate, updateID string) (Co
 	if ts.Parent.ThreadCount != nil {
 		opts = append(opts, pilosa.OptImportThreadCount(*ts.Parent.ThreadCount))
 	}
-	if ts.UseRoaring != nil {
+	if ts.FieldSpec.Type == fieldTypeBool {
+		// go-pilosa uses roaring imports for bool fields, if the server
+		// has the endpoint, but servers only accept them for set and
+		// time fields.
+		opts = append(opts, pilosa.OptImportRoaring(false))
+	} else if ts.UseRoaring != nil {
 		opts = append(opts, pilosa.OptImportRoaring(*ts.UseRoaring))
 	}
+	if ts.Operation == taskOperationClear {
+		opts = append(opts, pilosa.OptImportClear(true))
+		// the server only clears bits with timestamps, which go in
+		// time views, through roaring imports.
+		if ts.Stamp != stampTypeNone {
+			opts = append(opts, pilosa.OptImportRoaring(true))
+		}
+	}
 	if noSortNeeded(ts) {
 		opts = append(opts, pilosa.OptImportSort(false))
 	}
@@ -73,14 +105,15 @@ func noSortNeeded(ts *taskSpec) bool {
 }
 
 // Three cases:
-// Int: FieldValue, one per column.
-// Mutex: Column, one per column.
+// Int: FieldValue, one per column. (Also decimal and timestamp, which are
+// generated as integers in units of their scale.)
+// Mutex: Column, one per column. (Also bool, which has rows 0 and 1.)
 // Set: FieldValue, possibly many per column, possibly column-major.
 
 func newSetGenerator(ts *taskSpec, updateChan chan taskUpdate, updateID string) (iter CountingIterator, err error) {
 	fs := ts.FieldSpec
 	if fs.FastSparse {
-		return newFastValueGenerator(fs), nil
+		return newFastValueGenerator(ts, updateChan, updateID)
 	}
 	// even though this is a set generator, we will treat it like a mutex generator -- we generate a series
 	// of individual values rather than populating every field
@@ -118,6 +151,10 @@ func newSetGenerator(ts *taskSpec, updateChan chan taskUpdate, updateID string)
 	// If ColumnOffset was -1, we'll now fix it up, but the generators
 	// won't be using it.
 	g.Prepare(ts, cols, rows)
+	err = g.prepareKeys(ts)
+	if err != nil {
+		return nil, err
+	}
 	g.densityGen, g.densityPerCol = makeDensityGenerator(fs, *ts.Seed)
 	g.densityScale = *fs.DensityScale
 	g.weighted, err = apophenia.NewWeighted(apophenia.NewSequence(*ts.Seed))
@@ -140,6 +177,10 @@ func (g *singleValueGenerator) prepareSingleValueGenerator(ts *taskSpec, updateC
 		return err
 	}
 	g.Prepare(ts, cols, 1)
+	err = g.prepareKeys(ts)
+	if err != nil {
+		return err
+	}
 	// ugly hack: the zipfColumnGenerator handles this column offset itself.
 	if ts.ColumnOrder == valueOrderZipf {
 		g.ColumnOffset = 0
@@ -228,17 +269,23 @@ func makeRowGenerator(ts *taskSpec) (sequenceGenerator, error) {
 // can only have one value per column, such as mutex/Int fields.
 func makeValueGenerator(ts *taskSpec) (vg valueGenerator, err error) {
 	fs := ts.FieldSpec
-	switch fs.ValueRule {
-	case densityTypeLinear:
+	switch {
+	case fs.Correlation != nil:
+		vg, err = newCorrelatedValueGenerator(ts)
+	case fs.ValueRule == densityTypeLinear:
 		vg, err = newLinearValueGenerator(fs.Min, fs.Max, *ts.Seed)
-	case densityTypeZipf:
+	case fs.ValueRule == densityTypeZipf:
 		vg, err = newZipfValueGenerator(fs.ZipfS, fs.ZipfV, fs.Min, fs.Max, *ts.Seed)
 	default:
 		err = errors.New("unknown value generator type")
 	}
-	if ts.RowOrder == valueOrderPermute && err == nil {
+	// a correlated field's row order applies to its source's values.
+	if ts.RowOrder == valueOrderPermute && err == nil && fs.Correlation == nil {
 		vg, err = newPermutedValueGenerator(vg, fs.Min, fs.Max, *ts.Seed)
 	}
+	if ts.Operation == taskOperationReassign && err == nil {
+		vg = newReassignedValueGenerator(vg, fs.Min, fs.Max, *ts.Seed)
+	}
 	return vg, err
 }
 
@@ -255,6 +302,9 @@ func makeValueGenerator(ts *taskSpec) (vg valueGenerator, err error) {
 type sequenceGenerator interface {
 	Next() (value int64, done bool)
 	Status() (produced, total int64)
+	// SeekTo moves the generator so the next value it produces is
+	// the one which would have followed n earlier values.
+	SeekTo(n int64)
 }
 
 // incrementGenerator counts from min to max by 1.
@@ -279,6 +329,12 @@ func (g *incrementGenerator) Status() (produced, total int64) {
 	return g.produced, g.max - g.min
 }
 
+// SeekTo moves the generator to the nth value.
+func (g *incrementGenerator) SeekTo(n int64) {
+	g.produced = n
+	g.current = g.min + n%(g.max-g.min)
+}
+
 // newIncrementGenerator creates an incrementGenerator.
 func newIncrementGenerator(min, max int64) *incrementGenerator {
 	return &incrementGenerator{current: min, min: min, max: max}
@@ -317,6 +373,22 @@ func (g *strideGenerator) Status() (produced, total int64) {
 	return g.emitted, g.total
 }
 
+// SeekTo moves the generator to the nth value, by skipping over whole
+// passes through the range until it finds the one containing that value.
+func (g *strideGenerator) SeekTo(n int64) {
+	g.emitted = n % g.total
+	n = g.emitted
+	g.current = 0
+	for start := int64(0); start < g.stride && start < g.max; start++ {
+		count := (g.max - start + g.stride - 1) / g.stride
+		if n < count {
+			g.current = start + n*g.stride
+			return
+		}
+		n -= count
+	}
+}
+
 // newStrideGenerator produces a stride generator.
 func newStrideGenerator(stride, max, total, columnOffset int64) *strideGenerator {
 	return &strideGenerator{current: 0, stride: stride, max: max, columnOffset: columnOffset, total: total}
@@ -348,6 +420,11 @@ func (g *permutedGenerator) Status() (produced, total int64) {
 	return g.current, g.total
 }
 
+// SeekTo moves the generator to the nth value.
+func (g *permutedGenerator) SeekTo(n int64) {
+	g.current = n % g.total
+}
+
 // newPermutedGenerator creates a permutedGenerator.
 func newPermutedGenerator(min, max, total, columnOffset int64, row uint32, seed int64) (*permutedGenerator, error) {
 	var err error
@@ -402,6 +479,13 @@ func (g *zipfColumnGenerator) Status() (int64, int64) {
 	return g.current, g.total
 }
 
+// SeekTo moves the generator to the nth value. The values it produces
+// depend on the field's highest column, so that has to be restored
+// separately.
+func (g *zipfColumnGenerator) SeekTo(n int64) {
+	g.current = n % g.total
+}
+
 // valueGenerator represents a thing which generates predictable values
 // for a sequence. Used for mutex/Int fields.
 type valueGenerator interface {
@@ -474,6 +558,97 @@ func (g *permutedValueGenerator) Nth(n int64) int64 {
 	return val
 }
 
+// reassignedValueGenerator moves every value produced by its base
+// generator to a different value in the same range, for reassigning
+// columns of a mutex field to new rows.
+type reassignedValueGenerator struct {
+	base         valueGenerator
+	seq          apophenia.Sequence
+	offset, span int64
+}
+
+func newReassignedValueGenerator(base valueGenerator, min, max, seed int64) *reassignedValueGenerator {
+	return &reassignedValueGenerator{base: base, seq: apophenia.NewSequence(seed), offset: min, span: max - min}
+}
+
+func (g *reassignedValueGenerator) Nth(n int64) int64 {
+	val := g.base.Nth(n) - g.offset
+	// shift by 1..span-1, so we never land on the original value.
+	shift := g.seq.BitsAt(apophenia.OffsetFor(apophenia.SequenceUser2, 0, 0, uint64(n))).Lo % uint64(g.span-1)
+	val = (val + 1 + int64(shift)) % g.span
+	return val + g.offset
+}
+
+// correlatedValueGenerator computes values from the values another
+// field's generator produces for the same columns.
+type correlatedValueGenerator struct {
+	source     valueGenerator
+	sourceMin  int64
+	spec       *correlationSpec
+	min, max   int64
+	cumulative [][]float64
+	seq        apophenia.Sequence
+}
+
+// newCorrelatedValueGenerator builds a generator for a correlated field.
+// The source field's values are regenerated using this task's seed and
+// row order, so they match the source field's data when its task uses
+// the same ones.
+func newCorrelatedValueGenerator(ts *taskSpec) (*correlatedValueGenerator, error) {
+	fs := ts.FieldSpec
+	c := fs.Correlation
+	sourceTask := *ts
+	sourceTask.FieldSpec = c.source
+	sourceTask.Operation = taskOperationSet
+	source, err := makeValueGenerator(&sourceTask)
+	if err != nil {
+		return nil, err
+	}
+	g := &correlatedValueGenerator{source: source, sourceMin: c.source.Min, spec: c, min: fs.Min, max: fs.Max, seq: apophenia.NewSequence(*ts.Seed)}
+	if c.Table != nil {
+		g.cumulative = make([][]float64, len(c.Table))
+		for i, weights := range c.Table {
+			g.cumulative[i] = make([]float64, len(weights))
+			var total float64
+			for j, w := range weights {
+				total += w
+				g.cumulative[i][j] = total
+			}
+		}
+	}
+	return g, nil
+}
+
+func (g *correlatedValueGenerator) Nth(n int64) int64 {
+	src := g.source.Nth(n)
+	// the reassign generator uses iteration 0 of this sequence class.
+	bits := g.seq.BitsAt(apophenia.OffsetFor(apophenia.SequenceUser2, 0, 1, uint64(n))).Lo
+	if g.cumulative != nil {
+		// pick a value using the weights for this source value, wrapping
+		// around if there are more source values than rows in the table.
+		weights := g.cumulative[(src-g.sourceMin)%int64(len(g.cumulative))]
+		total := weights[len(weights)-1]
+		pick := float64(bits>>11) / (1 << 53) * total
+		idx := sort.SearchFloat64s(weights, pick)
+		for idx < len(weights)-1 && weights[idx] <= pick {
+			idx++
+		}
+		return g.min + int64(idx)
+	}
+	val := src*g.spec.Multiplier/g.spec.Divisor + g.spec.Offset
+	if g.spec.Noise > 0 {
+		val += int64(bits%uint64(2*g.spec.Noise+1)) - g.spec.Noise
+	}
+	// keep values in the field's range.
+	if val < g.min {
+		val = g.min
+	}
+	if val >= g.max {
+		val = g.max - 1
+	}
+	return val
+}
+
 type singleValueGenerator struct {
 	genericGenerator
 	colGen         sequenceGenerator
@@ -514,6 +689,22 @@ func (g *singleValueGenerator) Iterate() (col int64, value int64, done bool, ok
 	}
 }
 
+// Position reports how far the generator has gotten.
+func (g *singleValueGenerator) Position() generatorPosition {
+	cols, _ := g.colGen.Status()
+	return generatorPosition{Columns: cols, Tries: g.tries, Values: g.values}
+}
+
+// SeekTo moves the generator to a previously reported position. Each try
+// takes exactly one column, so the column generator can just seek
+// to the number of tries.
+func (g *singleValueGenerator) SeekTo(pos generatorPosition) {
+	g.colGen.SeekTo(pos.Tries)
+	g.seek(pos)
+	_, cols := g.colGen.Status()
+	g.completed = pos.Tries >= cols
+}
+
 type fieldValueGenerator struct {
 	singleValueGenerator
 }
@@ -532,7 +723,7 @@ func (g *fieldValueGenerator) NextRecord() (rec pilosa.Record, err error) {
 		return nil, io.EOF
 	}
 	g.Generated(uint64(col), uint64(val))
-	return pilosa.FieldValue{ColumnID: uint64(col), Value: val}, nil
+	return g.fieldValue(uint64(col), val), nil
 }
 
 type columnValueGenerator struct {
@@ -550,7 +741,7 @@ func (g *columnValueGenerator) NextRecord() (pilosa.Record, error) {
 		return nil, io.EOF
 	}
 	g.Generated(uint64(col), uint64(val))
-	return pilosa.Column{ColumnID: uint64(col), RowID: uint64(val), Timestamp: g.LatestStamp}, nil
+	return g.column(uint64(col), uint64(val), g.LatestStamp), nil
 }
 
 type densityGenerator interface {
@@ -651,6 +842,13 @@ type doubleValueGenerator struct {
 	updateID         string
 }
 
+// Position reports how far the generator has gotten.
+func (g *doubleValueGenerator) Position() generatorPosition {
+	cols, _ := g.colGen.Status()
+	rows, _ := g.rowGen.Status()
+	return generatorPosition{Columns: cols, Rows: rows, Tries: g.tries, Values: g.values}
+}
+
 // rowMajorValueGenerator is a generator which generates values for every
 // column for each row in turn. This is usually dramatically faster with
 // Pilosa's server.
@@ -683,7 +881,7 @@ func (g *rowMajorValueGenerator) NextRecord() (pilosa.Record, error) {
 		}
 		if bit != 0 {
 			g.Generated(uint64(g.col), uint64(g.row))
-			return pilosa.Column{ColumnID: uint64(g.col), RowID: uint64(g.row), Timestamp: g.LatestStamp}, nil
+			return g.column(uint64(g.col), uint64(g.row), g.LatestStamp), nil
 		}
 
 	}
@@ -695,6 +893,25 @@ func (g *rowMajorValueGenerator) NextRecord() (pilosa.Record, error) {
 	return nil, io.EOF
 }
 
+// SeekTo moves the generator to a previously reported position. Every
+// try takes a column, and the first try in each pass over the columns
+// also takes a row, so we seek the row generator to the row before the
+// current one, and take that row again to restore its state.
+func (g *rowMajorValueGenerator) SeekTo(pos generatorPosition) {
+	g.seek(pos)
+	if pos.Tries == 0 {
+		return
+	}
+	_, cols := g.colGen.Status()
+	g.rowGen.SeekTo((pos.Tries+cols-1)/cols - 1)
+	g.row, g.rowDone = g.rowGen.Next()
+	if !g.densityPerCol {
+		g.density = g.densityGen.Density(uint64(g.col), uint64(g.row))
+	}
+	g.colGen.SeekTo(pos.Tries)
+	g.colDone = pos.Tries%cols == 0
+}
+
 // columnMajorValueGenerator is a generator which generates every row value
 // for each column in turn.
 type columnMajorValueGenerator struct {
@@ -719,7 +936,7 @@ func (g *columnMajorValueGenerator) NextRecord() (pilosa.Record, error) {
 		}
 		if bit != 0 {
 			g.Generated(uint64(g.col), uint64(g.row))
-			return pilosa.Column{ColumnID: uint64(g.col), RowID: uint64(g.row)}, nil
+			return g.column(uint64(g.col), uint64(g.row), 0), nil
 		}
 	}
 	if g.updateChan != nil {
@@ -730,6 +947,20 @@ func (g *columnMajorValueGenerator) NextRecord() (pilosa.Record, error) {
 	return nil, io.EOF
 }
 
+// SeekTo moves the generator to a previously reported position, the same
+// way rowMajorValueGenerator's SeekTo does, with rows and columns swapped.
+func (g *columnMajorValueGenerator) SeekTo(pos generatorPosition) {
+	g.seek(pos)
+	if pos.Tries == 0 {
+		return
+	}
+	_, rows := g.rowGen.Status()
+	g.colGen.SeekTo((pos.Tries+rows-1)/rows - 1)
+	g.col, g.colDone = g.colGen.Next()
+	g.rowGen.SeekTo(pos.Tries)
+	g.rowDone = pos.Tries%rows == 0
+}
+
 // genericGenerator handles shared things, like updating highest-column counts
 // for fields, or generating timestamps.
 type genericGenerator struct {
@@ -744,6 +975,8 @@ type genericGenerator struct {
 	tries        int64
 	expected     int64
 	overran      sync.Once
+	columnKeys   *keyGenerator
+	rowKeys      *keyGenerator
 }
 
 // Prepare initializes a generator, doing bookkeeping like finding the right
@@ -762,10 +995,10 @@ func (g *genericGenerator) Prepare(ts *taskSpec, cols, rows int64) {
 			g.FieldSpec.HighestColumn = g.ColumnOffset + cols
 		}
 	}
+	g.expected = cols * rows
 	g.Stamp = ts.Stamp
 	if g.Stamp != stampTypeNone {
 		g.FirstStamp = ts.StampStart.UnixNano()
-		g.expected = cols * rows
 		if g.expected > int64(*ts.StampRange) {
 			fmt.Printf("warning: %d values in a range of %v, more than 1/ns", g.expected, *ts.StampRange)
 			g.StampStep = 1
@@ -804,53 +1037,203 @@ func (g *genericGenerator) Values() (int64, int64) {
 	return g.values, g.tries
 }
 
-// fastValueGenerator produces
+// Progress reports the number of positions tried so far, and the
+// number which will be tried in total.
+func (g *genericGenerator) Progress() (int64, int64) {
+	return g.tries, g.expected
+}
+
+// seek restores the shared counters from a previously reported
+// position. Random stamps take one value from their sequence for each
+// value generated, so their sequence can be moved ahead to match.
+func (g *genericGenerator) seek(pos generatorPosition) {
+	g.tries, g.values = pos.Tries, pos.Values
+	if g.Stamp == stampTypeRandom {
+		g.stampGen.Seek(apophenia.OffsetFor(apophenia.SequenceLinear, 0, 0, uint64(pos.Values)))
+	}
+}
+
+// prepareKeys sets up key generators for a task whose index or field uses
+// string keys.
+func (g *genericGenerator) prepareKeys(ts *taskSpec) (err error) {
+	fs := ts.FieldSpec
+	is := fs.Parent
+	if is != nil && is.Keys {
+		g.columnKeys, err = newColumnKeyGenerator(is)
+		if err != nil {
+			return err
+		}
+	}
+	if fs.Keys {
+		g.rowKeys, err = newRowKeyGenerator(fs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newColumnKeyGenerator creates the key generator for an index's columns.
+func newColumnKeyGenerator(is *indexSpec) (*keyGenerator, error) {
+	// 3 and 4 are arbitrary magic numbers; 0, 1, and 2 are used
+	// for other permutation sequences.
+	return newKeyGenerator(is.KeyTemplate, is.KeyOrder, 0, int64(is.Columns), *is.Seed, 3)
+}
+
+// newRowKeyGenerator creates the key generator for a field's rows. It
+// uses the index's seed, not the task's, so every task writing to a field
+// agrees on what each row is called.
+func newRowKeyGenerator(fs *fieldSpec) (*keyGenerator, error) {
+	var seed int64
+	if fs.Parent != nil && fs.Parent.Seed != nil {
+		seed = *fs.Parent.Seed
+	}
+	return newKeyGenerator(fs.KeyTemplate, fs.KeyOrder, fs.Min, fs.Max, seed, 4)
+}
+
+// column builds a pilosa.Column, filling in keys if they're in use.
+func (g *genericGenerator) column(col, row uint64, stamp int64) pilosa.Column {
+	c := pilosa.Column{ColumnID: col, RowID: row, Timestamp: stamp}
+	if g.columnKeys != nil {
+		c.ColumnKey = g.columnKeys.Key(int64(col))
+	}
+	if g.rowKeys != nil {
+		c.RowKey = g.rowKeys.Key(int64(row))
+	}
+	return c
+}
+
+// fieldValue builds a pilosa.FieldValue, filling in a column key if the
+// index uses them.
+func (g *genericGenerator) fieldValue(col uint64, val int64) pilosa.FieldValue {
+	v := pilosa.FieldValue{ColumnID: col, Value: val}
+	if g.columnKeys != nil {
+		v.ColumnKey = g.columnKeys.Key(int64(col))
+	}
+	return v
+}
+
+// keyGenerator turns integer IDs into string keys. The same ID always
+// produces the same key, so keyed data is exactly as reproducible as
+// unkeyed data. With a permutation, IDs are shuffled within each block of
+// the ID range before formatting, so keys don't sort the same way IDs do.
+type keyGenerator struct {
+	template    string
+	permutation *apophenia.Permutation
+	min, span   int64
+}
+
+// newKeyGenerator creates a keyGenerator for IDs in [min,max).
+func newKeyGenerator(template string, order valueOrder, min, max, seed int64, row uint32) (*keyGenerator, error) {
+	var err error
+	g := &keyGenerator{template: template, min: min, span: max - min}
+	if order == valueOrderPermute {
+		g.permutation, err = apophenia.NewPermutation(g.span, row, apophenia.NewSequence(seed))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Key returns the key for the given ID.
+func (g *keyGenerator) Key(id int64) string {
+	if g.permutation != nil && id >= g.min {
+		// IDs past the end of the range (possible with appends) are
+		// permuted within their own block, so keys stay unique.
+		n := id - g.min
+		block := n - (n % g.span)
+		id = g.permutation.Nth(n%g.span) + block + g.min
+	}
+	return fmt.Sprintf(g.template, id)
+}
+
+// fastValueGenerator produces sparse set data quickly, a row at a time,
+// without trying every position. Each row gets a number of bits from a
+// Zipf distribution, totalling one bit per column of the task, placed at
+// increasing columns with random gaps of up to 1/density. The gaps come
+// from the task's seed, and the bits only go in the task's own columns,
+// so a task always produces the same bits, and split tasks each produce
+// their own part of the data. If the index has uniqueColumns set, only
+// that many of its columns, spread pseudo-randomly across it, get bits,
+// and a task produces one bit for each of those in its range.
 type fastValueGenerator struct {
-	bitsPerRow        []int64
-	nextBitIndex      int64
-	rowIndex          int64
-	rowBitCount       int64
-	rowIDMin          int64
-	rowIDMax          int64
-	randGen           *rand.Rand
-	shardWidth        uint64
-	maxBitsPerShard   uint64
-	maxColumnDistance int64
-	lastColumnId      uint64
-}
-
-func newFastValueGenerator(fs *fieldSpec) *fastValueGenerator {
-	rowCount := fs.Max - fs.Min
-	randSeed := int64(0)
-	totalBitCount := int64(fs.Parent.Columns)
-	bitsPerRow := make([]int64, rowCount)
-	if randSeed == 0 {
-		randSeed = int64(time.Now().Nanosecond())
+	genericGenerator
+	seq        apophenia.Sequence
+	uniqueSeq  apophenia.Sequence
+	bitsPerRow []int64
+	rowIDMin   int64
+	rowIndex   int64 // current row, relative to rowIDMin
+	rowBits    int64 // bits produced so far in the current row
+	slot       int64 // slot of the latest bit in the current row, or -1
+	slots      int64 // columns, or unique columns, in the task's range
+	firstSlot  uint64
+	maxGap     int64
+	unique     uint64 // the index's unique columns, or 0 to use all of them
+	columns    uint64 // the index's columns
+	updateChan chan taskUpdate
+	updateID   string
+}
+
+func newFastValueGenerator(ts *taskSpec, updateChan chan taskUpdate, updateID string) (*fastValueGenerator, error) {
+	fs := ts.FieldSpec
+	g := &fastValueGenerator{
+		seq:        apophenia.NewSequence(*ts.Seed),
+		rowIDMin:   fs.Min,
+		slot:       -1,
+		unique:     fs.Parent.UniqueColumns,
+		columns:    fs.Parent.Columns,
+		updateChan: updateChan,
+		updateID:   updateID,
+	}
+	if err := g.prepareKeys(ts); err != nil {
+		return nil, err
 	}
-	shardWidth := fs.Parent.ShardWidth
-	if shardWidth == 0 {
-		shardWidth = 1 << 20
+	// the bits go in the task's columns, which only have a known offset
+	// once Prepare has handled appends.
+	cols := int64(*ts.Columns)
+	g.Prepare(ts, cols, 1)
+	if g.unique == 0 {
+		g.firstSlot = uint64(g.ColumnOffset)
+		g.slots = cols
+	} else {
+		// every task uses the same unique columns, so they come from
+		// the index's seed, not the task's.
+		g.uniqueSeq = apophenia.NewSequence(*fs.Parent.Seed)
+		g.firstSlot = g.firstUnique(uint64(g.ColumnOffset))
+		g.slots = int64(g.firstUnique(uint64(g.ColumnOffset+cols)) - g.firstSlot)
 	}
+	g.expected = g.slots
 	density := fs.Density
-	if density <= 0 {
+	if density <= 0 || density > 1 {
 		density = 1
 	}
-	maxBitsPerShard := uint64(math.Ceil(float64(shardWidth) * density))
-	maxColumnDistance := int64(math.Floor(1 / density))
-	if maxColumnDistance == 0 {
-		maxColumnDistance = 1
-	}
+	g.maxGap = int64(math.Floor(1 / density))
+	g.bitsPerRow = fastSparseRowBits(fs.ZipfA, fs.Max-fs.Min, g.slots)
+	return g, nil
+}
 
-	randGen := rand.New(rand.NewSource(randSeed))
-	z := newZipf(fs.ZipfA, int(totalBitCount/rowCount))
+// fastSparseRowBits divides total bits among rows, following a Zipf
+// distribution with parameter a.
+func fastSparseRowBits(a float64, rowCount, total int64) []int64 {
+	bitsPerRow := make([]int64, rowCount)
+	if rowCount <= 0 {
+		return bitsPerRow
+	}
+	totalBitCount := total
+	n := int(total / rowCount)
+	if n < 1 {
+		n = 1
+	}
+	z := newZipf(a, n)
 
 	for rowIndex := 0; rowIndex < int(rowCount); rowIndex++ {
-		bitCount := int64(1 + z.F(rowIndex+1)*float64(totalBitCount))
+		bitCount := int64(1 + z.F(rowIndex+1)*float64(total))
 		bitsPerRow[rowIndex] += bitCount
 		totalBitCount -= bitCount
 	}
 
-	// add or remove bits so there are exactly fs.Parent.Columns bits
+	// add or remove bits so there are exactly total bits
 	step := int64(1)
 	if totalBitCount < 0 {
 		step = -1
@@ -858,6 +1241,9 @@ func newFastValueGenerator(fs *fieldSpec) *fastValueGenerator {
 	}
 	for totalBitCount > 0 {
 		for i := 0; i < int(rowCount); i++ {
+			if bitsPerRow[i]+step < 0 {
+				continue
+			}
 			bitsPerRow[i] += step
 			totalBitCount -= 1
 			if totalBitCount <= 0 {
@@ -865,37 +1251,105 @@ func newFastValueGenerator(fs *fieldSpec) *fastValueGenerator {
 			}
 		}
 	}
+	return bitsPerRow
+}
+
+// uniqueStart computes the first column of the range in which unique
+// column u falls. The index's columns are divided evenly among its unique
+// columns, and columns past the end of the index, such as appended ones,
+// repeat the same pattern.
+func (g *fastValueGenerator) uniqueStart(u uint64) uint64 {
+	block, r := u/g.unique, u%g.unique
+	hi, lo := bits.Mul64(r, g.columns)
+	q, _ := bits.Div64(hi, lo, g.unique)
+	return block*g.columns + q
+}
+
+// firstUnique finds the first unique column whose range starts at or
+// after col.
+func (g *fastValueGenerator) firstUnique(col uint64) uint64 {
+	block, r := col/g.columns, col%g.columns
+	hi, lo := bits.Mul64(r, g.unique)
+	q, rem := bits.Div64(hi, lo, g.columns)
+	if rem != 0 {
+		q++
+	}
+	return block*g.unique + q
+}
 
-	return &fastValueGenerator{
-		bitsPerRow:        bitsPerRow,
-		rowIDMin:          fs.Min,
-		randGen:           randGen,
-		maxBitsPerShard:   maxBitsPerShard,
-		maxColumnDistance: maxColumnDistance,
+// slotColumn computes the column for a slot in the task's range.
+func (g *fastValueGenerator) slotColumn(slot int64) uint64 {
+	if g.unique == 0 {
+		return g.firstSlot + uint64(slot)
 	}
+	u := g.firstSlot + uint64(slot)
+	start := g.uniqueStart(u)
+	width := g.uniqueStart(u+1) - start
+	offset := apophenia.OffsetFor(apophenia.SequenceUser2, 0, 3, u)
+	return start + g.uniqueSeq.BitsAt(offset).Lo%width
 }
 
-func (g *fastValueGenerator) NextRecord() (pilosa.Record, error) {
+// advance moves to the next bit, returning false when there are no more.
+// The gap before each bit is limited so the rest of the row's bits still
+// fit in the task's range.
+func (g *fastValueGenerator) advance() bool {
 	for {
 		if g.rowIndex >= int64(len(g.bitsPerRow)) {
-			return nil, io.EOF
+			return false
 		}
-		if g.rowBitCount >= g.bitsPerRow[g.rowIndex] {
-			g.rowIndex += 1
-			g.rowBitCount = 0
-			g.lastColumnId = 0
-			continue
+		if g.rowBits < g.bitsPerRow[g.rowIndex] {
+			break
 		}
-		break
+		g.rowIndex++
+		g.rowBits = 0
+		g.slot = -1
+	}
+	limit := g.slots - g.bitsPerRow[g.rowIndex] + g.rowBits - g.slot
+	if limit > g.maxGap {
+		limit = g.maxGap
 	}
-	g.lastColumnId += uint64(g.randGen.Int63n(g.maxColumnDistance)) + 1
-	g.rowBitCount += 1
-	g.nextBitIndex += 1
-	return pilosa.Column{RowID: uint64(g.rowIDMin + g.rowIndex), ColumnID: g.lastColumnId}, nil
+	offset := apophenia.OffsetFor(apophenia.SequenceUser1, uint32(g.rowIndex), 2, g.firstSlot+uint64(g.rowBits))
+	g.slot += 1 + int64(g.seq.BitsAt(offset).Lo%uint64(limit))
+	g.rowBits++
+	return true
 }
 
-func (g *fastValueGenerator) Values() (int64, int64) {
-	return g.nextBitIndex, g.nextBitIndex
+func (g *fastValueGenerator) NextRecord() (pilosa.Record, error) {
+	if !g.advance() {
+		if g.updateChan != nil {
+			g.updateChan <- taskUpdate{id: g.updateID, colCount: g.tries, rowCount: g.rowIndex, done: true}
+		}
+		return nil, io.EOF
+	}
+	g.tries++
+	if g.updateChan != nil && g.tries%updatePeriod == 0 {
+		g.updateChan <- taskUpdate{id: g.updateID, colCount: g.tries, rowCount: g.rowIndex, done: false}
+	}
+	col, row := g.slotColumn(g.slot), uint64(g.rowIDMin+g.rowIndex)
+	g.Generated(col, row)
+	return g.column(col, row, g.LatestStamp), nil
+}
+
+// Position reports how far the generator has gotten. Every try produces
+// a bit.
+func (g *fastValueGenerator) Position() generatorPosition {
+	return generatorPosition{Columns: g.tries, Rows: g.rowIndex, Tries: g.tries, Values: g.values}
+}
+
+// SeekTo moves the generator to a previously reported position. Whole
+// rows are skipped by their bit counts, but within a row, each bit's
+// column depends on the previous one, so those are generated again.
+func (g *fastValueGenerator) SeekTo(pos generatorPosition) {
+	g.seek(pos)
+	g.rowIndex, g.rowBits, g.slot = 0, 0, -1
+	n := pos.Values
+	for g.rowIndex < int64(len(g.bitsPerRow)) && n >= g.bitsPerRow[g.rowIndex] {
+		n -= g.bitsPerRow[g.rowIndex]
+		g.rowIndex++
+	}
+	for ; n > 0; n-- {
+		g.advance()
+	}
 }
 
 // see: https://www.statisticshowto.datasciencecentral.com/zeta-distribution-zipf/
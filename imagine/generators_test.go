@@ -73,12 +73,15 @@ func Test_Generators(t *testing.T) {
 func float64p(v float64) *float64 {
 	return &v
 }
+
 func uint64p(v uint64) *uint64 {
 	return &v
 }
+
 func int64p(v int64) *int64 {
 	return &v
 }
+
 func durationp(v duration) *duration {
 	return &v
 }
@@ -249,3 +252,308 @@ func TestMutexGen(t *testing.T) {
 	}
 
 }
+
+func TestKeyedMutexGen(t *testing.T) {
+	index := &indexSpec{
+		Columns:     10,
+		Seed:        int64p(0),
+		Keys:        true,
+		KeyTemplate: "user-%d",
+	}
+	spec := &taskSpec{
+		FieldSpec: &fieldSpec{
+			Parent:       index,
+			Type:         fieldTypeMutex,
+			Max:          4,
+			Chance:       float64p(1.0),
+			DensityScale: uint64p(2097152),
+			Density:      1.0,
+			Keys:         true,
+			KeyTemplate:  "color-%d",
+			KeyOrder:     valueOrderPermute,
+		},
+		ColumnOrder:    valueOrderLinear,
+		DimensionOrder: dimensionOrderRow,
+		Columns:        uint64p(10),
+		RowOrder:       valueOrderLinear,
+		Seed:           int64p(0),
+	}
+	sg, err := newMutexGenerator(spec, nil, "updateid")
+	if err != nil {
+		t.Fatalf("getting new mutex generator: %v", err)
+	}
+	rowKeys := make(map[uint64]string)
+	seenKeys := make(map[string]uint64)
+	for r, err := sg.NextRecord(); err != io.EOF; r, err = sg.NextRecord() {
+		if err != nil {
+			t.Fatalf("error in iterator: %v", err)
+		}
+		col, ok := r.(gopilosa.Column)
+		if !ok {
+			t.Fatalf("%v not a Column", r)
+		}
+		if exp := fmt.Sprintf("user-%d", col.ColumnID); col.ColumnKey != exp {
+			t.Fatalf("column %d: expected key %q, got %q", col.ColumnID, exp, col.ColumnKey)
+		}
+		if prev, ok := rowKeys[col.RowID]; ok && prev != col.RowKey {
+			t.Fatalf("row %d: inconsistent keys %q and %q", col.RowID, prev, col.RowKey)
+		}
+		if prev, ok := seenKeys[col.RowKey]; ok && prev != col.RowID {
+			t.Fatalf("key %q: used for rows %d and %d", col.RowKey, prev, col.RowID)
+		}
+		rowKeys[col.RowID] = col.RowKey
+		seenKeys[col.RowKey] = col.RowID
+	}
+	if len(rowKeys) == 0 {
+		t.Fatalf("no records generated")
+	}
+}
+
+func TestReassignedValueGenerator(t *testing.T) {
+	base, err := newLinearValueGenerator(3, 8, 0)
+	if err != nil {
+		t.Fatalf("creating value generator: %v", err)
+	}
+	reassigned := newReassignedValueGenerator(base, 3, 8, 0)
+	moved := make(map[int64]struct{})
+	for i := int64(0); i < 1000; i++ {
+		orig, val := base.Nth(i), reassigned.Nth(i)
+		if val == orig {
+			t.Fatalf("value %d: not reassigned from %d", i, orig)
+		}
+		if val < 3 || val >= 8 {
+			t.Fatalf("value %d: reassigned to %d, out of range 3..8", i, val)
+		}
+		if again := reassigned.Nth(i); again != val {
+			t.Fatalf("value %d: reassigned to %d, then %d", i, val, again)
+		}
+		moved[val-orig] = struct{}{}
+	}
+	if len(moved) < 2 {
+		t.Fatalf("expected values to move by varying amounts, got %v", moved)
+	}
+}
+
+func TestGeneratorSeekTo(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	specs := map[string]*taskSpec{
+		"row-major": {
+			FieldSpec:      &fieldSpec{Type: fieldTypeSet, Max: 7, Chance: float64p(1.0), DensityScale: uint64p(2097152), Density: 0.5},
+			ColumnOrder:    valueOrderStride,
+			Stride:         3,
+			DimensionOrder: dimensionOrderRow,
+			RowOrder:       valueOrderPermute,
+			Stamp:          stampTypeRandom,
+			StampStart:     &start,
+			StampRange:     durationp(duration(time.Hour)),
+		},
+		"column-major": {
+			FieldSpec:      &fieldSpec{Type: fieldTypeSet, Max: 7, Chance: float64p(0.5), DensityScale: uint64p(2097152), Density: 0.5},
+			ColumnOrder:    valueOrderPermute,
+			DimensionOrder: dimensionOrderColumn,
+			RowOrder:       valueOrderLinear,
+		},
+		"mutex": {
+			FieldSpec:      &fieldSpec{Type: fieldTypeMutex, Max: 7, Chance: float64p(1.0), DensityScale: uint64p(2097152), Density: 0.7},
+			ColumnOrder:    valueOrderLinear,
+			DimensionOrder: dimensionOrderRow,
+			RowOrder:       valueOrderPermute,
+			Stamp:          stampTypeIncreasing,
+			StampStart:     &start,
+			StampRange:     durationp(duration(time.Hour)),
+		},
+		"int": {
+			FieldSpec:   &fieldSpec{Type: fieldTypeInt, Min: -5, Max: 20, Chance: float64p(1.0), DensityScale: uint64p(2097152), Density: 1.0},
+			ColumnOrder: valueOrderStride,
+			Stride:      4,
+			RowOrder:    valueOrderLinear,
+		},
+		"fast-sparse": {
+			FieldSpec: &fieldSpec{Type: fieldTypeSet, Max: 7, FastSparse: true, ZipfA: 1.0, Density: 0.5},
+		},
+	}
+	for name, spec := range specs {
+		spec.FieldSpec.Parent = &indexSpec{Columns: 50}
+		spec.Columns = uint64p(50)
+		spec.Seed = int64p(1)
+		spec.Parent = &workloadSpec{}
+		gen := func() CountingIterator {
+			itr, _, err := NewGenerator(spec, nil, "")
+			if err != nil {
+				t.Fatalf("%s: creating generator: %v", name, err)
+			}
+			return itr
+		}
+		itr := gen()
+		var recs []gopilosa.Record
+		var positions []generatorPosition
+		for rec, err := itr.NextRecord(); err != io.EOF; rec, err = itr.NextRecord() {
+			if err != nil {
+				t.Fatalf("%s: generating: %v", name, err)
+			}
+			recs = append(recs, rec)
+			positions = append(positions, itr.(seekableGenerator).Position())
+		}
+		if len(recs) < 10 {
+			t.Fatalf("%s: only generated %d records", name, len(recs))
+		}
+		for i := 0; i < len(recs); i += 3 {
+			resumed := gen()
+			resumed.(seekableGenerator).SeekTo(positions[i])
+			j := i + 1
+			for rec, err := resumed.NextRecord(); err != io.EOF; rec, err = resumed.NextRecord() {
+				if err != nil {
+					t.Fatalf("%s: generating after seek: %v", name, err)
+				}
+				if j >= len(recs) {
+					t.Fatalf("%s: after seeking to record %d, got extra record %v", name, i, rec)
+				}
+				if rec != recs[j] {
+					t.Fatalf("%s: after seeking to record %d, record %d: got %v, expected %v", name, i, j, rec, recs[j])
+				}
+				j++
+			}
+			if j != len(recs) {
+				t.Fatalf("%s: after seeking to record %d, got %d records, expected %d", name, i, j, len(recs))
+			}
+		}
+	}
+}
+
+func TestCorrelatedFields(t *testing.T) {
+	is := &indexSpec{Columns: 5000}
+	city := &fieldSpec{Name: "city", Type: fieldTypeMutex, Max: 100, Density: 0.8, DensityScale: uint64p(2097152), Chance: float64p(1.0)}
+	country := &fieldSpec{Name: "country", Type: fieldTypeMutex, Max: 10, Chance: float64p(1.0),
+		Correlation: &correlationSpec{Field: "city", Divisor: 10}}
+	age := &fieldSpec{Name: "age", Type: fieldTypeInt, Min: 0, Max: 200, Density: 1.0, DensityScale: uint64p(2097152), Chance: float64p(1.0),
+		Correlation: &correlationSpec{Field: "country", Multiplier: 10, Offset: 5, Noise: 3}}
+	school := &fieldSpec{Name: "school", Type: fieldTypeMutex, Max: 3, Density: 1.0, DensityScale: uint64p(2097152), Chance: float64p(1.0),
+		Correlation: &correlationSpec{Field: "country", Table: [][]float64{{1, 0, 0}, {0, 1, 3}}}}
+	is.Fields = []*fieldSpec{city, country, age, school}
+	is.FieldsByName = make(map[string]*fieldSpec)
+	for _, fs := range is.Fields {
+		fs.Parent = is
+		is.FieldsByName[fs.Name] = fs
+	}
+	for _, fs := range is.Fields {
+		if err := fs.cleanupCorrelation(); err != nil {
+			t.Fatalf("%s: %v", fs.Name, err)
+		}
+	}
+	values := make(map[string]map[uint64]int64)
+	for _, fs := range is.Fields {
+		spec := &taskSpec{FieldSpec: fs, Parent: &workloadSpec{}, Columns: uint64p(5000), Seed: int64p(3), RowOrder: valueOrderPermute}
+		itr, _, err := NewGenerator(spec, nil, "")
+		if err != nil {
+			t.Fatalf("%s: creating generator: %v", fs.Name, err)
+		}
+		values[fs.Name] = make(map[uint64]int64)
+		for rec, err := itr.NextRecord(); err != io.EOF; rec, err = itr.NextRecord() {
+			if err != nil {
+				t.Fatalf("%s: generating: %v", fs.Name, err)
+			}
+			switch r := rec.(type) {
+			case gopilosa.Column:
+				values[fs.Name][r.ColumnID] = int64(r.RowID)
+			case gopilosa.FieldValue:
+				values[fs.Name][r.ColumnID] = r.Value
+			}
+		}
+	}
+	if len(values["country"]) != len(values["city"]) {
+		t.Fatalf("expected country to have values in the same %d columns as city, got %d", len(values["city"]), len(values["country"]))
+	}
+	schools := make(map[int64]int)
+	for col, c := range values["city"] {
+		country, ok := values["country"][col]
+		if !ok || country != c/10 {
+			t.Fatalf("column %d: city %d, expected country %d, got %d (%t)", col, c, c/10, country, ok)
+		}
+		age := values["age"][col]
+		if age < country*10+5-3 || age > country*10+5+3 {
+			t.Fatalf("column %d: country %d, age %d out of range", col, country, age)
+		}
+		school := values["school"][col]
+		if country%2 == 0 && school != 0 || country%2 == 1 && school == 0 {
+			t.Fatalf("column %d: country %d, unexpected school %d", col, country, school)
+		}
+		schools[school]++
+	}
+	if schools[2] < 2*schools[1] {
+		t.Fatalf("expected school 2 to be about three times as common as school 1, got %v", schools)
+	}
+}
+
+func TestFastSparseGenerator(t *testing.T) {
+	newGen := func(unique uint64, seed int64, offset, columns uint64) *fastValueGenerator {
+		is := &indexSpec{Columns: 10000, UniqueColumns: unique, Seed: int64p(7)}
+		fs := &fieldSpec{Type: fieldTypeSet, Max: 20, FastSparse: true, ZipfA: 1.0, Density: 0.25, Parent: is}
+		ts := &taskSpec{FieldSpec: fs, Parent: &workloadSpec{}, Columns: uint64p(columns), ColumnOffset: columnOffset(offset), Seed: int64p(seed)}
+		itr, _, err := NewGenerator(ts, nil, "")
+		if err != nil {
+			t.Fatalf("creating generator: %v", err)
+		}
+		return itr.(*fastValueGenerator)
+	}
+	generate := func(unique uint64, seed int64, offset, columns uint64) []gopilosa.Column {
+		itr := newGen(unique, seed, offset, columns)
+		var cols []gopilosa.Column
+		for rec, err := itr.NextRecord(); err != io.EOF; rec, err = itr.NextRecord() {
+			if err != nil {
+				t.Fatalf("generating: %v", err)
+			}
+			cols = append(cols, rec.(gopilosa.Column))
+		}
+		return cols
+	}
+	a, b, c := generate(0, 1, 0, 10000), generate(0, 1, 0, 10000), generate(0, 2, 0, 10000)
+	if len(a) != 10000 || len(c) != 10000 {
+		t.Fatalf("expected one bit per column, got %d and %d", len(a), len(c))
+	}
+	same := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed, bit %d: got %v and %v", i, a[i], b[i])
+		}
+		if a[i] == c[i] {
+			same++
+		}
+	}
+	if same == len(a) {
+		t.Fatalf("different seeds produced the same bits")
+	}
+	// the unique columns are the same for every task.
+	all := newGen(500, 1, 0, 10000)
+	uniqueCols := make(map[uint64]struct{})
+	for slot := int64(0); slot < all.slots; slot++ {
+		uniqueCols[all.slotColumn(slot)] = struct{}{}
+	}
+	if len(uniqueCols) != 500 {
+		t.Fatalf("expected 500 unique columns, got %d", len(uniqueCols))
+	}
+	for _, unique := range []uint64{0, 500} {
+		total := 0
+		for _, piece := range [][2]uint64{{0, 3000}, {3000, 7000}} {
+			cols := generate(unique, int64(piece[0]), piece[0], piece[1])
+			total += len(cols)
+			for i, col := range cols {
+				if unique == 0 && (col.ColumnID < piece[0] || col.ColumnID >= piece[0]+piece[1]) {
+					t.Fatalf("piece %v: column %d out of range", piece, col.ColumnID)
+				}
+				if _, ok := uniqueCols[col.ColumnID]; unique != 0 && !ok {
+					t.Fatalf("piece %v: column %d isn't one of the unique columns", piece, col.ColumnID)
+				}
+				if i > 0 && col.RowID == cols[i-1].RowID && col.ColumnID <= cols[i-1].ColumnID {
+					t.Fatalf("unique %d, piece %v: columns not increasing: %v, %v", unique, piece, cols[i-1], col)
+				}
+			}
+		}
+		expected := 10000
+		if unique != 0 {
+			expected = int(unique)
+		}
+		if total != expected {
+			t.Fatalf("unique %d: expected %d bits from split tasks, got %d", unique, expected, total)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package imagine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// varPattern matches variable references in spec files, like ${columns}.
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// varNamePattern matches valid variable names.
+var varNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// specHeader holds the parts of a spec which have to be read before
+// variables can be substituted into it. It's decoded from the spec with
+// every variable reference replaced by a placeholder, so the spec is still
+// valid TOML; the values of variables can't refer to other variables.
+type specHeader struct {
+	Include []string
+	Vars    map[string]interface{}
+}
+
+// specReader reads spec files, substituting variables and following
+// includes. Each file is read only once, the first time it's named, so
+// a file that's included by several specs, or included and also given on
+// the command line, only contributes its indexes and workloads once.
+type specReader struct {
+	set     map[string]string // overrides from the command line
+	used    map[string]bool   // variables declared or referred to by any spec
+	read    map[string]bool   // absolute paths of files already read
+	reading []string          // files currently being read, to detect cycles
+}
+
+func newSpecReader(set map[string]string) *specReader {
+	return &specReader{set: set, used: make(map[string]bool), read: make(map[string]bool)}
+}
+
+// readSpecs reads the spec at path, and the specs it includes, returning
+// the included specs first, in the order they're listed. inherited holds
+// the variables of the including spec, or the command line's overrides
+// for a top-level spec; they take precedence over the spec's own.
+func (r *specReader) readSpecs(path string, inherited map[string]string) ([]*tomlSpec, error) {
+	return r.readSpecData(path, nil, inherited)
+}
+
+// readSpecData reads a spec from data, as if it were in a file at path,
+// so its includes are relative to path's directory. If data is nil, it
+// reads the file.
+func (r *specReader) readSpecData(path string, data []byte, inherited map[string]string) ([]*tomlSpec, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range r.reading {
+		if p == abs {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(r.reading[i:], " -> "), abs)
+		}
+	}
+	if r.read[abs] {
+		// a file named again is the same file, but a spec given as data
+		// may just share another one's name.
+		if data != nil {
+			return nil, fmt.Errorf("another spec was already read as '%s'", path)
+		}
+		return nil, nil
+	}
+	r.read[abs] = true
+	if data == nil {
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var header specHeader
+	_, err = toml.Decode(varPattern.ReplaceAllString(string(data), "1"), &header)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(header.Vars)+len(inherited))
+	for name, value := range header.Vars {
+		if !varNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid variable name '%s'", name)
+		}
+		vars[name], err = varString(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "variable '%s'", name)
+		}
+		r.used[name] = true
+	}
+	for name, value := range inherited {
+		vars[name] = value
+	}
+	var undefined []string
+	expanded := varPattern.ReplaceAllStringFunc(string(data), func(ref string) string {
+		name := varPattern.FindStringSubmatch(ref)[1]
+		r.used[name] = true
+		value, ok := vars[name]
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		return nil, fmt.Errorf("undefined variables: %s", strings.Join(undefined, ", "))
+	}
+	ts, err := decodeSpec(path, expanded)
+	if err != nil {
+		return nil, err
+	}
+	var specs []*tomlSpec
+	r.reading = append(r.reading, abs)
+	defer func() { r.reading = r.reading[:len(r.reading)-1] }()
+	for _, include := range ts.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := r.readSpecs(include, vars)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read spec '%s', included from '%s': %v", include, path, err)
+		}
+		specs = append(specs, included...)
+	}
+	return append(specs, ts), nil
+}
+
+// unusedSets reports variables set on the command line which no spec
+// declares or refers to, which are probably typos.
+func (r *specReader) unusedSets() error {
+	var unused []string
+	for name := range r.set {
+		if !r.used[name] {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	sort.Strings(unused)
+	return fmt.Errorf("variables set but not used by any spec: %s", strings.Join(unused, ", "))
+}
+
+// varString converts a variable's value to the text substituted for it.
+// Strings are substituted without quotes, so they can be used in the
+// middle of other strings. Floats always get a decimal point, because
+// float settings don't accept integers.
+func varString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		return "", fmt.Errorf("must be a string, number, boolean, or date, not %T", value)
+	}
+}
+
+// parseSets parses name=value overrides from the command line.
+func parseSets(sets []string) (map[string]string, error) {
+	vars := make(map[string]string, len(sets))
+	for _, set := range sets {
+		eq := strings.IndexByte(set, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("variable setting '%s' should be name=value", set)
+		}
+		name := set[:eq]
+		if !varNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid variable name '%s'", name)
+		}
+		vars[name] = set[eq+1:]
+	}
+	return vars, nil
+}
@@ -0,0 +1,88 @@
+package imagine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpecIncludesAndVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagine-include")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"base.toml": `version = "1.0"
+vars = { columns = 1000, name = "users", density = 1.0 }
+[indexes.${name}]
+columns = ${columns}
+fields = [{ name = "f", type = "mutex", max = 3, density = ${density} }]
+`,
+		"main.toml": `version = "1.0"
+include = ["base.toml"]
+[vars]
+name = "people"
+[[workloads]]
+name = "load-${name}"
+tasks = [{ index = "${name}", field = "f" }]
+`,
+		"both.toml": `version = "1.0"
+include = ["main.toml", "base.toml"]
+`,
+		"cycle.toml": `version = "1.0"
+include = ["cycle2.toml"]
+`,
+		"cycle2.toml": `version = "1.0"
+include = ["cycle.toml"]
+`,
+		"undefined.toml": `version = "1.0"
+prefix = "${missing}"
+`,
+		"badkey.toml": `version = "1.0"
+vars = { key = "seeed" }
+${key} = 3
+`,
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+	specs, err := ReadSpec(filepath.Join(dir, "main.toml"), map[string]string{"columns": "500"})
+	if err != nil {
+		t.Fatalf("reading main: %v", err)
+	}
+	if len(specs) != 2 || specs[1].PathName != filepath.Join(dir, "main.toml") {
+		t.Fatalf("expected base and main specs, got %d", len(specs))
+	}
+	index := specs[0].Indexes["people"]
+	if index == nil || index.Columns != 500 || index.Fields[0].Density != 1.0 {
+		t.Fatalf("expected included index 'people' with 500 columns, got %#v", specs[0].Indexes)
+	}
+	if specs[1].Workloads[0].Name != "load-people" {
+		t.Fatalf("expected workload 'load-people', got %q", specs[1].Workloads[0].Name)
+	}
+	specs, err = ReadSpec(filepath.Join(dir, "both.toml"), nil)
+	if err != nil || len(specs) != 3 {
+		t.Fatalf("expected each file once, got %d specs, error %v", len(specs), err)
+	}
+	for name, expected := range map[string]string{
+		"cycle.toml":     "include cycle",
+		"undefined.toml": "undefined variables: missing",
+		"badkey.toml":    "undecoded keys: seeed",
+	} {
+		_, err := ReadSpec(filepath.Join(dir, name), nil)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", name, expected, err)
+		}
+	}
+	conf := NewConfig()
+	conf.vars = map[string]string{"colums": "5"}
+	conf.NewSpecsFiles([]string{filepath.Join(dir, "main.toml")})
+	if err := conf.ReadSpecs(); err == nil || !strings.Contains(err.Error(), "colums") {
+		t.Errorf("expected error for unused variable, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package imagine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// journalEntry records how far a task got. Entries are written as lines
+// of JSON, and the last entry for a task is the one that counts.
+type journalEntry struct {
+	Task          string `json:"task"`
+	Columns       int64  `json:"columns"`
+	Rows          int64  `json:"rows"`
+	Tries         int64  `json:"tries"`
+	Values        int64  `json:"values"`
+	HighestColumn int64  `json:"highestColumn"`
+	Done          bool   `json:"done"`
+}
+
+// journal tracks the progress of every task in a run, so that if the run
+// is interrupted, it can be resumed without redoing finished work.
+type journal struct {
+	mu      sync.Mutex
+	f       *os.File
+	entries map[string]journalEntry
+}
+
+// openJournal opens a journal file. When resuming, it reads the existing
+// entries, if any, and appends to the file; otherwise, it starts over.
+func openJournal(path string, resume bool) (*journal, error) {
+	j := &journal{entries: make(map[string]journalEntry)}
+	if !resume {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating journal")
+		}
+		j.f = f
+		return j, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening journal")
+	}
+	j.f = f
+	scanner := bufio.NewScanner(f)
+	var badLine error
+	line := 0
+	for scanner.Scan() {
+		line++
+		// a bad line is only acceptable at the very end, where it could
+		// be a write which was interrupted.
+		if badLine != nil {
+			f.Close()
+			return nil, badLine
+		}
+		var entry journalEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			badLine = errors.Wrapf(err, "journal line %d", line)
+			continue
+		}
+		j.entries[entry.Task] = entry
+	}
+	if err = scanner.Err(); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "reading journal")
+	}
+	if badLine != nil {
+		// start the next entry on a fresh line.
+		_, err = f.Write([]byte("\n"))
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "writing journal")
+		}
+	}
+	return j, nil
+}
+
+// Lookup finds the latest entry for the given task.
+func (j *journal) Lookup(task string) (journalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := j.entries[task]
+	return entry, ok
+}
+
+// Record writes an entry to the journal, and syncs it to disk, so it's
+// there even if the process doesn't get to exit cleanly.
+func (j *journal) Record(entry journalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[entry.Task] = entry
+	_, err = j.f.Write(data)
+	if err != nil {
+		return errors.Wrap(err, "writing journal")
+	}
+	return errors.Wrap(j.f.Sync(), "syncing journal")
+}
+
+// Close closes the journal file.
+func (j *journal) Close() error {
+	return j.f.Close()
+}
+
+// journalKey identifies a task in the journal. It includes the task's
+// description and seed, so a changed spec doesn't pick up stale progress.
+func journalKey(task *taskSpec, idx int) string {
+	return fmt.Sprintf("%s/%d: %s, seed %d", task.Parent.Name, idx, task, *task.Seed)
+}
+
+// resumeTask checks the journal for a task's earlier progress. It reports
+// whether the task was already finished. Otherwise, it moves the
+// generator to the last recorded position, if it can.
+func (conf *Config) resumeTask(task *taskSpec, key string, itr CountingIterator) (done bool) {
+	if !conf.Resume {
+		return false
+	}
+	entry, ok := conf.journal.Lookup(key)
+	if !ok {
+		return false
+	}
+	// later appends to this field depend on its highest column, which
+	// zipf column generators only update as they go.
+	if task.FieldSpec.HighestColumn < entry.HighestColumn {
+		task.FieldSpec.HighestColumn = entry.HighestColumn
+	}
+	if entry.Done {
+		conf.printf("   %s: already done, skipping\n", key)
+		return true
+	}
+	gen, ok := itr.(seekableGenerator)
+	if !ok {
+		conf.printf("   %s: can't resume this generator, starting over\n", key)
+		return false
+	}
+	gen.SeekTo(generatorPosition{Columns: entry.Columns, Rows: entry.Rows, Tries: entry.Tries, Values: entry.Values})
+	conf.printf("   %s: resuming after %d values\n", key, entry.Values)
+	return false
+}
+
+// defaultBatchSize is go-pilosa's default import batch size.
+const defaultBatchSize = 100000
+
+// importSegments imports a task's records a segment at a time, using
+// imp. With a journal, it records the generator's position in the journal
+// once each segment has been imported. With retries, a segment whose
+// import fails is imported again. A segment is a batch for each import
+// thread. Generators which can't seek are imported all at once, unless
+// they're being retried, and only recorded when they finish. throttle,
+// if not nil, is the task's rate and duration limit somewhere under itr.
+func (conf *Config) importSegments(imp importFunc, task *taskSpec, key string, gen, itr CountingIterator, throttle *throttledIterator) error {
+	seg := &segmentIterator{CountingIterator: itr}
+	seeker, ok := gen.(seekableGenerator)
+	if ok || task.Parent.Retries > 0 {
+		batchSize, threads := defaultBatchSize, 1
+		if task.BatchSize != nil {
+			batchSize = *task.BatchSize
+		}
+		if task.Parent.ThreadCount != nil {
+			threads = *task.Parent.ThreadCount
+		}
+		seg.size = batchSize * threads
+	}
+	for !seg.eof {
+		seg.remaining = seg.size
+		var err error
+		if task.Parent.Retries > 0 {
+			err = importRetrying(conf.context(), conf.output(), imp, seg, task.Parent, key)
+		} else {
+			err = imp(seg)
+		}
+		if err != nil {
+			return err
+		}
+		if conf.journal == nil {
+			continue
+		}
+		// a task which ran out of time isn't done; resuming it picks up
+		// where it stopped.
+		done := seg.eof
+		if throttle != nil && throttle.Expired() {
+			done = false
+		}
+		entry := journalEntry{Task: key, HighestColumn: task.FieldSpec.HighestColumn, Done: done}
+		if seeker != nil {
+			pos := seeker.Position()
+			entry.Columns, entry.Rows, entry.Tries, entry.Values = pos.Columns, pos.Rows, pos.Tries, pos.Values
+		}
+		err = conf.journal.Record(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentIterator stops after a given number of records, so they can be
+// imported as a unit. A size of zero means no limit.
+type segmentIterator struct {
+	CountingIterator
+	size, remaining int
+	eof             bool
+}
+
+func (s *segmentIterator) NextRecord() (pilosa.Record, error) {
+	if s.size > 0 {
+		if s.remaining == 0 {
+			return nil, io.EOF
+		}
+		s.remaining--
+	}
+	rec, err := s.CountingIterator.NextRecord()
+	if err == io.EOF {
+		s.eof = true
+	}
+	return rec, err
+}
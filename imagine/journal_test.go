@@ -0,0 +1,73 @@
+package imagine
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestJournalDurationLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagine-journal")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := openJournal(filepath.Join(dir, "journal"), false)
+	if err != nil {
+		t.Fatalf("opening journal: %v", err)
+	}
+	defer j.Close()
+	fs := &fieldSpec{Type: fieldTypeMutex, Max: 10, Density: 1.0, DensityScale: uint64p(2097152), Chance: float64p(1.0)}
+	spec := &taskSpec{FieldSpec: fs, Parent: &workloadSpec{}, Columns: uint64p(1000), Seed: int64p(1)}
+	conf := NewConfig()
+	conf.journal = j
+	conf.ctx = context.Background()
+	conf.Output = ioutil.Discard
+	imported := 0
+	imp := func(itr gopilosa.RecordIterator) error {
+		for _, err := itr.NextRecord(); err != io.EOF; _, err = itr.NextRecord() {
+			if err != nil {
+				return err
+			}
+			imported++
+		}
+		return nil
+	}
+
+	// a task stopped by its time limit, under the run's cancellation, isn't
+	// done, so resuming it carries on from where it stopped.
+	gen, _, err := NewGenerator(spec, nil, "")
+	if err != nil {
+		t.Fatalf("creating generator: %v", err)
+	}
+	limit := duration(50 * time.Millisecond)
+	throttle := newThrottledIterator(gen, 100, &limit, nil, "")
+	if err := conf.importSegments(imp, spec, "task", gen, conf.cancelable(throttle), throttle); err != nil {
+		t.Fatalf("importing: %v", err)
+	}
+	entry, ok := j.Lookup("task")
+	if !ok || entry.Done || entry.Values == 0 || imported >= 1000 {
+		t.Fatalf("expected a partial entry after %d records, got %+v", imported, entry)
+	}
+
+	conf.Resume = true
+	gen, _, err = NewGenerator(spec, nil, "")
+	if err != nil {
+		t.Fatalf("creating generator: %v", err)
+	}
+	if conf.resumeTask(spec, "task", gen) {
+		t.Fatalf("expected the time-limited task not to be done")
+	}
+	if err := conf.importSegments(imp, spec, "task", gen, conf.cancelable(gen), nil); err != nil {
+		t.Fatalf("resuming: %v", err)
+	}
+	if entry, _ = j.Lookup("task"); !entry.Done || imported != 1000 {
+		t.Fatalf("expected all 1000 records once the task was resumed, got %d, entry %+v", imported, entry)
+	}
+}
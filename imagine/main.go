@@ -3,26 +3,25 @@ package imagine
 //go:generate enumer -type=verifyType -trimprefix=verifyType -text -transform=kebab -output enums_verifytype.go
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime/pprof"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"net/http"
-	_ "net/http/pprof"
-
 	"github.com/jaffee/commandeer"
 	pilosa "github.com/pilosa/go-pilosa"
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 )
 
-var (
-	client *pilosa.Client
-)
-
 type verifyType int
 
 const (
@@ -31,49 +30,89 @@ const (
 	verifyTypePurge
 	verifyTypeUpdate
 	verifyTypeCreate
+	verifyTypeMigrate
 )
 
 // Config describes the overall configuration of the tool.
 type Config struct {
 	Hosts        []string `help:"comma separated list of \"host:port\" pairs of the Pilosa cluster"`
+	Clusters     []string `help:"more clusters to import the same data into, each as \"host:port\" pairs joined by \"+\""`
 	NoImport     bool     `help:"do not import the generated bits"`
 	PrintOut     bool     `help:"print out the generated data in ROW_ID,COLUMN_ID format"`
-	Verify       string   `help:"index structure validation: purge/error/update/create"`
+	Verify       string   `help:"index structure validation: purge/error/update/create/migrate"`
 	verifyType   verifyType
+	clusters     []*cluster
 	Generate     bool `help:"generate data as specified by workloads"`
 	Delete       bool `help:"delete specified indexes"`
 	Describe     bool `help:"describe the data sets and workloads"`
+	Estimate     bool `help:"estimate data sizes, and compare them with server memory"`
 	onlyDescribe bool
-	Prefix       string `help:"prefix to use on index names"`
-	CPUProfile   string `help:"record CPU profile to file"`
-	MemProfile   string `help:"record allocation profile to file"`
-	Time         bool   `help:"report on time elapsed for operations"`
-	Status       bool   `help:"show status updates while processing"`
-	ColumnScale  int64  `help:"scale number of columns provided by specs"`
-	RowScale     int64  `help:"scale number of rows provided by specs"`
+	Format       string `help:"format for describe output: text/json"`
+	format       describeFormat
+	Prefix       string   `help:"prefix to use on index names"`
+	CPUProfile   string   `help:"record CPU profile to file"`
+	MemProfile   string   `help:"record allocation profile to file"`
+	Time         bool     `help:"report on time elapsed for operations"`
+	Status       bool     `help:"show status updates while processing"`
+	ColumnScale  int64    `help:"scale number of columns provided by specs"`
+	RowScale     int64    `help:"scale number of rows provided by specs"`
+	Set          []string `help:"set a spec variable, as name=value, overriding the spec's value"`
+	vars         map[string]string
 	LogImports   string `help:"file name to log all imports to (so they can be replayed later)"`
 	ThreadCount  int    `help:"number of threads to use for each import, overrides value set in config file"`
+	Check        bool   `help:"check that the server has the data the workloads generate"`
+	CheckRows    int    `help:"number of rows (or values, for int fields) to check in each field"`
+	CheckShards  int    `help:"approximate number of shards to sample in each field when checking"`
+	OutputDir    string `help:"write generated data to files in this directory instead of importing it"`
+	outFormats   []outputFormat
+	OutputFormat []string `help:"formats to write to output directory: csv/ndjson/roaring"`
+	Journal      string   `help:"file to record task progress in, so interrupted imports can be resumed"`
+	Resume       bool     `help:"skip tasks the journal shows as done, and resume partly done ones"`
+	journal      *journal
+	MetricsFile  string `help:"file to write JSON metrics for each task, workload, and spec to"`
+	ServeMetrics bool   `help:"serve live metrics in Prometheus format at /metrics on the pprof server"`
+	metrics      *metricsCollector
 	flagset      *flag.FlagSet
 	specFiles    []string
+	specData     []specSource
 	specs        []*tomlSpec
 	indexes      map[string]*indexSpec
 	workloads    []namedWorkload
+	namedTasks   map[string]*taskSpec
 	dbSchema     map[string]map[string]*pilosa.Field
+	dbIndexes    map[string]*pilosa.Index
+	failures     []taskFailure
+	ctx          context.Context
+	report       bool // report on the server before running, as the command does
+	// Output is where descriptions, progress, and reports are written.
+	// If it's nil, they go to standard output. Tasks running at once
+	// write to it concurrently.
+	Output io.Writer `flag:"-"`
 }
 
-// Run does validation on the configuration data. Used by
-// commandeer.
+// Run takes the spec files from the command line arguments, and
+// validates the configuration. Used by commandeer.
 func (conf *Config) Run() error {
 	// no error-checking if nothing to check errors on
 	if conf == nil {
 		return nil
 	}
+	conf.NewSpecsFiles(conf.flagset.Args())
+	return conf.Validate()
+}
+
+// Validate checks the configuration, and fills in the settings derived
+// from it, along with defaults for any left unset. Apply calls it, so a
+// Config built directly only needs it to find errors early.
+func (conf *Config) Validate() error {
 	if conf.ThreadCount < 0 {
 		return fmt.Errorf("invalid thread count %d [must be a positive number]", conf.ThreadCount)
 	}
 	// if not given other instructions, just describe the specs
-	if !conf.Generate && !conf.Delete && conf.Verify == "" {
-		conf.Describe = true
+	if !conf.Generate && !conf.Delete && !conf.Check && conf.Verify == "" {
+		if !conf.Estimate {
+			conf.Describe = true
+		}
 		conf.onlyDescribe = true
 	}
 	if conf.Verify != "" {
@@ -91,8 +130,24 @@ func (conf *Config) Run() error {
 			conf.verifyType = verifyTypeError
 		}
 	}
-	conf.NewSpecsFiles(conf.flagset.Args())
-	if len(conf.specFiles) < 1 {
+	// a Config which wasn't made by NewConfig gets its defaults here.
+	if conf.Format == "" {
+		conf.Format = "text"
+	}
+	if conf.CheckRows == 0 {
+		conf.CheckRows = defaultCheckRows
+	}
+	if conf.CheckShards == 0 {
+		conf.CheckShards = defaultCheckShards
+	}
+	if len(conf.OutputFormat) == 0 {
+		conf.OutputFormat = []string{"csv"}
+	}
+	err := conf.format.UnmarshalText([]byte(conf.Format))
+	if err != nil {
+		return fmt.Errorf("unknown describe format '%s'", conf.Format)
+	}
+	if len(conf.specFiles)+len(conf.specData) < 1 {
 		return errors.New("must specify one or more spec files")
 	}
 	if conf.ColumnScale < 0 || conf.ColumnScale > (1<<31) {
@@ -101,29 +156,72 @@ func (conf *Config) Run() error {
 	if conf.RowScale < 0 || conf.RowScale > (1<<16) {
 		return fmt.Errorf("row scale [%d] should be between 1 and 2^16", conf.RowScale)
 	}
+	conf.vars, err = parseSets(conf.Set)
+	if err != nil {
+		return err
+	}
+	if conf.CheckRows < 1 || conf.CheckShards < 1 {
+		return fmt.Errorf("check rows [%d] and check shards [%d] must be positive", conf.CheckRows, conf.CheckShards)
+	}
+	if conf.Resume && conf.Journal == "" {
+		return errors.New("resuming requires a journal file")
+	}
+	if conf.Journal != "" && (conf.OutputDir != "" || conf.NoImport) {
+		return errors.New("journal only applies to imports, not output directory or no-import")
+	}
+	if len(conf.Clusters) > 0 && (conf.OutputDir != "" || conf.NoImport || conf.Journal != "") {
+		return errors.New("more clusters only apply to imports, without a journal, output directory, or no-import")
+	}
+	if conf.OutputDir != "" {
+		if conf.Check || conf.Delete || conf.NoImport {
+			return errors.New("output directory can't be combined with check, delete, or no-import")
+		}
+		// Nothing goes to a server, so there's nothing to verify.
+		conf.verifyType = verifyTypeNone
+		conf.outFormats = make([]outputFormat, len(conf.OutputFormat))
+		for i, format := range conf.OutputFormat {
+			err := conf.outFormats[i].UnmarshalText([]byte(format))
+			if err != nil {
+				return fmt.Errorf("unknown output format '%s'", format)
+			}
+		}
+	}
 	return nil
 }
 
-// ReadSpecs reads the files in conf.specFiles and populates fields.
+// ReadSpecs reads the files in conf.specFiles, and then the specs added
+// with AddSpec, and populates fields.
 func (conf *Config) ReadSpecs() error {
-	conf.specs = make([]*tomlSpec, 0, len(conf.specFiles))
-	conf.indexes = make(map[string]*indexSpec, len(conf.specFiles))
+	sources := make([]specSource, 0, len(conf.specFiles)+len(conf.specData))
 	for _, path := range conf.specFiles {
-		spec, err := ReadSpec(path)
+		sources = append(sources, specSource{name: path})
+	}
+	sources = append(sources, conf.specData...)
+	conf.specs = make([]*tomlSpec, 0, len(sources))
+	conf.indexes = make(map[string]*indexSpec, len(sources))
+	conf.namedTasks = make(map[string]*taskSpec)
+	reader := newSpecReader(conf.vars)
+	for _, src := range sources {
+		specs, err := reader.readSpecData(src.name, src.data, conf.vars)
 		if err != nil {
-			return fmt.Errorf("couldn't read spec '%s': %v", path, err)
-		}
-		// here is where we put overrides like setting the prefix
-		// from command-line parameters before doing more validation and
-		// populating inferred fields.
-		if spec.Prefix == "" {
-			spec.Prefix = conf.Prefix
+			return fmt.Errorf("couldn't read spec '%s': %v", src.name, err)
 		}
-		err = spec.CleanupIndexes(conf)
-		if err != nil {
-			return err
+		for _, spec := range specs {
+			// here is where we put overrides like setting the prefix
+			// from command-line parameters before doing more validation and
+			// populating inferred fields.
+			if spec.Prefix == "" {
+				spec.Prefix = conf.Prefix
+			}
+			err = spec.CleanupIndexes(conf)
+			if err != nil {
+				return err
+			}
+			conf.specs = append(conf.specs, spec)
 		}
-		conf.specs = append(conf.specs, spec)
+	}
+	if err := reader.unusedSets(); err != nil {
+		return err
 	}
 	for _, spec := range conf.specs {
 		err := spec.CleanupWorkloads(conf)
@@ -134,6 +232,15 @@ func (conf *Config) ReadSpecs() error {
 	return nil
 }
 
+const (
+	// defaultCheckRows is how many rows, or values, are checked in each
+	// field, unless told otherwise.
+	defaultCheckRows = 16
+	// defaultCheckShards is about how many shards of each field are
+	// sampled when checking, unless told otherwise.
+	defaultCheckShards = 2
+)
+
 // NewConfig initializes a config struct with default/initial values,
 // which can be overridden by command line options.
 func NewConfig() *Config {
@@ -142,84 +249,63 @@ func NewConfig() *Config {
 		Generate:    true,
 		Verify:      "update",
 		Prefix:      "imaginary-",
+		Format:      "text",
 		ThreadCount: 0, // if unchanged, uses workloadspec.threadcount
 		// if workloadspec.threadcount is also unset, defaults to 1
+		CheckRows:    defaultCheckRows,
+		CheckShards:  defaultCheckShards,
+		OutputFormat: []string{"csv"},
 	}
 }
 
-// Execute executes the imagine command.
+// Execute executes the imagine command: it parses the command line,
+// runs the specs it names, and exits on errors. Everything but the
+// command line handling, profiling, the debug and metrics server, and the
+// report on the server's resources is done by Apply.
 func (conf *Config) Execute() {
+	if code := conf.execute(); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// execute does the work of Execute, returning the exit status rather
+// than exiting, so that its deferred cleanups, like stopping profiles and
+// closing the metrics file, happen even when it fails.
+func (conf *Config) execute() int {
 	go func() {
 		fmt.Printf("failed to start pprof server on 6060: %v\n", http.ListenAndServe("localhost:6060", nil))
 	}()
 
-	conf.flagset = flag.NewFlagSet("", flag.ContinueOnError)
-
-	err := commandeer.RunArgs(conf.flagset, conf, os.Args[1:])
+	err := conf.ParseArgs(os.Args[1:])
 	if err != nil {
-		log.Fatalf("parsing arguments: %s", err)
+		log.Printf("parsing arguments: %s", err)
+		return 1
 	}
 
-	err = conf.ReadSpecs()
-	if err != nil {
-		log.Fatalf("config/spec error: %v", err)
-	}
-
-	// dry run: just describe the indexes and stop there.
-	if conf.Describe {
-		for _, spec := range conf.specs {
-			describeSpec(spec)
-		}
-		// if we weren't asked to do anything else, stop here.
-		if conf.onlyDescribe {
-			os.Exit(0)
-		}
-	}
-
-	uris := make([]*pilosa.URI, 0, len(conf.Hosts))
-	for _, host := range conf.Hosts {
-		uri, err := pilosa.NewURIFromAddress(host)
+	var client *pilosa.Client
+	if conf.usesServer() {
+		client, err = conf.NewClient()
 		if err != nil {
-			log.Fatalf("could not create Pilosa URI: %v", err)
+			log.Printf("%v", err)
+			return 1
 		}
-		uris = append(uris, uri)
 	}
 
-	clientOpts := make([]pilosa.ClientOption, 0)
-	if conf.LogImports != "" {
-		f, err := os.Create(conf.LogImports)
+	if conf.ServeMetrics && !conf.onlyDescribe {
+		conf.metrics, err = newMetricsCollector(conf.MetricsFile)
 		if err != nil {
-			log.Fatalf("Couldn't open conf.LogImports: '%s'. Err: %v", conf.LogImports, err)
+			log.Printf("metrics: %v", err)
+			return 1
 		}
-		clientOpts = append(clientOpts, pilosa.ExperimentalOptClientLogImports(f))
-	}
-
-	cluster := pilosa.NewClusterWithHost(uris...)
-	client, err := pilosa.NewClient(cluster, clientOpts...)
-	if err != nil {
-		log.Fatalf("could not create Pilosa client: %v", err)
+		defer conf.metrics.Close()
+		http.Handle("/metrics", conf.metrics)
 	}
 
-	serverInfo, err := client.Info()
-	if err != nil {
-		log.Fatalf("couldn't get server info: %v", err)
-	}
-	serverMemMB := serverInfo.Memory / (1024 * 1024)
-	// this is probably really stupid.
-	serverMemGB := (serverMemMB + 1023) / 1024
-	fmt.Printf("server memory: %dGB [%dMB]\n", serverMemGB, serverMemMB)
-	fmt.Printf("server CPU: %s [%d physical cores, %d logical cores available]\n", serverInfo.CPUType, serverInfo.CPUPhysicalCores, serverInfo.CPULogicalCores)
-	serverStatus, err := client.Status()
-	if err != nil {
-		log.Fatalf("couldn't get cluster status info: %v", err)
-	}
-	fmt.Printf("cluster nodes: %d\n", len(serverStatus.Nodes))
-
-	// start profiling only after all the startup decisions are made
 	if conf.CPUProfile != "" {
 		f, cErr := os.Create(conf.CPUProfile)
 		if cErr != nil {
-			log.Fatalf("can't create CPU profile '%s': %s", conf.CPUProfile, cErr)
+			log.Printf("can't create CPU profile '%s': %s", conf.CPUProfile, cErr)
+			return 1
 		}
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
@@ -236,7 +322,70 @@ func (conf *Config) Execute() {
 		}()
 	}
 
-	// do verification.
+	// the first interrupt stops the run cleanly, so a journal records
+	// where it got to; a second one exits immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		if _, ok := <-interrupts; ok {
+			fmt.Printf("interrupted, stopping...\n")
+			signal.Stop(interrupts)
+			cancel()
+		}
+	}()
+
+	conf.report = true
+	_, err = conf.Apply(ctx, client)
+	signal.Stop(interrupts)
+	close(interrupts)
+	if err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+	if !conf.onlyDescribe {
+		fmt.Printf("done.\n")
+	}
+	return 0
+}
+
+// ParseArgs sets the configuration from command line options, followed
+// by the names of spec files, and validates it.
+func (conf *Config) ParseArgs(args []string) error {
+	conf.flagset = flag.NewFlagSet("", flag.ContinueOnError)
+	return commandeer.RunArgs(conf.flagset, conf, args)
+}
+
+// NewClient makes a client for the cluster given by the hosts option.
+func (conf *Config) NewClient() (*pilosa.Client, error) {
+	uris := make([]*pilosa.URI, 0, len(conf.Hosts))
+	for _, host := range conf.Hosts {
+		uri, err := pilosa.NewURIFromAddress(host)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create Pilosa URI")
+		}
+		uris = append(uris, uri)
+	}
+
+	clientOpts := make([]pilosa.ClientOption, 0)
+	if conf.LogImports != "" {
+		f, err := os.Create(conf.LogImports)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't open import log '%s'", conf.LogImports)
+		}
+		clientOpts = append(clientOpts, pilosa.ExperimentalOptClientLogImports(f))
+	}
+
+	client, err := pilosa.NewClient(pilosa.NewClusterWithHost(uris...), clientOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Pilosa client")
+	}
+	return client, nil
+}
+
+// VerifyCluster does the verification given by the verify option.
+func (conf *Config) VerifyCluster(client *pilosa.Client) (err error) {
 	switch conf.verifyType {
 	case verifyTypeNone:
 		// do nothing
@@ -251,26 +400,46 @@ func (conf *Config) Execute() {
 		err = conf.UpdateIndexes(client)
 	case verifyTypeCreate:
 		err = conf.CreateIndexes(client)
+	case verifyTypeMigrate:
+		err = conf.MigrateIndexes(client)
 	}
-	if err != nil {
-		log.Fatalf("initial validation: %v", err)
-	}
+	return err
+}
 
-	if conf.Generate {
-		err := conf.ApplyWorkloads(client)
+// openClusters makes clients for the clusters given in the clusters
+// option. The cluster given by the hosts option, using client, is the
+// first of them.
+func (conf *Config) openClusters(client *pilosa.Client) error {
+	conf.clusters = []*cluster{{name: strings.Join(conf.Hosts, "+"), client: client}}
+	for _, hosts := range conf.Clusters {
+		c, err := newCluster(hosts)
 		if err != nil {
-			log.Fatalf("applying workloads: %v", err)
+			return err
 		}
+		conf.clusters = append(conf.clusters, c)
 	}
+	return nil
+}
 
-	if conf.Delete {
-		err := conf.DeleteIndexes(client)
-		if err != nil {
-			log.Fatalf("deleting indexes: %v", err)
+// eachCluster calls fn with the client for each cluster, or just with
+// client, if there's only one cluster. It stops at the first error.
+func (conf *Config) eachCluster(client *pilosa.Client, fn func(*pilosa.Client) error) error {
+	if len(conf.clusters) == 0 {
+		return fn(client)
+	}
+	for _, c := range conf.clusters {
+		conf.printf("cluster %s:\n", c.name)
+		if err := fn(c.client); err != nil {
+			return errors.Wrapf(err, "cluster '%s'", c.name)
 		}
 	}
+	return nil
+}
 
-	fmt.Printf("done.\n")
+// usesServer reports whether the run talks to a server, rather than only
+// describing specs or writing data to an output directory.
+func (conf *Config) usesServer() bool {
+	return conf.OutputDir == "" && !conf.onlyDescribe
 }
 
 // NewSpecsFiles copies files to config.specFiles.
@@ -281,8 +450,9 @@ func (conf *Config) NewSpecsFiles(files []string) {
 // CompareIndexes is the general form of comparing client and server index
 // specs. mayCreate indicates that it's acceptable to create an index if it's
 // missing. mustCreate indicates that it's mandatory to create an index, so
-// it must not have previously existed.
-func (conf *Config) CompareIndexes(client *pilosa.Client, mayCreate, mustCreate bool) error {
+// it must not have previously existed. migrate indicates that existing
+// fields which don't match the spec should be deleted and recreated.
+func (conf *Config) CompareIndexes(client *pilosa.Client, mayCreate, mustCreate, migrate bool) error {
 	errs := make([]error, 0)
 	schema, err := client.Schema()
 	if err != nil {
@@ -299,7 +469,7 @@ func (conf *Config) CompareIndexes(client *pilosa.Client, mayCreate, mustCreate
 				continue
 			}
 			changed = true
-			dbIndex = schema.Index(index.FullName)
+			dbIndex = schema.Index(index.FullName, pilosa.OptIndexKeys(index.Keys))
 		} else {
 			if mustCreate {
 				errs = append(errs, fmt.Errorf("index '%s' already exists", index.FullName))
@@ -307,78 +477,167 @@ func (conf *Config) CompareIndexes(client *pilosa.Client, mayCreate, mustCreate
 			}
 		}
 		// if we got here, the index now exists, so we can do the same thing to fields...
-		changedFields, fieldErrs := conf.CompareFields(client, dbIndex, index, mayCreate, mustCreate)
+		changedFields, fieldErrs := conf.CompareFields(client, dbIndex, index, mayCreate, mustCreate, migrate)
 		if changedFields {
 			changed = true
 		}
 		errs = append(errs, fieldErrs...)
 	}
 	if changed {
-		fmt.Printf("changes made to db, syncing...\n")
+		conf.printf("changes made to db, syncing...\n")
 		err = client.SyncSchema(schema)
 		if err != nil {
 			errs = append(errs, err)
 		}
 	}
-	if len(errs) > 0 {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
 		return errs[0]
 	}
-	return nil
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return fmt.Errorf("%d errors:\n  %s", len(errs), strings.Join(msgs, "\n  "))
 }
 
 // CompareFields checks the individual fields in an index, following the same
 // logic as CompareIndexes. mayCreate indicates that it's acceptable to create
 // an index if it's missing. mustCreate indicates that it's mandatory to create
-// an index, so it must not have previously existed.
-func (conf *Config) CompareFields(client *pilosa.Client, dbIndex *pilosa.Index, spec *indexSpec, mayCreate, mustCreate bool) (changed bool, errs []error) {
+// an index, so it must not have previously existed. Existing fields are
+// compared with the spec, and if they don't match, they're an error, unless
+// migrate is set, in which case they're deleted and recreated.
+func (conf *Config) CompareFields(client *pilosa.Client, dbIndex *pilosa.Index, spec *indexSpec, mayCreate, mustCreate, migrate bool) (changed bool, errs []error) {
 	dbFields := dbIndex.Fields()
-	for name, field := range spec.FieldsByName {
+	names := make([]string, 0, len(spec.FieldsByName))
+	for name := range spec.FieldsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := spec.FieldsByName[name]
+		opts, err := fieldOptions(field)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
 		dbField := dbFields[name]
 		if dbField == nil {
 			if !mayCreate {
 				errs = append(errs, fmt.Errorf("field '%s' does not exist in '%s'", name, spec.FullName))
 				continue
 			}
-		} else {
-			if mustCreate {
-				errs = append(errs, fmt.Errorf("field '%s' already exists in '%s'", name, spec.FullName))
-				continue
-			}
-			// field exists. we don't have a way to check it yet, so we continue.
+			changed = true
+			dbIndex.Field(name, opts...)
 			continue
 		}
-		changed = true
-		switch field.Type {
-		case fieldTypeInt:
-			dbIndex.Field(name, pilosa.OptFieldTypeInt(int64(field.Min), int64(field.Max)))
-		case fieldTypeSet:
-			dbIndex.Field(name, pilosa.OptFieldTypeSet(pilosa.CacheType(field.Cache.String()), field.CacheSize))
-		case fieldTypeMutex:
-			dbIndex.Field(name, pilosa.OptFieldTypeMutex(pilosa.CacheType(field.Cache.String()), field.CacheSize))
-		case fieldTypeTime:
-			dbIndex.Field(name, pilosa.OptFieldTypeTime(pilosa.TimeQuantum(field.Quantum.String())))
-		default:
-			errs = append(errs, fmt.Errorf("unknown field type '%s'", field.Type))
+		if mustCreate {
+			errs = append(errs, fmt.Errorf("field '%s' already exists in '%s'", name, spec.FullName))
+			continue
+		}
+		// dbIndex already has this field, so build the one the spec
+		// describes in a scratch schema.
+		want := pilosa.NewSchema().Index(spec.FullName).Field(name, opts...)
+		mismatches := fieldMismatches(want.Opts(), dbField.Opts())
+		if len(mismatches) == 0 {
+			continue
+		}
+		if !migrate {
+			errs = append(errs, fmt.Errorf("field '%s' in '%s' does not match spec: %s", name, spec.FullName, strings.Join(mismatches, ", ")))
+			continue
+		}
+		conf.printf("field '%s' in '%s' does not match spec (%s), recreating it\n", name, spec.FullName, strings.Join(mismatches, ", "))
+		err = client.DeleteField(dbField)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "deleting field '%s' in '%s'", name, spec.FullName))
+			continue
+		}
+		err = client.CreateField(want)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "recreating field '%s' in '%s'", name, spec.FullName))
 		}
 	}
 	return changed, errs
 }
 
+// fieldOptions yields the options to create a field as described by a spec.
+func fieldOptions(field *fieldSpec) ([]pilosa.FieldOption, error) {
+	keys := pilosa.OptFieldKeys(field.Keys)
+	switch field.Type {
+	case fieldTypeInt:
+		return []pilosa.FieldOption{pilosa.OptFieldTypeInt(int64(field.Min), int64(field.Max))}, nil
+	case fieldTypeSet:
+		return []pilosa.FieldOption{pilosa.OptFieldTypeSet(pilosa.CacheType(field.Cache.String()), field.CacheSize), keys}, nil
+	case fieldTypeMutex:
+		return []pilosa.FieldOption{pilosa.OptFieldTypeMutex(pilosa.CacheType(field.Cache.String()), field.CacheSize), keys}, nil
+	case fieldTypeTime:
+		return []pilosa.FieldOption{pilosa.OptFieldTypeTime(pilosa.TimeQuantum(field.Quantum.String())), keys}, nil
+	case fieldTypeBool:
+		return []pilosa.FieldOption{pilosa.OptFieldTypeBool()}, nil
+	default:
+		return nil, fmt.Errorf("unknown field type '%s'", field.Type)
+	}
+}
+
+// fieldMismatches lists the ways in which a field's options on the server
+// differ from the ones we want, giving both values for each. Options which
+// don't apply to a field's type aren't compared, and if the types differ,
+// nothing else is.
+func fieldMismatches(want, got pilosa.FieldOptions) (mismatches []string) {
+	if want.Type() != got.Type() {
+		return []string{fmt.Sprintf("type is %s, spec has %s", got.Type(), want.Type())}
+	}
+	switch want.Type() {
+	case pilosa.FieldTypeInt:
+		if want.Min() != got.Min() {
+			mismatches = append(mismatches, fmt.Sprintf("min is %d, spec has %d", got.Min(), want.Min()))
+		}
+		if want.Max() != got.Max() {
+			mismatches = append(mismatches, fmt.Sprintf("max is %d, spec has %d", got.Max(), want.Max()))
+		}
+	case pilosa.FieldTypeSet, pilosa.FieldTypeMutex:
+		if want.CacheType() != got.CacheType() {
+			mismatches = append(mismatches, fmt.Sprintf("cache type is %s, spec has %s", got.CacheType(), want.CacheType()))
+		} else if want.CacheType() != pilosa.CacheTypeNone && want.CacheSize() != got.CacheSize() {
+			mismatches = append(mismatches, fmt.Sprintf("cache size is %d, spec has %d", got.CacheSize(), want.CacheSize()))
+		}
+	case pilosa.FieldTypeTime:
+		if want.TimeQuantum() != got.TimeQuantum() {
+			mismatches = append(mismatches, fmt.Sprintf("time quantum is %s, spec has %s", got.TimeQuantum(), want.TimeQuantum()))
+		}
+	}
+	switch want.Type() {
+	case pilosa.FieldTypeSet, pilosa.FieldTypeMutex, pilosa.FieldTypeTime:
+		if want.Keys() != got.Keys() {
+			mismatches = append(mismatches, fmt.Sprintf("keys is %t, spec has %t", got.Keys(), want.Keys()))
+		}
+	}
+	return mismatches
+}
+
 // VerifyIndexes verifies that the indexes and fields specified already
 // exist and match.
 func (conf *Config) VerifyIndexes(client *pilosa.Client) error {
-	return conf.CompareIndexes(client, false, false)
+	return conf.CompareIndexes(client, false, false, false)
 }
 
 // CreateIndexes attempts to create indexes, erroring out if any exist.
 func (conf *Config) CreateIndexes(client *pilosa.Client) error {
-	return conf.CompareIndexes(client, true, true)
+	return conf.CompareIndexes(client, true, true, false)
 }
 
 // UpdateIndexes attempts to create indexes or fields, accepting existing
 // things as long as they match.
 func (conf *Config) UpdateIndexes(client *pilosa.Client) error {
-	return conf.CompareIndexes(client, true, false)
+	return conf.CompareIndexes(client, true, false, false)
+}
+
+// MigrateIndexes attempts to create indexes or fields, deleting and
+// recreating any existing fields which don't match.
+func (conf *Config) MigrateIndexes(client *pilosa.Client) error {
+	return conf.CompareIndexes(client, true, false, true)
 }
 
 // DeleteIndexes attempts to delete all specified indexes.
@@ -401,20 +660,30 @@ func (conf *Config) DeleteIndexes(client *pilosa.Client) error {
 
 // ApplyNamedWorkload attempts to process each workload in a named workload.
 func (conf *Config) ApplyNamedWorkload(client *pilosa.Client, nwl namedWorkload) (err error) {
+	metrics := conf.metrics.begin(metricsKindSpec, nwl.SpecName)
+	defer func() {
+		mErr := conf.metrics.finish(metrics, err)
+		if err == nil {
+			err = mErr
+		}
+	}()
 	if conf.Time {
 		before := time.Now()
-		fmt.Printf("beginning workloads from spec %s\n", nwl.SpecName)
+		conf.printf("beginning workloads from spec %s\n", nwl.SpecName)
 		defer func() {
 			after := time.Now()
 			var completed = "completed"
 			if err != nil {
 				completed = "failed"
 			}
-			fmt.Printf("spec %s %s in %v\n", nwl.SpecName, completed, after.Sub(before))
+			conf.printf("spec %s %s in %v\n", nwl.SpecName, completed, after.Sub(before))
 		}()
 	}
 	// now apply each workload
 	for _, wl := range nwl.Workloads {
+		if err = conf.canceled(); err != nil {
+			return err
+		}
 		err = conf.ApplyWorkload(client, wl)
 		if err != nil {
 			return err
@@ -425,23 +694,91 @@ func (conf *Config) ApplyNamedWorkload(client *pilosa.Client, nwl namedWorkload)
 
 // ApplyWorkload attempts to process a workload.
 func (conf *Config) ApplyWorkload(client *pilosa.Client, wl *workloadSpec) (err error) {
+	metrics := conf.metrics.begin(metricsKindWorkload, wl.Name)
+	defer func() {
+		mErr := conf.metrics.finish(metrics, err)
+		if err == nil {
+			err = mErr
+		}
+	}()
 	if conf.Time {
 		before := time.Now()
-		fmt.Printf(" beginning workload %s\n", wl.Name)
+		conf.printf(" beginning workload %s\n", wl.Name)
 		defer func() {
 			after := time.Now()
 			var completed = "completed"
 			if err != nil {
 				completed = "failed"
 			}
-			fmt.Printf(" workload %s %s in %v\n", wl.Name, completed, after.Sub(before))
+			conf.printf(" workload %s %s in %v\n", wl.Name, completed, after.Sub(before))
 		}()
 	}
-	err = conf.ApplyTasks(client, wl.Tasks)
-	if err != nil {
-		return err
+	if len(wl.Queries) > 0 && (conf.NoImport || conf.OutputDir != "") {
+		conf.printf(" skipping queries for workload %s, nothing is being imported\n", wl.Name)
+		failed := len(conf.failures)
+		return wl.eachWindow(func(window int, tasks []*taskSpec) error {
+			if err := conf.canceled(); err != nil {
+				return err
+			}
+			conf.beginWindow(wl, window)
+			err := conf.ApplyTasks(client, tasks, nil)
+			if err != nil {
+				return wl.tolerate(conf.output(), err, len(conf.failures)-failed)
+			}
+			return nil
+		})
 	}
-	return nil
+	var during, after []*querySpec
+	for _, qs := range wl.Queries {
+		if qs.DuringImport {
+			during = append(during, qs)
+		} else {
+			after = append(after, qs)
+		}
+	}
+	var progress *ingestProgress
+	if len(during) > 0 {
+		progress = newIngestProgress(wl.windowTasks())
+		var stopQueries func() error
+		stopQueries, err = conf.StartQueries(client, during, progress)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			qErr := stopQueries()
+			if err == nil {
+				err = qErr
+			}
+		}()
+	}
+	// with windows, the queries run after each window.
+	first, failed := 0, len(conf.failures)
+	return wl.eachWindow(func(window int, tasks []*taskSpec) error {
+		if err := conf.canceled(); err != nil {
+			return err
+		}
+		conf.beginWindow(wl, window)
+		err := conf.ApplyTasks(client, tasks, progress.slice(first, len(tasks)))
+		if err != nil {
+			if err = wl.tolerate(conf.output(), err, len(conf.failures)-failed); err != nil {
+				return err
+			}
+		}
+		first += len(tasks)
+		if len(after) > 0 {
+			return conf.RunQueries(client, after)
+		}
+		return nil
+	})
+}
+
+// beginWindow reports the start of one of a workload's windows.
+func (conf *Config) beginWindow(wl *workloadSpec, window int) {
+	if wl.Windows == 0 || !conf.Time {
+		return
+	}
+	start := wl.StampStart.Add(time.Duration(*wl.Window) * time.Duration(window))
+	conf.printf("  window %d/%d, from %s\n", window+1, wl.Windows, start.Format(time.RFC3339))
 }
 
 type taskUpdate struct {
@@ -449,10 +786,13 @@ type taskUpdate struct {
 	colCount int64
 	rowCount int64
 	done     bool
+	rate     float64 // records per second, for tasks with limits
+	target   float64
 }
 
-// ApplyBatch attempts to process the configured batch.
-func (conf *Config) ApplyTasks(client *pilosa.Client, allTasks []*taskSpec) (err error) {
+// ApplyTasks attempts to process the configured tasks. If progress is
+// non-nil, the tasks report their progress to it.
+func (conf *Config) ApplyTasks(client *pilosa.Client, allTasks []*taskSpec, progress *ingestProgress) (err error) {
 	var tasks sync.WaitGroup
 	// and now, in parallel...
 	errs := make([]error, len(allTasks))
@@ -463,20 +803,58 @@ func (conf *Config) ApplyTasks(client *pilosa.Client, allTasks []*taskSpec) (err
 	}
 	for idx, task := range allTasks {
 		field := conf.dbSchema[task.IndexFullName][task.Field]
-		if field == nil {
+		if field == nil && conf.OutputDir == "" {
 			errs[idx] = fmt.Errorf("index '%s', field '%s' not found in schema", task.IndexFullName, task.Field)
 			continue
 		}
-		itr, opts, err := NewGenerator(task, generatorUpdateChan, fmt.Sprintf("%s/%s/%d", task.Index, task.Field, task.ColumnOffset))
+		updateID := fmt.Sprintf("%s/%s/%d", task.Index, task.Field, task.ColumnOffset)
+		// a task with limits reports its rate instead of the generator's
+		// progress.
+		rate, limited := task.targetRate(), task.Rate != nil || task.BatchRate != nil || task.Duration != nil
+		genUpdateChan := generatorUpdateChan
+		if limited {
+			genUpdateChan = nil
+		}
+		itr, opts, err := NewGenerator(task, genUpdateChan, updateID)
 		if err != nil {
 			errs[idx] = err
 			continue
 		}
+		key := journalKey(task, idx)
+		if conf.journal != nil && conf.resumeTask(task, key, itr) {
+			continue
+		}
+		gen := itr
+		itr = progress.track(itr, idx)
+		metrics := conf.metrics.beginTask(task, exportName(task, idx))
+		itr = conf.metrics.track(itr, metrics)
+		var stopBatches func()
+		if metrics != nil && conf.OutputDir == "" && !conf.NoImport && len(conf.clusters) == 0 {
+			var opt pilosa.ImportOption
+			opt, stopBatches = conf.metrics.batchCounter(metrics)
+			opts = append(opts, opt)
+		}
+		var throttle *throttledIterator
+		if limited {
+			throttle = newThrottledIterator(itr, rate, task.Duration, generatorUpdateChan, updateID)
+			itr = throttle
+		}
+		itr = conf.cancelable(itr)
 		tasks.Add(1)
-		go func(idx int, itr CountingIterator, opts []pilosa.ImportOption, field *pilosa.Field, indexName, fieldName string, offset int64) {
+		go func(idx int, gen, itr CountingIterator, throttle *throttledIterator, metrics *runMetrics, stopBatches func(), opts []pilosa.ImportOption, field *pilosa.Field, task *taskSpec, offset int64) {
 			before := time.Now()
-			if conf.NoImport {
-				errs[idx] = nil
+			importer := func(itr pilosa.RecordIterator) error {
+				return client.ImportField(field, itr, opts...)
+			}
+			if len(conf.clusters) > 0 {
+				importer = func(itr pilosa.RecordIterator) error {
+					return fanOutImport(conf.clusters, field, itr, opts, func() { conf.metrics.countBatch(metrics) })
+				}
+			}
+			switch {
+			case conf.OutputDir != "":
+				errs[idx] = conf.ExportTask(task, itr, exportName(task, idx))
+			case conf.NoImport:
 				if conf.PrintOut {
 					for {
 						rec, err := itr.NextRecord()
@@ -485,10 +863,11 @@ func (conf *Config) ApplyTasks(client *pilosa.Client, allTasks []*taskSpec) (err
 						}
 						switch r := rec.(type) {
 						case pilosa.Column:
+							row, col := columnIdentifiers(r)
 							if r.Timestamp > 0 {
-								fmt.Printf("%d,%d,%d\n", r.RowID, r.ColumnID, r.Timestamp)
+								conf.printf("%v,%v,%d\n", row, col, r.Timestamp)
 							} else {
-								fmt.Printf("%d,%d\n", r.RowID, r.ColumnID)
+								conf.printf("%v,%v\n", row, col)
 							}
 						}
 					}
@@ -501,41 +880,62 @@ func (conf *Config) ApplyTasks(client *pilosa.Client, allTasks []*taskSpec) (err
 						}
 						totalBits += 1
 					}
-					fmt.Println("total bits:", totalBits)
+					conf.printf("total bits: %d\n", totalBits)
 				}
-			} else {
-				errs[idx] = client.ImportField(field, itr, opts...)
+			case conf.journal != nil || task.Parent.Retries > 0:
+				errs[idx] = conf.importSegments(importer, task, key, gen, itr, throttle)
+			default:
+				errs[idx] = importer(itr)
 			}
-
-			errs[idx] = client.ImportField(field, itr, opts...)
 			if conf.Time {
 				after := time.Now()
 				v, t := itr.Values()
-				fmt.Printf("   %s/%s[%d]: %v for %d/%d values\n", indexName, fieldName, offset, after.Sub(before), v, t)
+				conf.printf("   %s/%s[%d]: %v for %d/%d values\n", task.Index, task.Field, offset, after.Sub(before), v, t)
+			}
+			if throttle != nil {
+				conf.printf("   %s/%s[%d]: %s\n", task.Index, task.Field, offset, throttle.Summary())
+			}
+			if stopBatches != nil {
+				stopBatches()
+			}
+			if metrics != nil {
+				v, t := itr.Values()
+				conf.metrics.update(metrics, v, t)
+				if mErr := conf.metrics.finish(metrics, errs[idx]); errs[idx] == nil {
+					errs[idx] = mErr
+				}
 			}
 			tasks.Done()
-		}(idx, itr, opts, field, task.Index, task.Field, int64(task.ColumnOffset))
+		}(idx, gen, itr, throttle, metrics, stopBatches, opts, field, task, int64(task.ColumnOffset))
 	}
 	go func() {
 		tasks.Wait()
 		close(updateChan)
 	}()
 	for u := range updateChan {
-		if u.rowCount != 0 {
-			fmt.Printf("    %s %10d/%-10d\r", u.id, u.colCount, u.rowCount)
+		if u.rate != 0 || u.target != 0 {
+			target := ""
+			if u.target != 0 {
+				target = fmt.Sprintf(" (target %.0f/s)", u.target)
+			}
+			conf.printf("    %s %10d %10.0f/s%s\r", u.id, u.colCount, u.rate, target)
+		} else if u.rowCount != 0 {
+			conf.printf("    %s %10d/%-10d\r", u.id, u.colCount, u.rowCount)
 		} else {
-			fmt.Printf("    %s %-10d\r", u.id, u.colCount)
+			conf.printf("    %s %-10d\r", u.id, u.colCount)
 		}
 	}
 	if !conf.Time {
 		// without the trailing time update, the later "done" overwrites
 		// part of the status line.
-		fmt.Println("")
+		conf.printf("\n")
 	}
 	errorCount := 0
 	err = nil
-	for _, e := range errs {
+	for idx, e := range errs {
 		if e != nil {
+			task := allTasks[idx]
+			conf.failures = append(conf.failures, taskFailure{workload: task.Parent.Name, idx: idx, task: task, err: e})
 			errorCount++
 			if err == nil {
 				err = e
@@ -548,23 +948,59 @@ func (conf *Config) ApplyTasks(client *pilosa.Client, allTasks []*taskSpec) (err
 	return errors.Wrap(err, fmt.Sprintf("%d errors", errorCount))
 }
 
-// ApplyWorkloads attempts to process the configured workloads.
-func (conf *Config) ApplyWorkloads(client *pilosa.Client) error {
-	// grab all the schema data for easy lookup
+// loadDBSchema grabs all the schema data from the server for easy lookup.
+func (conf *Config) loadDBSchema(client *pilosa.Client) error {
 	schema, err := client.Schema()
 	if err != nil {
 		return err
 	}
 	indexes := schema.Indexes()
 	conf.dbSchema = make(map[string]map[string]*pilosa.Field, len(indexes))
+	conf.dbIndexes = indexes
 	for name, index := range indexes {
 		conf.dbSchema[name] = index.Fields()
 	}
+	return nil
+}
+
+// ApplyWorkloads attempts to process the configured workloads.
+// If an output directory is set, client may be nil, and the data is
+// written to files instead.
+func (conf *Config) ApplyWorkloads(client *pilosa.Client) (err error) {
+	if conf.OutputDir == "" {
+		err = conf.loadDBSchema(client)
+		if err != nil {
+			return err
+		}
+	}
+	if conf.Journal != "" {
+		conf.journal, err = openJournal(conf.Journal, conf.Resume)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			jErr := conf.journal.Close()
+			if err == nil {
+				err = jErr
+			}
+			conf.journal = nil
+		}()
+	}
+	conf.failures = nil
+	defer conf.reportFailures()
 	for _, nwl := range conf.workloads {
 		err = conf.ApplyNamedWorkload(client, nwl)
 		if err != nil {
 			return err
 		}
 	}
+	// tasks stopped by canceling the run may have been counted as
+	// failures by workloads which continue on error.
+	if err = conf.canceled(); err != nil {
+		return err
+	}
+	if len(conf.failures) > 0 {
+		return fmt.Errorf("%d tasks failed", len(conf.failures))
+	}
 	return nil
 }
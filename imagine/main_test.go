@@ -0,0 +1,66 @@
+package imagine
+
+import (
+	"strings"
+	"testing"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestFieldMismatches(t *testing.T) {
+	ymd, ymdh := timeQuantumYMD, timeQuantumYMDH
+	options := func(fs *fieldSpec) gopilosa.FieldOptions {
+		opts, err := fieldOptions(fs)
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name, err)
+		}
+		return gopilosa.NewSchema().Index("i").Field(fs.Name, opts...).Opts()
+	}
+	for _, c := range []struct {
+		want, got  *fieldSpec
+		mismatches []string
+	}{
+		{
+			want: &fieldSpec{Name: "f", Type: fieldTypeSet, Cache: cacheTypeRanked, CacheSize: 1000},
+			got:  &fieldSpec{Name: "f", Type: fieldTypeSet, Cache: cacheTypeRanked, CacheSize: 1000},
+		},
+		{
+			want:       &fieldSpec{Name: "f", Type: fieldTypeSet, Cache: cacheTypeRanked, CacheSize: 1000},
+			got:        &fieldSpec{Name: "f", Type: fieldTypeMutex, Cache: cacheTypeLRU, CacheSize: 50},
+			mismatches: []string{"type is mutex, spec has set"},
+		},
+		{
+			want:       &fieldSpec{Name: "f", Type: fieldTypeMutex, Cache: cacheTypeRanked, CacheSize: 1000, Keys: true},
+			got:        &fieldSpec{Name: "f", Type: fieldTypeMutex, Cache: cacheTypeRanked, CacheSize: 50},
+			mismatches: []string{"cache size is 50, spec has 1000", "keys is false, spec has true"},
+		},
+		{
+			want: &fieldSpec{Name: "f", Type: fieldTypeSet, Cache: cacheTypeNone, CacheSize: 1000},
+			got:  &fieldSpec{Name: "f", Type: fieldTypeSet, Cache: cacheTypeNone, CacheSize: 50},
+		},
+		{
+			want:       &fieldSpec{Name: "f", Type: fieldTypeInt, Min: -5, Max: 100},
+			got:        &fieldSpec{Name: "f", Type: fieldTypeInt, Min: 0, Max: 10},
+			mismatches: []string{"min is 0, spec has -5", "max is 10, spec has 100"},
+		},
+		{
+			want:       &fieldSpec{Name: "f", Type: fieldTypeTime, Quantum: &ymdh},
+			got:        &fieldSpec{Name: "f", Type: fieldTypeTime, Quantum: &ymd},
+			mismatches: []string{"time quantum is YMD, spec has YMDH"},
+		},
+		{
+			want:       &fieldSpec{Name: "f", Type: fieldTypeBool},
+			got:        &fieldSpec{Name: "f", Type: fieldTypeInt, Max: 1},
+			mismatches: []string{"type is int, spec has bool"},
+		},
+	} {
+		mismatches := fieldMismatches(options(c.want), options(c.got))
+		if strings.Join(mismatches, "; ") != strings.Join(c.mismatches, "; ") {
+			t.Errorf("%s vs %s: expected mismatches %q, got %q", c.want.Type, c.got.Type, c.mismatches, mismatches)
+		}
+	}
+	// decimal fields can't be created, so they aren't made into int fields.
+	if _, err := fieldOptions(&fieldSpec{Name: "f", Type: fieldTypeDecimal, Max: 10}); err == nil {
+		t.Errorf("expected decimal field options to be refused")
+	}
+}
@@ -0,0 +1,302 @@
+package imagine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+const (
+	metricsKindSpec     = "spec"
+	metricsKindWorkload = "workload"
+	metricsKindTask     = "task"
+)
+
+// runMetrics holds the numbers reported for a task, a workload, or a
+// spec. A workload's numbers are the totals for its tasks, and a spec's
+// are the totals for its workloads. End is zero until it's done.
+type runMetrics struct {
+	Kind             string    `json:"kind"`
+	Spec             string    `json:"spec"`
+	Workload         string    `json:"workload,omitempty"`
+	Task             string    `json:"task,omitempty"`
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end"`
+	Values           int64     `json:"values"`
+	Tries            int64     `json:"tries"`
+	RecordsPerSecond float64   `json:"recordsPerSecond"`
+	Batches          int64     `json:"batches"`
+	Error            string    `json:"error,omitempty"`
+
+	parent *runMetrics
+	task   *taskSpec
+	failed bool
+}
+
+// metricsCollector tracks metrics for everything a run does, writing
+// each record to a file, if it has one, when it's done, and serving the
+// current numbers in Prometheus's text format. Specs and workloads run
+// one at a time, so tasks belong to the most recently started workload,
+// and workloads to the most recently started spec. A nil collector
+// ignores everything.
+type metricsCollector struct {
+	mu       sync.Mutex
+	spec     *runMetrics
+	workload *runMetrics
+	entries  []*runMetrics
+	f        *os.File
+	enc      *json.Encoder
+}
+
+// newMetricsCollector makes a collector, which writes to the given file
+// if path isn't empty.
+func newMetricsCollector(path string) (*metricsCollector, error) {
+	m := &metricsCollector{}
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating metrics file")
+		}
+		m.f = f
+		m.enc = json.NewEncoder(f)
+	}
+	return m, nil
+}
+
+// Close closes the metrics file, if there is one.
+func (m *metricsCollector) Close() error {
+	if m == nil || m.f == nil {
+		return nil
+	}
+	return m.f.Close()
+}
+
+// begin starts tracking a spec, workload, or task.
+func (m *metricsCollector) begin(kind, name string) *runMetrics {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := &runMetrics{Kind: kind, Start: time.Now()}
+	switch kind {
+	case metricsKindSpec:
+		r.Spec = name
+		m.spec = r
+	case metricsKindWorkload:
+		r.parent = m.spec
+		r.Workload = name
+		m.workload = r
+	case metricsKindTask:
+		r.parent = m.workload
+		r.Task = name
+	}
+	if r.parent != nil {
+		r.Spec = r.parent.Spec
+		if r.Workload == "" {
+			r.Workload = r.parent.Workload
+		}
+	}
+	m.entries = append(m.entries, r)
+	return r
+}
+
+// beginTask starts tracking a task, keeping the task for the run's
+// results.
+func (m *metricsCollector) beginTask(task *taskSpec, name string) *runMetrics {
+	r := m.begin(metricsKindTask, name)
+	if r != nil {
+		r.task = task
+	}
+	return r
+}
+
+// update records a task's current values and tries, from its
+// generator's Values(), adding the change to its workload and spec.
+func (m *metricsCollector) update(r *runMetrics, values, tries int64) {
+	if m == nil || r == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dv, dt := values-r.Values, tries-r.Tries
+	for ; r != nil; r = r.parent {
+		r.Values += dv
+		r.Tries += dt
+	}
+}
+
+// finish records that a spec, workload, or task is done, and writes its
+// record to the metrics file.
+func (m *metricsCollector) finish(r *runMetrics, err error) error {
+	if m == nil || r == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.End = time.Now()
+	r.RecordsPerSecond = r.rate(r.End)
+	if err != nil {
+		r.failed = true
+		r.Error = err.Error()
+	}
+	if m.enc == nil {
+		return nil
+	}
+	return errors.Wrap(m.enc.Encode(r), "writing metrics")
+}
+
+// rate computes the values generated per second, up to the given time.
+func (r *runMetrics) rate(now time.Time) float64 {
+	elapsed := now.Sub(r.Start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Values) / elapsed
+}
+
+// batchCounter returns an import option which counts the batches
+// imported for a task, and a function to call when the import is done.
+func (m *metricsCollector) batchCounter(r *runMetrics) (pilosa.ImportOption, func()) {
+	statusChan := make(chan pilosa.ImportStatusUpdate, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range statusChan {
+			m.countBatch(r)
+		}
+	}()
+	return pilosa.OptImportStatusChannel(statusChan), func() {
+		close(statusChan)
+		<-done
+	}
+}
+
+// countBatch counts a batch imported for a task.
+func (m *metricsCollector) countBatch(r *runMetrics) {
+	if m == nil || r == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := r; p != nil; p = p.parent {
+		p.Batches++
+	}
+}
+
+// track wraps itr so its values and tries are reported to m as it
+// goes. With a nil collector, itr is returned unchanged.
+func (m *metricsCollector) track(itr CountingIterator, r *runMetrics) CountingIterator {
+	if m == nil || r == nil {
+		return itr
+	}
+	return &metricsIterator{CountingIterator: itr, m: m, r: r}
+}
+
+// metricsIterator periodically reports a generator's Values() to a
+// metrics collector. It reads them from the goroutine consuming the
+// generator, so they're never read while the generator is changing them.
+type metricsIterator struct {
+	CountingIterator
+	m       *metricsCollector
+	r       *runMetrics
+	records int
+}
+
+func (t *metricsIterator) NextRecord() (pilosa.Record, error) {
+	rec, err := t.CountingIterator.NextRecord()
+	t.records++
+	if err != nil || t.records%progressPeriod == 0 {
+		values, tries := t.CountingIterator.Values()
+		t.m.update(t.r, values, tries)
+	}
+	return rec, err
+}
+
+// taskResults returns the numbers for every task tracked so far.
+func (m *metricsCollector) taskResults() []TaskResult {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	results := make([]TaskResult, 0, len(m.entries))
+	for _, r := range m.entries {
+		if r.Kind != metricsKindTask {
+			continue
+		}
+		tr := TaskResult{
+			Spec:             r.Spec,
+			Workload:         r.Workload,
+			Task:             r.Task,
+			Start:            r.Start,
+			End:              r.End,
+			Values:           r.Values,
+			Tries:            r.Tries,
+			Batches:          r.Batches,
+			RecordsPerSecond: r.RecordsPerSecond,
+			Error:            r.Error,
+		}
+		if t := r.task; t != nil {
+			tr.Index, tr.Field, tr.Operation = t.IndexFullName, t.Field, t.Operation.String()
+		}
+		results = append(results, tr)
+	}
+	return results
+}
+
+// promLabelEscaper escapes label values for Prometheus's text format.
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ServeHTTP serves the current metrics in Prometheus's text format.
+// Every spec, workload, and task so far is included, identified by its
+// kind, spec, workload, and task labels.
+func (m *metricsCollector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	families := []struct {
+		name, help string
+		value      func(r *runMetrics) float64
+	}{
+		{"imagine_values", "Values generated.", func(r *runMetrics) float64 { return float64(r.Values) }},
+		{"imagine_tries", "Positions tried by generators, including ones which didn't produce values.", func(r *runMetrics) float64 { return float64(r.Tries) }},
+		{"imagine_records_per_second", "Average values generated per second.", func(r *runMetrics) float64 {
+			if !r.End.IsZero() {
+				return r.RecordsPerSecond
+			}
+			return r.rate(now)
+		}},
+		{"imagine_batches", "Import batches sent to the server.", func(r *runMetrics) float64 { return float64(r.Batches) }},
+		{"imagine_start_time_seconds", "Start time, in seconds since the Unix epoch.", func(r *runMetrics) float64 { return unixSeconds(r.Start) }},
+		{"imagine_end_time_seconds", "End time, in seconds since the Unix epoch, or 0 if still running.", func(r *runMetrics) float64 { return unixSeconds(r.End) }},
+		{"imagine_failed", "1 if it failed, 0 otherwise.", func(r *runMetrics) float64 {
+			if r.failed {
+				return 1
+			}
+			return 0
+		}},
+	}
+	for _, fam := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", fam.name, fam.help, fam.name)
+		for _, r := range m.entries {
+			fmt.Fprintf(w, "%s{kind=\"%s\",spec=\"%s\",workload=\"%s\",task=\"%s\"} %g\n", fam.name, r.Kind,
+				promLabelEscaper.Replace(r.Spec), promLabelEscaper.Replace(r.Workload), promLabelEscaper.Replace(r.Task), fam.value(r))
+		}
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,81 @@
+package imagine
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagine-metrics")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.ndjson")
+	m, err := newMetricsCollector(path)
+	if err != nil {
+		t.Fatalf("creating collector: %v", err)
+	}
+	spec := m.begin(metricsKindSpec, "spec.toml")
+	wl := m.begin(metricsKindWorkload, "load")
+	a := m.begin(metricsKindTask, "load-000-i-a")
+	b := m.begin(metricsKindTask, "load-001-i-b")
+	m.update(a, 10, 20)
+	m.update(a, 30, 40)
+	m.update(b, 5, 5)
+	for _, r := range []*runMetrics{a, b, wl} {
+		var rErr error
+		if r == b {
+			rErr = errors.New("oops")
+		}
+		if err := m.finish(r, rErr); err != nil {
+			t.Fatalf("finishing: %v", err)
+		}
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, nil)
+	for _, line := range []string{
+		`imagine_values{kind="spec",spec="spec.toml",workload="",task=""} 35`,
+		`imagine_tries{kind="workload",spec="spec.toml",workload="load",task=""} 45`,
+		`imagine_failed{kind="task",spec="spec.toml",workload="load",task="load-001-i-b"} 1`,
+		`imagine_end_time_seconds{kind="spec",spec="spec.toml",workload="",task=""} 0`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Fatalf("expected %q in metrics:\n%s", line, w.Body.String())
+		}
+	}
+	if err := m.finish(spec, nil); err != nil {
+		t.Fatalf("finishing: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading metrics: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(lines))
+	}
+	var rec runMetrics
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("parsing record: %v", err)
+	}
+	if rec.Kind != metricsKindTask || rec.Task != "load-001-i-b" || rec.Values != 5 || rec.Error != "oops" || rec.End.Before(rec.Start) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	rec = runMetrics{}
+	if err := json.Unmarshal([]byte(lines[3]), &rec); err != nil {
+		t.Fatalf("parsing record: %v", err)
+	}
+	if rec.Kind != metricsKindSpec || rec.Values != 35 || rec.Tries != 45 || rec.Error != "" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+}
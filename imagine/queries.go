@@ -0,0 +1,440 @@
+package imagine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/molecula/apophenia"
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/tools/bench"
+	"github.com/pkg/errors"
+)
+
+// queryGenerator produces a reproducible series of random queries for a
+// querySpec. Each worker gets its own generator.
+type queryGenerator struct {
+	qs      *querySpec
+	index   *pilosa.Index
+	field   *pilosa.Field
+	rand    *rand.Rand
+	zipf    *rand.Zipf
+	rowKeys *keyGenerator
+}
+
+func newQueryGenerator(qs *querySpec, index *pilosa.Index, field *pilosa.Field, worker int) (*queryGenerator, error) {
+	seq := apophenia.NewSequence(*qs.Seed)
+	seq.Seek(apophenia.OffsetFor(apophenia.SequenceRandSource, uint32(worker), 0, 0))
+	g := &queryGenerator{qs: qs, index: index, field: field, rand: rand.New(seq)}
+	fs := qs.FieldSpec
+	// For zipf fields, low rows are denser, so we query them more often,
+	// the way a real workload would more often look at common values.
+	if fs.ValueRule == densityTypeZipf && fs.Max-fs.Min > 1 {
+		g.zipf = rand.NewZipf(g.rand, fs.ZipfS, fs.ZipfV, uint64(fs.Max-fs.Min-1))
+	}
+	if fs.Keys {
+		var err error
+		g.rowKeys, err = newRowKeyGenerator(fs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// value picks a row or value in the field's range.
+func (g *queryGenerator) value() int64 {
+	fs := g.qs.FieldSpec
+	if fs.Max <= fs.Min {
+		return fs.Min
+	}
+	if g.zipf != nil {
+		return fs.Min + int64(g.zipf.Uint64())
+	}
+	return fs.Min + g.rand.Int63n(fs.Max-fs.Min)
+}
+
+// row picks a row, returning a key if the field uses them, or true or
+// false for a bool field.
+func (g *queryGenerator) row() interface{} {
+	row := g.value()
+	if g.rowKeys != nil {
+		return g.rowKeys.Key(row)
+	}
+	if g.qs.FieldSpec.Type == fieldTypeBool {
+		return row == 1
+	}
+	return uint64(row)
+}
+
+// rows produces a list of 2 to MaxArgs row queries.
+func (g *queryGenerator) rows() []*pilosa.PQLRowQuery {
+	rows := make([]*pilosa.PQLRowQuery, 2+g.rand.Intn(g.qs.MaxArgs-1))
+	for i := range rows {
+		rows[i] = g.field.Row(g.row())
+	}
+	return rows
+}
+
+// Next produces a query of one of the types in the mix.
+func (g *queryGenerator) Next() (queryType, pilosa.PQLQuery) {
+	qt := g.qs.Mix[g.rand.Intn(len(g.qs.Mix))]
+	switch qt {
+	case queryTypeRow:
+		return qt, g.index.Count(g.field.Row(g.row()))
+	case queryTypeIntersect:
+		return qt, g.index.Count(g.index.Intersect(g.rows()...))
+	case queryTypeUnion:
+		return qt, g.index.Count(g.index.Union(g.rows()...))
+	case queryTypeTopn:
+		return qt, g.field.TopN(g.qs.N)
+	case queryTypeRange:
+		a, b := g.value(), g.value()
+		if a > b {
+			a, b = b, a
+		}
+		return qt, g.index.Count(g.field.Between(int(a), int(b)))
+	case queryTypeTimeRange:
+		span := int64(*g.qs.StampRange)
+		a, b := g.rand.Int63n(span+1), g.rand.Int63n(span+1)
+		if a > b {
+			a, b = b, a
+		}
+		start := g.qs.StampStart.Add(time.Duration(a))
+		end := g.qs.StampStart.Add(time.Duration(b))
+		return qt, g.index.Count(g.field.Range(g.row(), start, end))
+	}
+	panic("unreachable")
+}
+
+// queryStats tracks timing stats for each type of query.
+type queryStats map[queryType]*bench.Stats
+
+func (qs queryStats) Add(qt queryType, d time.Duration) {
+	if qs[qt] == nil {
+		qs[qt] = bench.NewStats()
+	}
+	qs[qt].Add(d)
+}
+
+func (qs queryStats) Combine(other queryStats) {
+	for qt, stats := range other {
+		if qs[qt] == nil {
+			qs[qt] = bench.NewStats()
+		}
+		qs[qt].Combine(stats)
+	}
+}
+
+// describeLatency summarizes a set of query timings.
+func describeLatency(stats *bench.Stats) string {
+	return fmt.Sprintf("%d queries, min %v, mean %v, p50 %v, p90 %v, p99 %v, p99.9 %v, max %v",
+		stats.Num, stats.Min, stats.Mean,
+		stats.Percentile(50), stats.Percentile(90), stats.Percentile(99), stats.Percentile(99.9), stats.Max)
+}
+
+// Report prints latency stats for each type of query, in order.
+func (qs queryStats) Report(out io.Writer, name string) {
+	for _, qt := range queryTypeValues() {
+		stats := qs[qt]
+		if stats == nil || stats.Num == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "   %s %s: %s\n", name, qt, describeLatency(stats))
+	}
+}
+
+// ingestProgress tracks how far along a set of concurrently running tasks
+// are, so queries running alongside them can be attributed to a stage of
+// the ingest.
+type ingestProgress struct {
+	// both are accessed atomically, as tasks start while queries run.
+	done  []int64
+	total []int64
+}
+
+func newIngestProgress(tasks int) *ingestProgress {
+	return &ingestProgress{done: make([]int64, tasks), total: make([]int64, tasks)}
+}
+
+// Fraction reports the overall progress, in [0,1].
+func (p *ingestProgress) Fraction() float64 {
+	var done, total int64
+	for i := range p.done {
+		done += atomic.LoadInt64(&p.done[i])
+		total += atomic.LoadInt64(&p.total[i])
+	}
+	if total == 0 {
+		return 0
+	}
+	if done >= total {
+		return 1
+	}
+	return float64(done) / float64(total)
+}
+
+// progressPeriod is how many records a trackedIterator produces between
+// updates to its shared progress counter.
+const progressPeriod = 4096
+
+// progressReporter is implemented by generators which know how much work
+// they have done, and have in total, in the same units as the second value
+// reported by Values().
+type progressReporter interface {
+	Progress() (done, total int64)
+}
+
+// trackedIterator wraps a generator, periodically publishing its progress
+// for other goroutines to see.
+type trackedIterator struct {
+	CountingIterator
+	reporter progressReporter
+	done     *int64
+	records  int
+}
+
+// track wraps itr so it reports progress to p as task idx. Generators
+// which can't report progress are returned unchanged.
+func (p *ingestProgress) track(itr CountingIterator, idx int) CountingIterator {
+	reporter, ok := itr.(progressReporter)
+	if p == nil || !ok {
+		return itr
+	}
+	_, total := reporter.Progress()
+	atomic.StoreInt64(&p.total[idx], total)
+	return &trackedIterator{CountingIterator: itr, reporter: reporter, done: &p.done[idx]}
+}
+
+// slice returns the progress of n of the tasks, starting at first, for
+// tasks which are run a group at a time.
+func (p *ingestProgress) slice(first, n int) *ingestProgress {
+	if p == nil {
+		return nil
+	}
+	return &ingestProgress{done: p.done[first : first+n], total: p.total[first : first+n]}
+}
+
+func (t *trackedIterator) NextRecord() (pilosa.Record, error) {
+	rec, err := t.CountingIterator.NextRecord()
+	t.records++
+	if err != nil || t.records%progressPeriod == 0 {
+		done, _ := t.reporter.Progress()
+		atomic.StoreInt64(t.done, done)
+	}
+	return rec, err
+}
+
+// queryRunner runs the queries for a single querySpec, spread across the
+// requested number of workers.
+type queryRunner struct {
+	ctx      context.Context
+	qs       *querySpec
+	name     string
+	index    *pilosa.Index
+	field    *pilosa.Field
+	progress *ingestProgress
+	stats    queryStats
+	buckets  []*bench.Stats // stats by ingest progress, if running during ingest
+}
+
+func (conf *Config) newQueryRunner(qs *querySpec, progress *ingestProgress) (*queryRunner, error) {
+	r := &queryRunner{ctx: conf.context(), qs: qs, name: fmt.Sprintf("%s/%s", qs.Index, qs.Field), progress: progress}
+	r.index = conf.dbIndexes[qs.IndexFullName]
+	r.field = conf.dbSchema[qs.IndexFullName][qs.Field]
+	if r.index == nil || r.field == nil {
+		return nil, fmt.Errorf("index '%s', field '%s' not found in schema", qs.IndexFullName, qs.Field)
+	}
+	return r, nil
+}
+
+// queryWorker holds the results from a single worker.
+type queryWorker struct {
+	stats   queryStats
+	buckets []*bench.Stats
+	err     error
+}
+
+// Run runs queries until the spec's iterations are done, or, if stop is
+// non-nil, until stop is closed.
+func (r *queryRunner) Run(client *pilosa.Client, stop <-chan struct{}) error {
+	var tick <-chan time.Time
+	if r.qs.Rate > 0 {
+		// workers share a ticker, so the rate is overall, not per-worker.
+		// ticks nobody is ready for are dropped, so a slow server gets
+		// fewer queries rather than a burst later.
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / r.qs.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var wg sync.WaitGroup
+	workers := make([]queryWorker, r.qs.Concurrency)
+	for i := range workers {
+		iterations := -1
+		if stop == nil {
+			// spread the iterations across the workers
+			iterations = r.qs.Iterations / r.qs.Concurrency
+			if i < r.qs.Iterations%r.qs.Concurrency {
+				iterations++
+			}
+		}
+		g, err := newQueryGenerator(r.qs, r.index, r.field, i)
+		if err != nil {
+			return err
+		}
+		w := &workers[i]
+		w.stats = make(queryStats)
+		if r.progress != nil {
+			w.buckets = make([]*bench.Stats, r.qs.ProgressBuckets)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.err = r.work(client, g, w, iterations, stop, tick)
+		}()
+	}
+	wg.Wait()
+	r.stats = make(queryStats)
+	if r.progress != nil {
+		r.buckets = make([]*bench.Stats, r.qs.ProgressBuckets)
+	}
+	for _, w := range workers {
+		if w.err != nil {
+			return errors.Wrapf(w.err, "querying %s", r.name)
+		}
+		r.stats.Combine(w.stats)
+		for i, stats := range w.buckets {
+			if stats == nil {
+				continue
+			}
+			if r.buckets[i] == nil {
+				r.buckets[i] = bench.NewStats()
+			}
+			r.buckets[i].Combine(stats)
+		}
+	}
+	return nil
+}
+
+// work runs queries for a single worker. A negative iteration count means
+// to keep going until stop is closed. It stops early, with an error, if
+// the run is canceled.
+func (r *queryRunner) work(client *pilosa.Client, g *queryGenerator, w *queryWorker, iterations int, stop <-chan struct{}, tick <-chan time.Time) error {
+	for j := 0; iterations < 0 || j < iterations; j++ {
+		if tick != nil {
+			select {
+			case <-stop:
+				return nil
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			case <-tick:
+			}
+		} else {
+			select {
+			case <-stop:
+				return nil
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			default:
+			}
+		}
+		var bucket int
+		if r.progress != nil {
+			bucket = int(r.progress.Fraction() * float64(len(w.buckets)))
+			if bucket >= len(w.buckets) {
+				bucket = len(w.buckets) - 1
+			}
+		}
+		qt, q := g.Next()
+		before := time.Now()
+		resp, err := client.Query(q)
+		if err == nil && !resp.Success {
+			err = errors.New(resp.ErrorMessage)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s query", qt)
+		}
+		elapsed := time.Since(before)
+		w.stats.Add(qt, elapsed)
+		if r.progress != nil {
+			if w.buckets[bucket] == nil {
+				w.buckets[bucket] = bench.NewStats()
+			}
+			w.buckets[bucket].Add(elapsed)
+		}
+	}
+	return nil
+}
+
+// Report prints latency stats for each type of query, and, for queries
+// run during ingest, for each stage of the ingest.
+func (r *queryRunner) Report(out io.Writer) {
+	r.stats.Report(out, r.name)
+	for i, stats := range r.buckets {
+		if stats == nil || stats.Num == 0 {
+			continue
+		}
+		from, to := i*100/len(r.buckets), (i+1)*100/len(r.buckets)
+		fmt.Fprintf(out, "   %s ingest %3d%%-%3d%%: %s\n", r.name, from, to, describeLatency(stats))
+	}
+}
+
+// RunQueries runs each of the given query specs in turn, reporting latency
+// statistics for each.
+func (conf *Config) RunQueries(client *pilosa.Client, allQueries []*querySpec) error {
+	for _, qs := range allQueries {
+		r, err := conf.newQueryRunner(qs, nil)
+		if err != nil {
+			return err
+		}
+		err = r.Run(client, nil)
+		if err != nil {
+			return err
+		}
+		r.Report(conf.output())
+	}
+	return nil
+}
+
+// StartQueries starts running each of the given query specs in parallel,
+// recording their latency against the progress of ingest. The returned
+// function stops the queries, reports their results, and returns the
+// first error encountered.
+func (conf *Config) StartQueries(client *pilosa.Client, allQueries []*querySpec, progress *ingestProgress) (func() error, error) {
+	runners := make([]*queryRunner, len(allQueries))
+	for i, qs := range allQueries {
+		r, err := conf.newQueryRunner(qs, progress)
+		if err != nil {
+			return nil, err
+		}
+		runners[i] = r
+	}
+	stop := make(chan struct{})
+	errs := make([]error, len(runners))
+	var wg sync.WaitGroup
+	for i, r := range runners {
+		wg.Add(1)
+		go func(i int, r *queryRunner) {
+			defer wg.Done()
+			errs[i] = r.Run(client, stop)
+		}(i, r)
+	}
+	return func() error {
+		close(stop)
+		wg.Wait()
+		for i, r := range runners {
+			if errs[i] == nil {
+				r.Report(conf.output())
+			}
+		}
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
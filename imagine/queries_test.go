@@ -0,0 +1,179 @@
+package imagine
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestQueryGenerator(t *testing.T) {
+	fs := &fieldSpec{
+		Parent:    &indexSpec{Seed: int64p(0)},
+		Type:      fieldTypeSet,
+		Min:       0,
+		Max:       20,
+		ValueRule: densityTypeZipf,
+		ZipfV:     2,
+		ZipfS:     1.5,
+	}
+	qs := &querySpec{
+		FieldSpec: fs,
+		Seed:      int64p(3),
+		Mix:       []queryType{queryTypeRow, queryTypeIntersect, queryTypeUnion, queryTypeTopn},
+		MaxArgs:   3,
+		N:         5,
+	}
+	index := gopilosa.NewSchema().Index("i")
+	field := index.Field("f")
+	generate := func(worker int) []string {
+		g, err := newQueryGenerator(qs, index, field, worker)
+		if err != nil {
+			t.Fatalf("creating query generator: %v", err)
+		}
+		queries := make([]string, 50)
+		for i := range queries {
+			_, q := g.Next()
+			queries[i] = q.Serialize().String()
+		}
+		return queries
+	}
+	first, again, other := generate(0), generate(0), generate(1)
+	differ := false
+	for i := range first {
+		if first[i] != again[i] {
+			t.Fatalf("query %d: expected %q, got %q", i, first[i], again[i])
+		}
+		if first[i] != other[i] {
+			differ = true
+		}
+	}
+	if !differ {
+		t.Fatalf("workers 0 and 1 generated identical queries")
+	}
+	g, err := newQueryGenerator(qs, index, field, 0)
+	if err != nil {
+		t.Fatalf("creating query generator: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if v := g.value(); v < fs.Min || v >= fs.Max {
+			t.Fatalf("value %d out of range %d..%d", v, fs.Min, fs.Max)
+		}
+	}
+}
+
+func TestIngestProgress(t *testing.T) {
+	spec := &taskSpec{
+		FieldSpec: &fieldSpec{
+			Parent:       &indexSpec{Columns: 10000},
+			Type:         fieldTypeSet,
+			Max:          10,
+			Chance:       float64p(1.0),
+			DensityScale: uint64p(2097152),
+			Density:      0.5,
+		},
+		ColumnOrder:    valueOrderLinear,
+		DimensionOrder: dimensionOrderRow,
+		Columns:        uint64p(10000),
+		RowOrder:       valueOrderLinear,
+		Seed:           int64p(0),
+	}
+	sg, err := newSetGenerator(spec, nil, "updateid")
+	if err != nil {
+		t.Fatalf("getting new set generator: %v", err)
+	}
+	progress := newIngestProgress(2)
+	itr := progress.track(sg, 1)
+	if progress.total[1] != 100000 {
+		t.Fatalf("expected 100000 total tries, got %d", progress.total[1])
+	}
+	last := progress.Fraction()
+	for _, err := itr.NextRecord(); err != io.EOF; _, err = itr.NextRecord() {
+		if err != nil {
+			t.Fatalf("error in iterator: %v", err)
+		}
+		if f := progress.Fraction(); f < last {
+			t.Fatalf("progress went backwards: %f to %f", last, f)
+		}
+		last = progress.Fraction()
+	}
+	if last = progress.Fraction(); last != 1 {
+		t.Fatalf("expected progress 1 when done, got %f", last)
+	}
+}
+
+// TestIngestProgressConcurrent tracks tasks while their progress is being
+// read, as queries do while tasks start; run it with -race.
+func TestIngestProgressConcurrent(t *testing.T) {
+	const tasks = 4
+	progress := newIngestProgress(tasks)
+	stop := make(chan struct{})
+	read := make(chan error)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				read <- nil
+				return
+			default:
+			}
+			f := progress.Fraction()
+			if f < 0 || f > 1 {
+				read <- fmt.Errorf("progress %f out of range", f)
+				return
+			}
+		}
+	}()
+	// let the reader get going before any task starts.
+	time.Sleep(time.Millisecond)
+	var wg sync.WaitGroup
+	errs := make(chan error, tasks)
+	for i := 0; i < tasks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			spec := &taskSpec{
+				FieldSpec: &fieldSpec{
+					Parent:       &indexSpec{Columns: 1000},
+					Type:         fieldTypeSet,
+					Max:          10,
+					Chance:       float64p(1.0),
+					DensityScale: uint64p(2097152),
+					Density:      0.5,
+				},
+				ColumnOrder:    valueOrderLinear,
+				DimensionOrder: dimensionOrderRow,
+				Columns:        uint64p(1000),
+				RowOrder:       valueOrderLinear,
+				Seed:           int64p(int64(i)),
+			}
+			sg, err := newSetGenerator(spec, nil, "updateid")
+			if err != nil {
+				errs <- err
+				return
+			}
+			itr := progress.track(sg, i)
+			for _, err := itr.NextRecord(); err != io.EOF; _, err = itr.NextRecord() {
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+	close(errs)
+	for err := range errs {
+		t.Fatalf("running task: %v", err)
+	}
+	if f := progress.Fraction(); f != 1 {
+		t.Fatalf("expected progress 1 when done, got %f", f)
+	}
+}
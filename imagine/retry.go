@@ -0,0 +1,145 @@
+package imagine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// maxRetryDelay limits how long the delay between retries can grow.
+const maxRetryDelay = time.Minute
+
+// importFunc imports records into a field, in one or more clusters.
+type importFunc func(itr pilosa.RecordIterator) error
+
+// checkErrorPolicy verifies a workload's retry and error settings, and
+// fills in the default retry delay.
+func (ws *workloadSpec) checkErrorPolicy() error {
+	if ws.Retries < 0 {
+		return fmt.Errorf("workload %s: invalid retry count %d, must not be negative", ws.Name, ws.Retries)
+	}
+	if ws.RetryDelay == nil {
+		second := duration(time.Second)
+		ws.RetryDelay = &second
+	} else if *ws.RetryDelay <= 0 {
+		return fmt.Errorf("workload %s: retry delay [%v] must be positive", ws.Name, time.Duration(*ws.RetryDelay))
+	}
+	if ws.MaxErrors < 0 {
+		return fmt.Errorf("workload %s: invalid error budget %d, must not be negative", ws.Name, ws.MaxErrors)
+	}
+	if ws.MaxErrors > 0 && !ws.ContinueOnError {
+		return fmt.Errorf("workload %s: maxErrors only applies with continueOnError", ws.Name)
+	}
+	return nil
+}
+
+// errorPolicy describes a workload's retry and error settings.
+func (ws *workloadSpec) errorPolicy() string {
+	desc := fmt.Sprintf("%d retries from %v", ws.Retries, time.Duration(*ws.RetryDelay))
+	if ws.ContinueOnError {
+		desc += ", continue on error"
+		if ws.MaxErrors > 0 {
+			desc += fmt.Sprintf(" up to %d", ws.MaxErrors)
+		}
+	}
+	return desc
+}
+
+// tolerate decides whether a workload can carry on after some of its
+// tasks fail, given the number which have failed so far. It returns nil
+// if it can, and otherwise an error to stop with.
+func (ws *workloadSpec) tolerate(out io.Writer, err error, failed int) error {
+	if !ws.ContinueOnError {
+		return err
+	}
+	if ws.MaxErrors > 0 && failed > ws.MaxErrors {
+		return errors.Wrapf(err, "workload %s: %d tasks failed, more than maxErrors (%d)", ws.Name, failed, ws.MaxErrors)
+	}
+	fmt.Fprintf(out, " workload %s: %d tasks failed so far, continuing\n", ws.Name, failed)
+	return nil
+}
+
+// importRetrying reads a segment's records into memory, so they can be
+// imported again if an attempt fails. It retries up to the workload's
+// retry count, doubling the delay before each retry, until ctx is
+// canceled. Importing the same records again has the same effect as
+// importing them once, so a partly imported segment can just be imported
+// again.
+func importRetrying(ctx context.Context, out io.Writer, imp importFunc, seg pilosa.RecordIterator, wl *workloadSpec, name string) error {
+	var records []pilosa.Record
+	for {
+		rec, err := seg.NextRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		records = append(records, rec)
+	}
+	delay := time.Duration(*wl.RetryDelay)
+	for try := 0; ; try++ {
+		err := imp(&sliceIterator{records: records})
+		if err == nil {
+			return nil
+		}
+		if try == wl.Retries {
+			return errors.Wrapf(err, "after %d retries", try)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fmt.Fprintf(out, "   %s: import failed, retry %d of %d in %v: %v\n", name, try+1, wl.Retries, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// sliceIterator produces records from a slice.
+type sliceIterator struct {
+	records []pilosa.Record
+}
+
+func (s *sliceIterator) NextRecord() (pilosa.Record, error) {
+	if len(s.records) == 0 {
+		return nil, io.EOF
+	}
+	rec := s.records[0]
+	s.records = s.records[1:]
+	return rec, nil
+}
+
+// taskFailure records a task which failed, so it can be reported at the
+// end of the run.
+type taskFailure struct {
+	workload string
+	idx      int
+	task     *taskSpec
+	err      error
+}
+
+func (f taskFailure) String() string {
+	return fmt.Sprintf("%s/%d %s: %v", f.workload, f.idx, f.task, f.err)
+}
+
+// reportFailures lists every task which failed during the run.
+func (conf *Config) reportFailures() {
+	if len(conf.failures) == 0 {
+		return
+	}
+	conf.printf("%d tasks failed:\n", len(conf.failures))
+	for _, f := range conf.failures {
+		conf.printf("  %s\n", f)
+	}
+}
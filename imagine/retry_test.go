@@ -0,0 +1,74 @@
+package imagine
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestImportRetries(t *testing.T) {
+	fs := &fieldSpec{Type: fieldTypeMutex, Max: 10, Density: 1.0, DensityScale: uint64p(2097152), Chance: float64p(1.0)}
+	batch, threads := 100, 2
+	delay := duration(time.Millisecond)
+	wl := &workloadSpec{ThreadCount: &threads, BatchSize: &batch, RetryDelay: &delay}
+	spec := &taskSpec{FieldSpec: fs, Parent: wl, Columns: uint64p(1000), Seed: int64p(1), BatchSize: &batch}
+	conf := NewConfig()
+	for _, c := range []struct {
+		retries, failures int
+		fails             bool
+	}{
+		{retries: 0, failures: 0},
+		{retries: 2, failures: 0},
+		{retries: 2, failures: 2},
+		{retries: 2, failures: 3, fails: true},
+	} {
+		wl.Retries = c.retries
+		itr, _, err := NewGenerator(spec, nil, "")
+		if err != nil {
+			t.Fatalf("creating generator: %v", err)
+		}
+		// the importer fails the first few attempts at the second
+		// segment, after reading part of it.
+		seen := make(map[uint64]int)
+		segments, failures := 0, 0
+		imp := func(itr gopilosa.RecordIterator) error {
+			segments++
+			var cols []uint64
+			for rec, err := itr.NextRecord(); err != io.EOF; rec, err = itr.NextRecord() {
+				if segments >= 2 && failures < c.failures && len(cols) == 50 {
+					failures++
+					return errors.New("flaky")
+				}
+				cols = append(cols, rec.(gopilosa.Column).ColumnID)
+			}
+			for _, col := range cols {
+				seen[col]++
+			}
+			return nil
+		}
+		err = conf.importSegments(imp, spec, "task", itr, itr, nil)
+		if c.fails {
+			if err == nil || !strings.Contains(err.Error(), "after 2 retries") {
+				t.Fatalf("%+v: expected failure after retries, got %v", c, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: unexpected error %v", c, err)
+		}
+		for col := uint64(0); col < 1000; col++ {
+			if seen[col] != 1 {
+				t.Fatalf("%+v: column %d imported %d times", c, col, seen[col])
+			}
+		}
+	}
+	wl.ContinueOnError, wl.MaxErrors = true, 2
+	if wl.tolerate(ioutil.Discard, errors.New("failed"), 2) != nil || wl.tolerate(ioutil.Discard, errors.New("failed"), 3) == nil {
+		t.Fatalf("expected to tolerate 2 failed tasks, but not 3")
+	}
+}
@@ -0,0 +1,292 @@
+package imagine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// specSource is a spec which isn't read from a file, named so errors and
+// relative includes have something to refer to.
+type specSource struct {
+	name string
+	data []byte
+}
+
+// AddSpec adds a spec read from r. name is used as if it were the spec's
+// file name, so includes are relative to its directory.
+func (conf *Config) AddSpec(name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "reading spec '%s'", name)
+	}
+	conf.AddSpecBytes(name, data)
+	return nil
+}
+
+// AddSpecBytes adds a spec given as TOML text. name is used as if it were
+// the spec's file name, so includes are relative to its directory. It
+// must differ from the names of the other specs, and of the files they
+// include, or reading the specs fails.
+func (conf *Config) AddSpecBytes(name string, data []byte) {
+	if data == nil {
+		data = []byte{}
+	}
+	conf.specData = append(conf.specData, specSource{name: name, data: data})
+}
+
+// Result describes what a run did. Tasks are listed in the order they
+// started, including ones which failed.
+type Result struct {
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Tasks    []TaskResult    `json:"tasks"`
+	Clusters []ClusterResult `json:"clusters,omitempty"`
+}
+
+// Failed lists the tasks which failed.
+func (r *Result) Failed() []TaskResult {
+	var failed []TaskResult
+	for _, t := range r.Tasks {
+		if t.Error != "" {
+			failed = append(failed, t)
+		}
+	}
+	return failed
+}
+
+// TaskResult holds the numbers for a single task. Values and Tries are
+// as reported by the task's generator, and Batches counts the import
+// batches sent to the server, or to the first cluster, with several.
+type TaskResult struct {
+	Spec             string    `json:"spec"`
+	Workload         string    `json:"workload"`
+	Task             string    `json:"task"`
+	Index            string    `json:"index"`
+	Field            string    `json:"field"`
+	Operation        string    `json:"operation"`
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end"`
+	Values           int64     `json:"values"`
+	Tries            int64     `json:"tries"`
+	Batches          int64     `json:"batches"`
+	RecordsPerSecond float64   `json:"recordsPerSecond"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// ClusterResult describes the imports into one of several clusters.
+type ClusterResult struct {
+	Name       string        `json:"name"`
+	Records    int64         `json:"records"`
+	Batches    int64         `json:"batches"`
+	ImportTime time.Duration `json:"importTime"`
+	MaxBatch   time.Duration `json:"maxBatch"`
+	Failures   int           `json:"failures"`
+	LastError  string        `json:"lastError,omitempty"`
+}
+
+// Apply does everything the configuration asks for: it reads the specs,
+// describes them, verifies the indexes, generates data, and checks and
+// deletes it, using client. client may be nil if the configuration only
+// describes specs, or writes data to an output directory. Canceling ctx
+// stops the run between records, and Apply returns ctx's error. The
+// result covers whatever was done, even if there's an error. Progress
+// and reports are written to conf.Output.
+func (conf *Config) Apply(ctx context.Context, client *pilosa.Client) (result *Result, err error) {
+	result = &Result{Start: time.Now()}
+	if err = conf.Validate(); err != nil {
+		return result, errors.Wrap(err, "config error")
+	}
+	if err = conf.ReadSpecs(); err != nil {
+		return result, errors.Wrap(err, "config/spec error")
+	}
+
+	// dry run: just describe the indexes and stop there.
+	if conf.Describe {
+		if conf.format == describeFormatJSON {
+			if err = describeSpecsJSON(conf.output(), conf.specs); err != nil {
+				return result, errors.Wrap(err, "describing specs")
+			}
+		} else {
+			for _, spec := range conf.specs {
+				describeSpec(conf.output(), spec)
+			}
+		}
+	}
+	var estimate sizeEstimate
+	if conf.Estimate {
+		estimate = conf.EstimateSizes()
+	}
+	// if we weren't asked to do anything else, stop here.
+	if conf.onlyDescribe {
+		result.End = time.Now()
+		return result, nil
+	}
+
+	conf.ctx = ctx
+	if conf.metrics == nil {
+		conf.metrics, err = newMetricsCollector(conf.MetricsFile)
+		if err != nil {
+			return result, errors.Wrap(err, "metrics")
+		}
+		defer func() {
+			if mErr := conf.metrics.Close(); err == nil {
+				err = mErr
+			}
+			conf.metrics = nil
+		}()
+	}
+	defer func() {
+		result.End = time.Now()
+		result.Tasks = conf.metrics.taskResults()
+		for _, c := range conf.clusters {
+			result.Clusters = append(result.Clusters, c.result())
+		}
+		conf.ctx = nil
+	}()
+
+	// exporting to files doesn't need a server at all.
+	if conf.OutputDir != "" {
+		if !conf.Generate {
+			return result, nil
+		}
+		if err = os.MkdirAll(conf.OutputDir, 0755); err != nil {
+			return result, errors.Wrap(err, "creating output directory")
+		}
+		return result, errors.Wrap(conf.ApplyWorkloads(nil), "exporting workloads")
+	}
+
+	if client == nil {
+		return result, errors.New("a client is needed for anything but describing specs or writing files")
+	}
+	conf.clusters = nil
+	if len(conf.Clusters) > 0 {
+		if err = conf.openClusters(client); err != nil {
+			return result, errors.Wrap(err, "could not create Pilosa clients")
+		}
+	}
+
+	if conf.report {
+		if err = conf.reportServer(client, estimate); err != nil {
+			return result, err
+		}
+	}
+
+	// do verification.
+	if err = conf.eachCluster(client, conf.VerifyCluster); err != nil {
+		return result, errors.Wrap(err, "initial validation")
+	}
+
+	if conf.Generate {
+		err = conf.ApplyWorkloads(client)
+		for _, c := range conf.clusters {
+			conf.printf("cluster %s\n", c.Summary())
+		}
+		if err != nil {
+			return result, errors.Wrap(err, "applying workloads")
+		}
+	}
+
+	if conf.Check {
+		if err = conf.eachCluster(client, conf.CheckWorkloads); err != nil {
+			return result, errors.Wrap(err, "checking workloads")
+		}
+	}
+
+	if conf.Delete {
+		if err = conf.eachCluster(client, conf.DeleteIndexes); err != nil {
+			return result, errors.Wrap(err, "deleting indexes")
+		}
+	}
+	return result, nil
+}
+
+// reportServer prints the server's memory, CPU, and cluster size, and,
+// if sizes were estimated, compares them with the server's memory. Some
+// servers can't report these, which is only an error if there's an
+// estimate to compare.
+func (conf *Config) reportServer(client *pilosa.Client, estimate sizeEstimate) error {
+	serverInfo, err := client.Info()
+	if err != nil {
+		if conf.Estimate {
+			return errors.Wrap(err, "couldn't get server info")
+		}
+		conf.printf("couldn't get server info: %v\n", err)
+		return nil
+	}
+	serverMemMB := serverInfo.Memory / (1024 * 1024)
+	// this is probably really stupid.
+	serverMemGB := (serverMemMB + 1023) / 1024
+	conf.printf("server memory: %dGB [%dMB]\n", serverMemGB, serverMemMB)
+	conf.printf("server CPU: %s [%d physical cores, %d logical cores available]\n", serverInfo.CPUType, serverInfo.CPUPhysicalCores, serverInfo.CPULogicalCores)
+	serverStatus, err := client.Status()
+	if err != nil {
+		return errors.Wrap(err, "couldn't get cluster status info")
+	}
+	conf.printf("cluster nodes: %d\n", len(serverStatus.Nodes))
+	if conf.Estimate {
+		checkEstimate(conf.output(), estimate, serverInfo.Memory, len(serverStatus.Nodes))
+	}
+	return nil
+}
+
+// context is the context of the run in progress. Outside of Apply, for
+// instance when the workloads are applied directly, it's a background
+// context, which is never canceled.
+func (conf *Config) context() context.Context {
+	if conf.ctx == nil {
+		return context.Background()
+	}
+	return conf.ctx
+}
+
+// canceled returns the run's context's error, once it's been canceled.
+func (conf *Config) canceled() error {
+	return conf.context().Err()
+}
+
+// output returns the writer for descriptions, progress, and reports,
+// which is standard output unless Output is set.
+func (conf *Config) output() io.Writer {
+	if conf.Output == nil {
+		return os.Stdout
+	}
+	return conf.Output
+}
+
+// printf writes to the configuration's output.
+func (conf *Config) printf(format string, args ...interface{}) {
+	fmt.Fprintf(conf.output(), format, args...)
+}
+
+// cancelableIterator stops producing records once its context is
+// canceled, returning the context's error instead, which fails the
+// import consuming it.
+type cancelableIterator struct {
+	CountingIterator
+	ctx context.Context
+}
+
+func (c *cancelableIterator) NextRecord() (pilosa.Record, error) {
+	select {
+	case <-c.ctx.Done():
+		return nil, c.ctx.Err()
+	default:
+	}
+	return c.CountingIterator.NextRecord()
+}
+
+// cancelable wraps itr so it stops when the run is canceled. Outside of
+// a run, itr is returned unchanged.
+func (conf *Config) cancelable(itr CountingIterator) CountingIterator {
+	if conf.ctx == nil {
+		return itr
+	}
+	return &cancelableIterator{CountingIterator: itr, ctx: conf.ctx}
+}
@@ -0,0 +1,84 @@
+package imagine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagine-apply")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	spec := `version = "1.0"
+[indexes.users]
+columns = 1000
+fields = [{ name = "f", type = "mutex", max = 3, density = 1.0 }]
+[[workloads]]
+name = "load"
+tasks = [{ index = "users", field = "f", seed = 1 }]
+`
+	conf := NewConfig()
+	conf.OutputDir = dir
+	if err := conf.AddSpec("users.toml", strings.NewReader(spec)); err != nil {
+		t.Fatalf("adding spec: %v", err)
+	}
+	result, err := conf.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("applying: %v", err)
+	}
+	if len(result.Tasks) != 1 || len(result.Failed()) != 0 {
+		t.Fatalf("expected one successful task, got %#v", result.Tasks)
+	}
+	task := result.Tasks[0]
+	if task.Workload != "load" || task.Index != "imaginary-users" || task.Field != "f" || task.Values != 1000 {
+		t.Fatalf("unexpected task result %#v", task)
+	}
+
+	// a canceled run stops, and reports the cancellation.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err = conf.Apply(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if len(result.Tasks) != 0 {
+		t.Fatalf("expected no tasks after cancellation, got %d", len(result.Tasks))
+	}
+
+	conf.OutputDir = ""
+	if _, err := conf.Apply(context.Background(), nil); err == nil {
+		t.Fatalf("expected an error importing without a client")
+	}
+
+	// a Config built directly gets the defaults NewConfig would set, and
+	// writes its description to its output.
+	var out bytes.Buffer
+	conf = &Config{Generate: true, Describe: true, OutputDir: dir, Output: &out}
+	if err := conf.AddSpec("users.toml", strings.NewReader(spec)); err != nil {
+		t.Fatalf("adding spec: %v", err)
+	}
+	if _, err = conf.Apply(context.Background(), nil); err != nil {
+		t.Fatalf("applying directly built config: %v", err)
+	}
+	if conf.CheckRows != defaultCheckRows || conf.CheckShards != defaultCheckShards || conf.format != describeFormatText || conf.outFormats[0] != outputFormatCSV {
+		t.Fatalf("expected defaults, got check rows %d, shards %d, format %s, output %v", conf.CheckRows, conf.CheckShards, conf.format, conf.outFormats)
+	}
+	if !strings.HasPrefix(out.String(), "spec users.toml:\n") {
+		t.Fatalf("expected description in output, got %q", out.String())
+	}
+
+	// specs given as data with the same name aren't mistaken for one
+	// spec read twice.
+	conf = &Config{Describe: true, Output: ioutil.Discard}
+	conf.AddSpecBytes("users.toml", []byte(spec))
+	conf.AddSpecBytes("users.toml", []byte(strings.Replace(spec, "users", "people", -1)))
+	if _, err = conf.Apply(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "already read as 'users.toml'") {
+		t.Fatalf("expected an error for specs with the same name, got %v", err)
+	}
+}
@@ -7,16 +7,22 @@ package imagine
 //go:generate enumer -type=cacheType -trimprefix=cacheType -text -transform=kebab -output enums_cachetype.go
 //go:generate enumer -type=stampType -trimprefix=stampType -text -transform=kebab -output enums_stamptype.go
 //go:generate enumer -type=timeQuantum -trimprefix=timeQuantum -text -transform=caps -output enums_timequantum.go
+//go:generate enumer -type=taskOperation -trimprefix=taskOperation -text -transform=kebab -output enums_taskoperation.go
+//go:generate enumer -type=queryType -trimprefix=queryType -text -transform=kebab -output enums_querytype.go
+//go:generate enumer -type=timeUnit -trimprefix=timeUnit -text -transform=kebab -output enums_timeunit.go
 
 import (
-	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
 )
 
 type fieldType int
@@ -27,8 +33,23 @@ const (
 	fieldTypeSet
 	fieldTypeMutex
 	fieldTypeTime
+	fieldTypeBool
+	fieldTypeDecimal
+	fieldTypeTimestamp
 )
 
+// intBacked indicates that a field type's values are integers, generated
+// as pilosa.FieldValue records and stored in an int field. Decimal and
+// timestamp values are scaled to integers.
+func (f fieldType) intBacked() bool {
+	return f == fieldTypeInt || f == fieldTypeDecimal || f == fieldTypeTimestamp
+}
+
+// singleValue indicates that a field type has at most one value per column.
+func (f fieldType) singleValue() bool {
+	return f == fieldTypeMutex || f == fieldTypeBool || f.intBacked()
+}
+
 type densityType int
 
 const (
@@ -78,8 +99,51 @@ const (
 	timeQuantumYMDH
 )
 
+type taskOperation int
+
+const (
+	taskOperationSet taskOperation = iota
+	taskOperationClear
+	taskOperationReassign
+)
+
+type queryType int
+
+const (
+	queryTypeRow queryType = iota
+	queryTypeIntersect
+	queryTypeUnion
+	queryTypeTopn
+	queryTypeRange
+	queryTypeTimeRange
+)
+
+// timeUnit is the size of one unit of a timestamp field's values.
+type timeUnit int
+
+const (
+	timeUnitS timeUnit = iota
+	timeUnitMs
+	timeUnitUs
+	timeUnitNs
+)
+
+var timeUnitDurations = map[timeUnit]time.Duration{
+	timeUnitS:  time.Second,
+	timeUnitMs: time.Millisecond,
+	timeUnitUs: time.Microsecond,
+	timeUnitNs: time.Nanosecond,
+}
+
 type columnOffset int64
 
+func (c columnOffset) MarshalJSON() ([]byte, error) {
+	if c == -1 {
+		return []byte(`"append"`), nil
+	}
+	return []byte(strconv.FormatInt(int64(c), 10)), nil
+}
+
 func (c *columnOffset) UnmarshalText(input []byte) error {
 	in := string(input)
 	if in == "append" {
@@ -96,6 +160,10 @@ func (c *columnOffset) UnmarshalText(input []byte) error {
 
 type duration time.Duration
 
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
 func (d *duration) UnmarshalText(input []byte) error {
 	dur, err := time.ParseDuration(string(input))
 	if err != nil {
@@ -114,37 +182,76 @@ type tomlSpec struct {
 	Indexes      map[string]*indexSpec
 	Workloads    []*workloadSpec
 	FastSparse   bool
-	CachePath    string // the path for random uint cache
+	CachePath    string                 // the path for random uint cache
+	Include      []string               // specs to read before this one, relative to this one
+	Vars         map[string]interface{} // default values for ${name} references
 }
 
 type indexSpec struct {
-	Parent        *tomlSpec             `toml:"-"`
+	Parent        *tomlSpec             `toml:"-" json:"-"`
 	Name          string                `toml:"-"`
 	Description   string                // for human-friendly descriptions
 	FullName      string                `toml:"-"` // not actually intended to be user-set
 	Columns       uint64                // total columns to create data for
-	UniqueColumns uint64                // number of random columns to create when fastSparse=true
-	FieldsByName  map[string]*fieldSpec `toml:"-"`
+	UniqueColumns uint64                // number of random columns fastSparse fields use, or 0 for all of them
+	FieldsByName  map[string]*fieldSpec `toml:"-" json:"-"`
 	Fields        []*fieldSpec
 	Seed          *int64 // default PRNG seed
 	ShardWidth    uint64
+	Keys          bool       // use string keys for columns
+	KeyTemplate   string     // format used to make column keys from column IDs
+	KeyOrder      valueOrder // linear or permute; permute shuffles IDs before formatting them
+}
+
+// correlationSpec describes how a mutex or int field's values depend on
+// the values of another mutex or int field in the same column. Values
+// are either computed from the source value, or picked from a table
+// of weights for each source value.
+type correlationSpec struct {
+	Field      string      // the field to take values from
+	Multiplier int64       // value = source * multiplier / divisor + offset + noise
+	Divisor    int64       // multiplier and divisor default to 1
+	Offset     int64       // added to scaled source values
+	Noise      int64       // noise is picked uniformly from [-noise,noise]
+	Table      [][]float64 // weights for this field's values, for each source value
+	source     *fieldSpec
 }
 
 func (is *indexSpec) String() string {
 	if is == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("%s [%s], %d columns, %d fields", is.Name, is.FullName, is.Columns, len(is.Fields))
+	unique := ""
+	if is.UniqueColumns != 0 {
+		unique = fmt.Sprintf(" (%d unique)", is.UniqueColumns)
+	}
+	keys := ""
+	if is.Keys {
+		keys = fmt.Sprintf(", keys %q", is.KeyTemplate)
+	}
+	return fmt.Sprintf("%s [%s], %d columns%s%s, %d fields", is.Name, is.FullName, is.Columns, unique, keys, len(is.Fields))
+}
+
+// shardWidth returns the index's shard width, which defaults to Pilosa's.
+func (is *indexSpec) shardWidth() uint64 {
+	if is.ShardWidth == 0 {
+		return pilosa.DefaultShardWidth
+	}
+	return is.ShardWidth
 }
 
 // fieldSpec describes a given field within an index.
 type fieldSpec struct {
 	// internals
-	Parent *indexSpec `toml:"-"` // the indexSpec this field applies to
+	Parent *indexSpec `toml:"-" json:"-"` // the indexSpec this field applies to
+	// Min and Max as declared, or implied, before row or decimal
+	// scaling, so later declarations of the same field can be compared
+	// with them.
+	declaredMin, declaredMax int64
 
 	// common values for all the field types
 	Name          string
-	Type          fieldType    // "set", "mutex", "int"
+	Type          fieldType    // "set", "mutex", "int", "time", "bool", "decimal", "timestamp"
 	ZipfV, ZipfS  float64      // the V/S parameters of a Zipf distribution
 	ZipfA         float64      // alpha parameter for a zipf distribution, should be >= 0
 	Min, Max      int64        // Allowable value range for an int field. Row range for set/mutex fields.
@@ -153,15 +260,22 @@ type fieldSpec struct {
 	ValueRule     densityType  // which of several hypothetical density/value algorithms to use.
 	DensityScale  *uint64      // optional density scale
 	Chance        *float64     // probability of using this fieldSpec for a given column
-	Next          *fieldSpec   `toml:"-"` // next fieldspec to try
-	HighestColumn int64        `toml:"-"` // highest column we've generated for this field
+	Next          *fieldSpec   `toml:"-" json:"-"` // next fieldspec to try
+	HighestColumn int64        `toml:"-" json:"-"` // highest column we've generated for this field
 	Quantum       *timeQuantum // time quantum, useful only for time fields
 	FastSparse    bool
 	CachePath     string
+	Correlation   *correlationSpec // derive values from another field's values
+	Scale         int64            // digits after the decimal point, for decimal fields
+	Epoch         *time.Time       // the time a timestamp field's 0 value represents
+	Unit          timeUnit         // "s", "ms", "us", or "ns", the size of a timestamp field's values
 
 	// Only useful for set/mutex fields.
-	Cache     cacheType // "ranked", "lru", or "none", default is ranked for set/mutex
-	CacheSize int
+	Cache       cacheType // "ranked", "lru", or "none", default is ranked for set/mutex
+	CacheSize   int
+	Keys        bool       // use string keys for rows
+	KeyTemplate string     // format used to make row keys from row IDs
+	KeyOrder    valueOrder // linear or permute; permute shuffles IDs before formatting them
 }
 
 type namedWorkload struct {
@@ -174,17 +288,34 @@ type workloadSpec struct {
 	Name        string
 	Description string
 	Tasks       []*taskSpec
-	ThreadCount *int // threads to use for each importer
+	Queries     []*querySpec // queries to run after, or during, the tasks
+	ThreadCount *int         // threads to use for each importer
 	BatchSize   *int
 	Split       *int
-	UseRoaring  *bool // configure go-pilosa to use Pilosa's import-roaring endpoint
+	UseRoaring  *bool      // configure go-pilosa to use Pilosa's import-roaring endpoint
+	Rate        *float64   // default target records per second for each task
+	BatchRate   *float64   // default target batches per second for each task
+	Duration    *duration  // default maximum time for each task to run
+	Windows     int        // number of rolling windows to run the tasks in, or 0
+	Window      *duration  // time each window's stamps cover
+	Retention   *duration  // clear windows once they're this old
+	StampStart  *time.Time // start of the first window
+
+	// handling failed imports
+	Retries         int       // times to retry a failed segment of a task's import
+	RetryDelay      *duration // delay before the first retry, doubled for each one after
+	ContinueOnError bool      // keep going after tasks fail
+	MaxErrors       int       // failed tasks to allow, with continueOnError, or 0 for no limit
 }
 
 // taskSpec describes a single task, which is populating some kind of data
 // in some kind of field.
 type taskSpec struct {
-	Parent                *workloadSpec `toml:"-"`
-	FieldSpec             *fieldSpec    `toml:"-"` // once things are built up, this gets pointed to the actual field spec
+	Parent                *workloadSpec `toml:"-" json:"-"`
+	FieldSpec             *fieldSpec    `toml:"-" json:"-"` // once things are built up, this gets pointed to the actual field spec
+	Name                  string        // optional name, so later tasks can replay this one
+	Operation             taskOperation // "set", "clear", or "reassign" (mutex only)
+	Replay                string        // name of an earlier task whose settings to use
 	Index                 string
 	IndexFullName         string `toml:"-"`
 	Field                 string
@@ -201,7 +332,31 @@ type taskSpec struct {
 	ZipfV, ZipfS          float64
 	ZipfRange             *uint64
 	Split                 *int
-	UseRoaring            *bool // configure go-pilosa to use Pilosa's import-roaring endpoint
+	UseRoaring            *bool     // configure go-pilosa to use Pilosa's import-roaring endpoint
+	Rate                  *float64  // target records per second
+	BatchRate             *float64  // target batches per second
+	Duration              *duration // maximum time to run
+}
+
+// querySpec describes a set of queries to run against a field, once
+// the workload's tasks have populated it.
+type querySpec struct {
+	Parent          *workloadSpec `toml:"-" json:"-"`
+	FieldSpec       *fieldSpec    `toml:"-" json:"-"`
+	Index           string
+	IndexFullName   string `toml:"-"`
+	Field           string
+	Seed            *int64      // PRNG seed to use.
+	Mix             []queryType // kinds of query to pick from; default depends on field type
+	Iterations      int         // number of queries to run, default 100
+	Concurrency     int         // number of queries to run at once, default 1
+	MaxArgs         int         // maximum number of rows in an intersect/union, default 2
+	N               uint64      // number of rows for topn, default 10
+	StampRange      *duration   // interval to pick time ranges from
+	StampStart      *time.Time  // starting point for time ranges
+	DuringImport    bool        // run while the workload's tasks run, instead of after
+	Rate            float64     // maximum queries per second, across all workers
+	ProgressBuckets int         // number of ingest progress buckets to report, default 10
 }
 
 func (fs *fieldSpec) String() string {
@@ -217,62 +372,88 @@ func (fs *fieldSpec) String() string {
 	case densityTypeZipf:
 		density = fmt.Sprintf("%.3f base, Zipf v %.3f s %.3f", fs.Density, fs.ZipfV, fs.ZipfS)
 	}
+	keys := ""
+	if fs.Keys {
+		keys = fmt.Sprintf(", keys %q", fs.KeyTemplate)
+	}
+	if fs.Correlation != nil {
+		density = fmt.Sprintf("%.3f, correlated with %s", fs.Density, fs.Correlation.Field)
+	}
 	switch fs.Type {
 	case fieldTypeSet:
-		return fmt.Sprintf("set: rows %d, density %s", fs.Max, density)
+		return fmt.Sprintf("set: rows %d, density %s%s", fs.Max, density, keys)
+	case fieldTypeMutex:
+		return fmt.Sprintf("mutex: rows %d, density %s%s", fs.Max, density, keys)
 	case fieldTypeInt:
 		return fmt.Sprintf("int: Min %d, Max %d, density %s", fs.Min, fs.Max, density)
+	case fieldTypeBool:
+		return fmt.Sprintf("bool: density %s", density)
+	case fieldTypeDecimal:
+		return fmt.Sprintf("decimal: Min %d, Max %d, scale %d, density %s", fs.Min, fs.Max, fs.Scale, density)
+	case fieldTypeTimestamp:
+		unit := timeUnitDurations[fs.Unit]
+		return fmt.Sprintf("timestamp: %s to %s, unit %s, density %s",
+			fs.Epoch.Add(time.Duration(fs.Min)*unit).Format(time.RFC3339Nano), fs.Epoch.Add(time.Duration(fs.Max)*unit).Format(time.RFC3339Nano), fs.Unit, density)
 	default:
 		return fmt.Sprintf("%#v", *fs)
 	}
 }
 
-func describeSpec(spec *tomlSpec) {
-	fmt.Printf("spec %s:\n", spec.PathName)
-	fmt.Printf(" indexes:\n")
+func describeSpec(w io.Writer, spec *tomlSpec) {
+	fmt.Fprintf(w, "spec %s:\n", spec.PathName)
+	fmt.Fprintf(w, " indexes:\n")
 	for _, index := range spec.Indexes {
-		describeIndex(index)
+		describeIndex(w, index)
 	}
-	fmt.Printf(" workloads:\n")
+	fmt.Fprintf(w, " workloads:\n")
 	for _, workload := range spec.Workloads {
-		describeWorkload(workload)
+		describeWorkload(w, workload)
 	}
 }
 
-func describeIndex(spec *indexSpec) {
-	fmt.Printf("  index %s:\n", spec)
+func describeIndex(w io.Writer, spec *indexSpec) {
+	fmt.Fprintf(w, "  index %s:\n", spec)
 	if spec == nil {
 		return
 	}
 	for _, f := range spec.FieldsByName {
-		describeField(f, true)
+		describeField(w, f, true)
 		for f.Next != nil {
 			f = f.Next
-			describeField(f, false)
+			describeField(w, f, false)
 		}
 	}
 }
 
-func describeField(spec *fieldSpec, showName bool) {
+func describeField(w io.Writer, spec *fieldSpec, showName bool) {
 	if showName {
-		fmt.Printf("    %s: ", spec.Name)
+		fmt.Fprintf(w, "    %s: ", spec.Name)
 	} else {
-		fmt.Printf("    %*s: ", len(spec.Name), "")
+		fmt.Fprintf(w, "    %*s: ", len(spec.Name), "")
 	}
-	fmt.Printf(" [%.2f] %s\n", *spec.Chance, spec)
+	fmt.Fprintf(w, " [%.2f] %s\n", *spec.Chance, spec)
 }
 
-func describeWorkload(wl *workloadSpec) {
+func describeWorkload(w io.Writer, wl *workloadSpec) {
 	if wl == nil {
-		fmt.Printf("  nil workload\n")
+		fmt.Fprintf(w, "  nil workload\n")
 		return
 	}
-	fmt.Printf("  workload %s:\n", wl.Name)
+	fmt.Fprintf(w, "  workload %s:\n", wl.Name)
 	if wl.Split != nil {
-		fmt.Printf("   [split: %d]\n", *wl.Split)
+		fmt.Fprintf(w, "   [split: %d]\n", *wl.Split)
+	}
+	if wl.Windows != 0 {
+		fmt.Fprintf(w, "   [windows: %s]\n", wl.windows())
+	}
+	if wl.Retries > 0 || wl.ContinueOnError {
+		fmt.Fprintf(w, "   [errors: %s]\n", wl.errorPolicy())
 	}
 	for _, t := range wl.Tasks {
-		fmt.Printf("    task %v\n", t)
+		fmt.Fprintf(w, "    task %v%s\n", t, t.limits())
+	}
+	for _, q := range wl.Queries {
+		fmt.Fprintf(w, "    queries %v\n", q)
 	}
 }
 
@@ -281,12 +462,37 @@ func (ts *taskSpec) String() string {
 	if ts.ColumnOffset != 0 {
 		offset = fmt.Sprintf(" starting at %d", ts.ColumnOffset)
 	}
-	return fmt.Sprintf("%s/%s: %d columns%s", ts.Index, ts.Field, *ts.Columns, offset)
+	op := ""
+	if ts.Operation != taskOperationSet {
+		op = fmt.Sprintf(" [%s]", ts.Operation)
+	}
+	return fmt.Sprintf("%s/%s: %d columns%s%s", ts.Index, ts.Field, *ts.Columns, offset, op)
+}
+
+func (qs *querySpec) String() string {
+	count := fmt.Sprintf("%d queries", qs.Iterations)
+	if qs.DuringImport {
+		count = "queries during import"
+	}
+	rate := ""
+	if qs.Rate > 0 {
+		rate = fmt.Sprintf(", %g/s", qs.Rate)
+	}
+	return fmt.Sprintf("%s/%s: %s %v, concurrency %d%s", qs.Index, qs.Field, count, qs.Mix, qs.Concurrency, rate)
 }
 
-func ReadSpec(path string) (*tomlSpec, error) {
+// ReadSpec reads the spec at path, and any specs it includes, returning
+// the included specs first. vars overrides the values of the specs'
+// variables.
+func ReadSpec(path string, vars map[string]string) ([]*tomlSpec, error) {
+	return newSpecReader(vars).readSpecs(path, vars)
+}
+
+// decodeSpec decodes a spec, after variables have been substituted into
+// it.
+func decodeSpec(path string, text string) (*tomlSpec, error) {
 	var ts tomlSpec
-	md, err := toml.DecodeFile(path, &ts)
+	md, err := toml.Decode(text, &ts)
 	if err != nil {
 		return nil, err
 	}
@@ -398,6 +604,13 @@ func (is *indexSpec) Cleanup(conf *Config) error {
 	}
 	if conf.ColumnScale != 0 {
 		is.Columns *= uint64(conf.ColumnScale)
+		is.UniqueColumns *= uint64(conf.ColumnScale)
+	}
+	if is.UniqueColumns > is.Columns {
+		return fmt.Errorf("index %s: unique columns [%d] can't exceed columns [%d]", is.Name, is.UniqueColumns, is.Columns)
+	}
+	if err := cleanupKeys(is.Keys, &is.KeyTemplate, is.KeyOrder, is.Name); err != nil {
+		return errors.Wrapf(err, "index %s", is.Name)
 	}
 	for _, field := range is.Fields {
 		field.Parent = is
@@ -406,21 +619,105 @@ func (is *indexSpec) Cleanup(conf *Config) error {
 				return fmt.Errorf("field %s/%s: incompatible type specifiers %v and %v\n", is.Name, field.Name,
 					is.FieldsByName[field.Name].Type, field.Type)
 			}
-			if is.FieldsByName[field.Name].Max != field.Max {
-				if field.Max != 0 {
-					return fmt.Errorf("field %s/%s: incompatible max specifiers %d and %d\n", is.Name, field.Name,
-						is.FieldsByName[field.Name].Max, field.Max)
-				}
-				field.Max = is.FieldsByName[field.Name].Max
+			prev := is.FieldsByName[field.Name]
+			// the previous declaration has already been scaled, so this
+			// one is compared with, or inherits, its range as declared.
+			if field.Min == 0 && field.Max == 0 {
+				field.Min, field.Max = prev.declaredMin, prev.declaredMax
+			} else if field.Min != prev.declaredMin || field.Max != prev.declaredMax {
+				return fmt.Errorf("field %s/%s: incompatible min/max specifiers %d/%d and %d/%d\n", is.Name, field.Name,
+					prev.declaredMin, prev.declaredMax, field.Min, field.Max)
+			}
+			if field.Scale == 0 {
+				field.Scale = prev.Scale
+			} else if field.Scale != prev.Scale {
+				return fmt.Errorf("field %s/%s: incompatible scale specifiers %d and %d\n", is.Name, field.Name, prev.Scale, field.Scale)
 			}
+			if prev.Keys != field.Keys || prev.KeyOrder != field.KeyOrder ||
+				(field.KeyTemplate != "" && field.KeyTemplate != prev.KeyTemplate) {
+				return fmt.Errorf("field %s/%s: incompatible key settings\n", is.Name, field.Name)
+			}
+			field.KeyTemplate = prev.KeyTemplate
 			// push this in front of the previous one
 			field.Next = is.FieldsByName[field.Name]
 		}
 		is.FieldsByName[field.Name] = field
+		field.declaredMin, field.declaredMax = field.Min, field.Max
 		if err := field.Cleanup(conf); err != nil {
 			return fmt.Errorf("field %s/%s: %s", is.Name, field.Name, err)
 		}
 	}
+	// correlations can refer to any field in the index, so they're
+	// resolved once all the fields are known.
+	for _, field := range is.Fields {
+		if err := field.cleanupCorrelation(); err != nil {
+			return fmt.Errorf("field %s/%s: %s", is.Name, field.Name, err)
+		}
+	}
+	return nil
+}
+
+// cleanupCorrelation finds the source field for a correlated field, and
+// checks that the correlation makes sense.
+func (fs *fieldSpec) cleanupCorrelation() error {
+	c := fs.Correlation
+	if c == nil {
+		return nil
+	}
+	if !fs.Type.singleValue() {
+		return errors.New("only fields with one value per column (mutex, bool, int, decimal, or timestamp) can be correlated")
+	}
+	if fs.ValueRule != densityTypeLinear {
+		return errors.New("correlated fields get their values from their source, and can't have a value rule")
+	}
+	c.source = fs.Parent.FieldsByName[c.Field]
+	if c.source == nil {
+		return fmt.Errorf("correlated with undefined field '%s'", c.Field)
+	}
+	if !c.source.Type.singleValue() {
+		return fmt.Errorf("correlated with field '%s', which has more than one value per column", c.Field)
+	}
+	for src, n := c.source, 0; src != nil && src.Correlation != nil; src, n = src.Correlation.source, n+1 {
+		if src == fs || n > len(fs.Parent.Fields) {
+			return errors.New("correlation refers back to itself")
+		}
+	}
+	if c.Table != nil {
+		if c.Multiplier != 0 || c.Divisor != 0 || c.Offset != 0 || c.Noise != 0 {
+			return errors.New("correlation can use a table, or a multiplier/divisor/offset/noise, but not both")
+		}
+		for i, weights := range c.Table {
+			if int64(len(weights)) != fs.Max-fs.Min {
+				return fmt.Errorf("correlation table row %d has %d weights, need one for each of %d values", i, len(weights), fs.Max-fs.Min)
+			}
+			var total float64
+			for _, w := range weights {
+				if w < 0 {
+					return fmt.Errorf("correlation table row %d has negative weight", i)
+				}
+				total += w
+			}
+			if total == 0 {
+				return fmt.Errorf("correlation table row %d has no non-zero weights", i)
+			}
+		}
+	} else {
+		if c.Multiplier == 0 {
+			c.Multiplier = 1
+		}
+		if c.Divisor == 0 {
+			c.Divisor = 1
+		}
+		if c.Noise < 0 {
+			return fmt.Errorf("correlation noise %d must not be negative", c.Noise)
+		}
+	}
+	// By default, use the source's density, so that with the same seed,
+	// the same columns have values.
+	if fs.Density == 0 {
+		fs.Density = c.source.Density
+		fs.DensityScale = c.source.DensityScale
+	}
 	return nil
 }
 
@@ -448,6 +745,9 @@ func (is *indexSpec) Merge(other *indexSpec) error {
 	} else {
 		is.Columns = other.Columns
 	}
+	if is.Keys != other.Keys || is.KeyTemplate != other.KeyTemplate || is.KeyOrder != other.KeyOrder {
+		return fmt.Errorf("conflicting key settings given for index '%s'", is.Name)
+	}
 	if is.Seed != nil {
 		if other.Seed != nil && *other.Seed != *is.Seed {
 			return fmt.Errorf("conflicting seeds given for index '%s' [%d vs %d]", is.Name, *is.Seed, *other.Seed)
@@ -486,7 +786,13 @@ func (fs *fieldSpec) Cleanup(conf *Config) error {
 			return fmt.Errorf("invalid chance %f (must be in [0,1])", *fs.Chance)
 		}
 	}
-	if fs.SourceIndex != "" {
+	if fs.Type == fieldTypeBool {
+		// a bool field's rows are false (0) and true (1).
+		if fs.SourceIndex != "" || fs.Min != 0 || (fs.Max != 0 && fs.Max != 2) {
+			return fmt.Errorf("field %s: bool fields always have rows 0 and 1 (min 0, max 2)", fs.Name)
+		}
+		fs.Max, fs.declaredMax = 2, 2
+	} else if fs.SourceIndex != "" {
 		if fs.Min != 0 || fs.Max != 0 {
 			return fmt.Errorf("field %s specifies both min/max (%d/%d) and source index (%s)",
 				fs.Name, fs.Min, fs.Max, fs.SourceIndex)
@@ -515,6 +821,9 @@ func (fs *fieldSpec) Cleanup(conf *Config) error {
 	if fs.Max < fs.Min {
 		return fmt.Errorf("field %s has maximum %d, less than minimum %d", fs.Name, fs.Max, fs.Min)
 	}
+	if err := fs.cleanupScaledValues(conf); err != nil {
+		return err
+	}
 
 	// I don't think there's any use for a CacheSize of 0 - just set CacheTypeNone in that case.
 	if fs.CacheSize == 0 {
@@ -525,12 +834,12 @@ func (fs *fieldSpec) Cleanup(conf *Config) error {
 		switch fs.Type {
 		case fieldTypeSet, fieldTypeMutex:
 			fs.Cache = cacheTypeRanked
-		case fieldTypeInt:
+		case fieldTypeInt, fieldTypeBool, fieldTypeDecimal, fieldTypeTimestamp:
 			fs.Cache = cacheTypeNone
 		}
 	}
-	if fs.Type == fieldTypeInt && fs.Cache != cacheTypeNone {
-		return fmt.Errorf("field %s specifies a cache (%v) for an int field", fs.Name, fs.Cache)
+	if (fs.Type.intBacked() || fs.Type == fieldTypeBool) && fs.Cache != cacheTypeNone {
+		return fmt.Errorf("field %s specifies a cache (%v) for a %s field", fs.Name, fs.Cache, fs.Type)
 	}
 	if fs.Type == fieldTypeTime {
 		if fs.Quantum == nil {
@@ -547,6 +856,83 @@ func (fs *fieldSpec) Cleanup(conf *Config) error {
 			return fmt.Errorf("field %s: zipf value distribution requires V >= 1, S > 1", fs.Name)
 		}
 	}
+	if fs.Keys {
+		switch fs.Type {
+		case fieldTypeSet, fieldTypeMutex, fieldTypeTime:
+		default:
+			return fmt.Errorf("field %s: keys are only supported for set, mutex, and time fields", fs.Name)
+		}
+	}
+	// the index's Cleanup names the field.
+	if err := cleanupKeys(fs.Keys, &fs.KeyTemplate, fs.KeyOrder, fs.Name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// cleanupScaledValues validates the settings for decimal and timestamp
+// fields. Decimal fields are generated as integers, counting in units of
+// the field's scale, so their min and max are converted to those units.
+// A timestamp field's values count units of time since its epoch, which
+// defaults to the Unix epoch. Neither type can be created on a server
+// through go-pilosa, so they're only allowed when nothing goes to one.
+func (fs *fieldSpec) cleanupScaledValues(conf *Config) error {
+	if fs.Type != fieldTypeDecimal && fs.Scale != 0 {
+		return fmt.Errorf("field %s specifies a scale but is not a decimal field", fs.Name)
+	}
+	if fs.Type != fieldTypeTimestamp && (fs.Epoch != nil || fs.Unit != timeUnitS) {
+		return fmt.Errorf("field %s specifies an epoch or unit but is not a timestamp field", fs.Name)
+	}
+	if (fs.Type == fieldTypeDecimal || fs.Type == fieldTypeTimestamp) && conf.usesServer() {
+		return fmt.Errorf("field %s: %s fields can't be created on the server, only written to an output directory", fs.Name, fs.Type)
+	}
+	switch fs.Type {
+	case fieldTypeDecimal:
+		if fs.Scale < 0 || fs.Scale > 18 {
+			return fmt.Errorf("field %s: scale %d must be in [0,18]", fs.Name, fs.Scale)
+		}
+		mult := int64(1)
+		for i := int64(0); i < fs.Scale; i++ {
+			mult *= 10
+		}
+		if fs.Max > math.MaxInt64/mult || fs.Min < math.MinInt64/mult {
+			return fmt.Errorf("field %s: min/max (%d/%d) too large for scale %d", fs.Name, fs.Min, fs.Max, fs.Scale)
+		}
+		fs.Min *= mult
+		fs.Max *= mult
+	case fieldTypeTimestamp:
+		if fs.Epoch == nil {
+			epoch := time.Unix(0, 0).UTC()
+			fs.Epoch = &epoch
+		}
+	}
+	return nil
+}
+
+// cleanupKeys validates key settings, shared between indexes (column keys)
+// and fields (row keys), and fills in a default template of "name-%d".
+// Its errors don't name the index or field, which the caller does.
+func cleanupKeys(keys bool, template *string, order valueOrder, name string) error {
+	if !keys {
+		if *template != "" || order != valueOrderLinear {
+			return errors.New("key template/order specified without keys")
+		}
+		return nil
+	}
+	if *template == "" {
+		*template = name + "-%d"
+	}
+	// a usable template produces distinct keys for distinct IDs, and
+	// consumes exactly the one argument we give it.
+	k0, k1 := fmt.Sprintf(*template, 0), fmt.Sprintf(*template, 1)
+	if k0 == k1 || strings.Contains(k0, "%!") {
+		return fmt.Errorf("key template %q must format a single integer ID", *template)
+	}
+	switch order {
+	case valueOrderLinear, valueOrderPermute:
+	default:
+		return fmt.Errorf("key order must be linear or permute, not %s", order)
+	}
 	return nil
 }
 
@@ -568,23 +954,60 @@ func (ws *workloadSpec) Cleanup(conf *Config) error {
 			return fmt.Errorf("invalid split count %d, must be positive\n", *ws.Split)
 		}
 	}
+	if err := ws.checkWindows(); err != nil {
+		return err
+	}
+	if err := ws.checkErrorPolicy(); err != nil {
+		return err
+	}
 	// we have to split this workload up.
 	newTasks := make([]*taskSpec, 0, len(ws.Tasks))
-	for _, task := range ws.Tasks {
+	for i, task := range ws.Tasks {
 		task.Parent = ws
-		err := task.Cleanup(conf)
+		var err error
+		if ws.Windows != 0 {
+			if err = task.checkWindowed(); err != nil {
+				return err
+			}
+		}
+		if task.Replay != "" {
+			task, err = task.replay(conf)
+			ws.Tasks[i] = task
+		} else {
+			err = task.Cleanup(conf)
+		}
 		if err != nil {
 			return err
 		}
+		if task.Name != "" {
+			if conf.namedTasks[task.Name] != nil {
+				return fmt.Errorf("duplicate task name '%s'", task.Name)
+			}
+			// save a copy before splitting changes the columns and offset.
+			saved := *task
+			conf.namedTasks[task.Name] = &saved
+		}
 		split := *task.Split
 		if split == 1 {
 			newTasks = append(newTasks, task)
 			continue
 		}
+		if ws.Windows != 0 {
+			return fmt.Errorf("field %s: tasks in windowed workloads can't be split", task.Field)
+		}
 		// we're splitting this up. we need to subdivide the space.
 		colsEach := *task.Columns / uint64(split)
 		extraCols := *task.Columns - (colsEach * uint64(split))
 		task.Columns = &colsEach
+		// the task's rate is shared among the pieces.
+		if task.Rate != nil {
+			rate := *task.Rate / float64(split)
+			task.Rate = &rate
+		}
+		if task.BatchRate != nil {
+			rate := *task.BatchRate / float64(split)
+			task.BatchRate = &rate
+		}
 		for i := 0; i < split; i++ {
 			// handle the extra columns in the last batch.
 			if i == split-1 {
@@ -597,9 +1020,16 @@ func (ws *workloadSpec) Cleanup(conf *Config) error {
 		}
 	}
 	if len(newTasks) != len(ws.Tasks) {
-		fmt.Printf("autosplitting: %d->%d\n", len(ws.Tasks), len(newTasks))
+		conf.printf("autosplitting: %d->%d\n", len(ws.Tasks), len(newTasks))
 		ws.Tasks = newTasks
 	}
+	for _, query := range ws.Queries {
+		query.Parent = ws
+		err := query.Cleanup(conf)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -676,13 +1106,26 @@ func (ts *taskSpec) Cleanup(conf *Config) error {
 	if ts.UseRoaring == nil {
 		ts.UseRoaring = ts.Parent.UseRoaring
 	}
+	if ts.Rate == nil && ts.BatchRate == nil {
+		ts.Rate, ts.BatchRate = ts.Parent.Rate, ts.Parent.BatchRate
+	}
+	if ts.Duration == nil {
+		ts.Duration = ts.Parent.Duration
+	}
+	if err := ts.checkLimits(); err != nil {
+		return err
+	}
+	if err := ts.checkOperation(); err != nil {
+		return err
+	}
 	// handle timestamp behavior, if requested.
 	if ts.Stamp == stampTypeNone {
 		return nil
 	}
-	// We can't do timestamps with FieldValue returns.
-	if ts.FieldSpec.Type == fieldTypeInt {
-		return fmt.Errorf("field %s: Int fields don't support timestamps", ts.Field)
+	// We can't do timestamps with FieldValue returns, and bool fields
+	// don't have time views.
+	if ts.FieldSpec.Type.intBacked() || ts.FieldSpec.Type == fieldTypeBool {
+		return fmt.Errorf("field %s: %s fields don't support timestamps", ts.Field, ts.FieldSpec.Type)
 	}
 	// default to one week
 	if ts.StampRange == nil {
@@ -696,3 +1139,243 @@ func (ts *taskSpec) Cleanup(conf *Config) error {
 	}
 	return nil
 }
+
+// checkLimits verifies a task's ingest rate and duration limits.
+func (ts *taskSpec) checkLimits() error {
+	if ts.Rate != nil && ts.BatchRate != nil {
+		return fmt.Errorf("field %s: rate and batchRate can't both be specified", ts.Field)
+	}
+	if (ts.Rate != nil && *ts.Rate <= 0) || (ts.BatchRate != nil && *ts.BatchRate <= 0) {
+		return fmt.Errorf("field %s: ingest rates must be positive", ts.Field)
+	}
+	if ts.Duration != nil && *ts.Duration <= 0 {
+		return fmt.Errorf("field %s: duration [%v] must be positive", ts.Field, time.Duration(*ts.Duration))
+	}
+	return nil
+}
+
+// targetRate computes a task's target ingest rate, in records per second,
+// or 0 if it doesn't have one.
+func (ts *taskSpec) targetRate() float64 {
+	switch {
+	case ts.Rate != nil:
+		return *ts.Rate
+	case ts.BatchRate != nil:
+		batchSize := defaultBatchSize
+		if ts.BatchSize != nil {
+			batchSize = *ts.BatchSize
+		}
+		return *ts.BatchRate * float64(batchSize)
+	}
+	return 0
+}
+
+// limits describes a task's ingest rate and duration limits, if any.
+func (ts *taskSpec) limits() string {
+	var limits string
+	switch {
+	case ts.Rate != nil:
+		limits = fmt.Sprintf(", %g records/s", *ts.Rate)
+	case ts.BatchRate != nil:
+		limits = fmt.Sprintf(", %g batches/s", *ts.BatchRate)
+	}
+	if ts.Duration != nil {
+		limits += fmt.Sprintf(", for up to %v", time.Duration(*ts.Duration))
+	}
+	return limits
+}
+
+// checkOperation verifies that a task's operation can be performed. Clear
+// and reassign regenerate the values a set would have produced, so they
+// need a generator which reproduces exactly the same columns.
+func (ts *taskSpec) checkOperation() error {
+	if ts.Operation == taskOperationSet {
+		return nil
+	}
+	if ts.ColumnOffset == -1 {
+		return fmt.Errorf("field %s: %s can't be used with appended columns", ts.Field, ts.Operation)
+	}
+	if ts.Operation == taskOperationReassign {
+		if ts.FieldSpec.Type != fieldTypeMutex && ts.FieldSpec.Type != fieldTypeBool {
+			return fmt.Errorf("field %s: reassign is only supported for mutex and bool fields", ts.Field)
+		}
+		if ts.FieldSpec.Max-ts.FieldSpec.Min < 2 {
+			return fmt.Errorf("field %s: reassign needs at least two rows to move columns between", ts.Field)
+		}
+	}
+	return nil
+}
+
+// replay produces a copy of the named earlier task, with this task's
+// name and operation, so it regenerates the same values. The earlier
+// task's settings have already been cleaned up, so the copy isn't.
+func (ts *taskSpec) replay(conf *Config) (*taskSpec, error) {
+	orig := conf.namedTasks[ts.Replay]
+	if orig == nil {
+		return nil, fmt.Errorf("task replays unknown task '%s'", ts.Replay)
+	}
+	if (ts.Index != "" && ts.Index != orig.Index) || (ts.Field != "" && ts.Field != orig.Field) {
+		return nil, fmt.Errorf("task replaying '%s' specifies a different field (%s/%s, not %s/%s)",
+			ts.Replay, ts.Index, ts.Field, orig.Index, orig.Field)
+	}
+	// anything which affects what gets generated has to come from the
+	// original; only import tuning can be changed.
+	if ts.Seed != nil || ts.Columns != nil || ts.ColumnOrder != valueOrderLinear || ts.RowOrder != valueOrderLinear ||
+		ts.ColumnOffset != 0 || ts.Stamp != stampTypeNone || ts.StampRange != nil || ts.StampStart != nil ||
+		ts.DimensionOrder != dimensionOrderRow || ts.Stride != 0 || ts.ZipfV != 0 || ts.ZipfS != 0 ||
+		ts.ZipfRange != nil || ts.Split != nil {
+		return nil, fmt.Errorf("task replaying '%s' can't change its generator settings", ts.Replay)
+	}
+	replay := *orig
+	// don't share the column count; splitting modifies it.
+	cols := *orig.Columns
+	replay.Columns = &cols
+	replay.Parent = ts.Parent
+	replay.Name = ts.Name
+	replay.Operation = ts.Operation
+	replay.Replay = ts.Replay
+	if ts.BatchSize != nil {
+		replay.BatchSize = ts.BatchSize
+	} else if ts.Parent.BatchSize != nil {
+		replay.BatchSize = ts.Parent.BatchSize
+	}
+	if ts.UseRoaring != nil {
+		replay.UseRoaring = ts.UseRoaring
+	} else if ts.Parent.UseRoaring != nil {
+		replay.UseRoaring = ts.Parent.UseRoaring
+	}
+	if ts.Rate != nil || ts.BatchRate != nil {
+		replay.Rate, replay.BatchRate = ts.Rate, ts.BatchRate
+	} else if ts.Parent.Rate != nil || ts.Parent.BatchRate != nil {
+		replay.Rate, replay.BatchRate = ts.Parent.Rate, ts.Parent.BatchRate
+	}
+	if ts.Duration != nil {
+		replay.Duration = ts.Duration
+	} else if ts.Parent.Duration != nil {
+		replay.Duration = ts.Parent.Duration
+	}
+	if err := replay.checkLimits(); err != nil {
+		return nil, err
+	}
+	if err := replay.checkOperation(); err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+// Cleanup associates a querySpec with the corresponding fieldSpec, fills
+// in defaults, and checks that the requested queries make sense for the
+// field's type.
+func (qs *querySpec) Cleanup(conf *Config) error {
+	index, ok := conf.indexes[qs.Index]
+	if !ok {
+		return fmt.Errorf("undefined index '%s' in queries", qs.Index)
+	}
+	qs.IndexFullName = index.FullName
+	field, ok := index.FieldsByName[qs.Field]
+	if !ok {
+		return fmt.Errorf("undefined field '%s' in index '%s' in queries", qs.Field, qs.Index)
+	}
+	qs.FieldSpec = field
+	if qs.Seed == nil {
+		qs.Seed = field.Parent.Seed
+	}
+	if qs.DuringImport {
+		// queries run until the tasks are done, so a count makes no sense.
+		if qs.Iterations != 0 {
+			return fmt.Errorf("field %s: query iterations can't be specified for queries during import", qs.Field)
+		}
+		if qs.ProgressBuckets == 0 {
+			qs.ProgressBuckets = 10
+		}
+	} else {
+		if qs.ProgressBuckets != 0 {
+			return fmt.Errorf("field %s: progress buckets are only meaningful for queries during import", qs.Field)
+		}
+		if qs.Iterations == 0 {
+			qs.Iterations = 100
+		}
+	}
+	if qs.Concurrency == 0 {
+		qs.Concurrency = 1
+	}
+	if qs.MaxArgs == 0 {
+		qs.MaxArgs = 2
+	}
+	if qs.N == 0 {
+		qs.N = 10
+	}
+	if qs.Iterations < 0 || qs.Concurrency < 0 || qs.ProgressBuckets < 0 {
+		return fmt.Errorf("field %s: query iterations [%d], concurrency [%d], and progress buckets [%d] must be positive",
+			qs.Field, qs.Iterations, qs.Concurrency, qs.ProgressBuckets)
+	}
+	if qs.Rate < 0 {
+		return fmt.Errorf("field %s: query rate [%g] must not be negative", qs.Field, qs.Rate)
+	}
+	if qs.MaxArgs < 2 {
+		return fmt.Errorf("field %s: query max args [%d] must be at least 2", qs.Field, qs.MaxArgs)
+	}
+	if len(qs.Mix) == 0 {
+		switch field.Type {
+		case fieldTypeSet, fieldTypeMutex:
+			qs.Mix = []queryType{queryTypeRow, queryTypeIntersect, queryTypeUnion, queryTypeTopn}
+		case fieldTypeBool:
+			qs.Mix = []queryType{queryTypeRow, queryTypeIntersect, queryTypeUnion}
+		case fieldTypeInt, fieldTypeDecimal, fieldTypeTimestamp:
+			qs.Mix = []queryType{queryTypeRange}
+		case fieldTypeTime:
+			qs.Mix = []queryType{queryTypeRow, queryTypeTimeRange}
+		}
+	}
+	for _, q := range qs.Mix {
+		var valid bool
+		switch q {
+		case queryTypeRow, queryTypeIntersect, queryTypeUnion:
+			valid = !field.Type.intBacked()
+		case queryTypeTopn:
+			valid = field.Type == fieldTypeSet || field.Type == fieldTypeMutex
+		case queryTypeRange:
+			valid = field.Type.intBacked()
+		case queryTypeTimeRange:
+			valid = field.Type == fieldTypeTime
+		}
+		if !valid {
+			return fmt.Errorf("field %s: %s queries are not supported for %s fields", qs.Field, q, field.Type)
+		}
+	}
+	if field.Type != fieldTypeTime {
+		if qs.StampRange != nil || qs.StampStart != nil {
+			return fmt.Errorf("field %s: time ranges are only meaningful for time fields", qs.Field)
+		}
+		return nil
+	}
+	// default to the time range of a task populating this field, if
+	// there is one, so queries hit the data.
+	for _, task := range qs.Parent.Tasks {
+		if task.FieldSpec != field || task.Stamp == stampTypeNone {
+			continue
+		}
+		if qs.StampRange == nil {
+			qs.StampRange = task.StampRange
+			if qs.Parent.Windows != 0 {
+				// cover every window, including any which have been
+				// cleared.
+				span := duration(time.Duration(*qs.Parent.Window) * time.Duration(qs.Parent.Windows))
+				qs.StampRange = &span
+			}
+		}
+		if qs.StampStart == nil {
+			qs.StampStart = task.StampStart
+		}
+		break
+	}
+	if qs.StampRange == nil {
+		week := duration(time.Hour * 7 * 24)
+		qs.StampRange = &week
+	}
+	if qs.StampStart == nil {
+		start := time.Now().Add(-1 * time.Duration(*qs.StampRange))
+		qs.StampStart = &start
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package imagine
+
+import (
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	gopilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestBoolDecimalTimestampFields(t *testing.T) {
+	is := &indexSpec{Columns: 2000, Parent: &tomlSpec{DensityScale: 2097152}}
+	flag := &fieldSpec{Name: "flag", Type: fieldTypeBool, Density: 0.5}
+	price := &fieldSpec{Name: "price", Type: fieldTypeDecimal, Min: 1, Max: 10, Scale: 2, Density: 1.0,
+		ValueRule: densityTypeZipf, ZipfV: 2, ZipfS: 2}
+	seen := &fieldSpec{Name: "seen", Type: fieldTypeTimestamp, Max: 3600, Unit: timeUnitMs, Density: 1.0}
+	// they can only be written to files, as the server can't create them.
+	conf := &Config{OutputDir: "out"}
+	for _, fs := range []*fieldSpec{flag, price, seen} {
+		fs.Parent = is
+		if err := fs.Cleanup(conf); err != nil {
+			t.Fatalf("%s: %v", fs.Name, err)
+		}
+	}
+	if flag.Max != 2 || price.Min != 100 || price.Max != 1000 || !seen.Epoch.Equal(time.Unix(0, 0)) {
+		t.Fatalf("unexpected cleanup: flag max %d, price %d/%d, seen epoch %v", flag.Max, price.Min, price.Max, seen.Epoch)
+	}
+	values := make(map[string]map[int64]int)
+	for _, fs := range []*fieldSpec{flag, price, seen} {
+		spec := &taskSpec{FieldSpec: fs, Parent: &workloadSpec{}, Columns: uint64p(2000), Seed: int64p(1)}
+		itr, _, err := NewGenerator(spec, nil, "")
+		if err != nil {
+			t.Fatalf("%s: creating generator: %v", fs.Name, err)
+		}
+		values[fs.Name] = make(map[int64]int)
+		for rec, err := itr.NextRecord(); err != io.EOF; rec, err = itr.NextRecord() {
+			if err != nil {
+				t.Fatalf("%s: generating: %v", fs.Name, err)
+			}
+			var v int64
+			switch r := rec.(type) {
+			case gopilosa.Column:
+				v = int64(r.RowID)
+			case gopilosa.FieldValue:
+				v = r.Value
+			}
+			if v < fs.Min || v >= fs.Max {
+				t.Fatalf("%s: value %d out of range %d..%d", fs.Name, v, fs.Min, fs.Max)
+			}
+			values[fs.Name][v]++
+		}
+	}
+	if len(values["flag"]) != 2 {
+		t.Fatalf("expected both bool rows, got %v", values["flag"])
+	}
+	if values["price"][100] < values["price"][101]*2 {
+		t.Fatalf("expected zipf prices to favor the minimum, got %d of 1.00, %d of 1.01", values["price"][100], values["price"][101])
+	}
+	bad := []*fieldSpec{
+		{Name: "scaled", Type: fieldTypeInt, Max: 10, Scale: 2},
+		{Name: "stamped", Type: fieldTypeDecimal, Max: 10, Unit: timeUnitNs},
+		{Name: "flags", Type: fieldTypeBool, Max: 3},
+		{Name: "huge", Type: fieldTypeDecimal, Max: math.MaxInt64 / 10, Scale: 2},
+	}
+	for _, fs := range bad {
+		fs.Parent = is
+		if err := fs.Cleanup(conf); err == nil {
+			t.Fatalf("%s: expected cleanup error", fs.Name)
+		}
+	}
+	for _, typ := range []fieldType{fieldTypeDecimal, fieldTypeTimestamp} {
+		fs := &fieldSpec{Name: "f", Type: typ, Max: 10, Parent: is}
+		if err := fs.Cleanup(&Config{}); err == nil || !strings.Contains(err.Error(), "can't be created on the server") {
+			t.Fatalf("%s: expected an error for a field going to the server, got %v", typ, err)
+		}
+	}
+}
+
+func TestRedeclaredDecimalField(t *testing.T) {
+	newIndex := func(second *fieldSpec) *indexSpec {
+		return &indexSpec{Name: "i", Columns: 100, Parent: &tomlSpec{DensityScale: 2097152}, Fields: []*fieldSpec{
+			{Name: "price", Type: fieldTypeDecimal, Min: 1, Max: 10, Scale: 2, Density: 1.0},
+			second,
+		}}
+	}
+	// a field declared again, repeating or omitting its range, gets the
+	// same scaled range both times.
+	for _, second := range []*fieldSpec{
+		{Name: "price", Type: fieldTypeDecimal, Min: 1, Max: 10, Scale: 2, Density: 0.5},
+		{Name: "price", Type: fieldTypeDecimal, Density: 0.5},
+	} {
+		is := newIndex(second)
+		if err := is.Cleanup(&Config{OutputDir: "out"}); err != nil {
+			t.Fatalf("redeclaring %d/%d: %v", second.Min, second.Max, err)
+		}
+		for _, fs := range is.Fields {
+			if fs.Min != 100 || fs.Max != 1000 || fs.Scale != 2 {
+				t.Fatalf("expected price 100/1000 at scale 2, got %d/%d at scale %d", fs.Min, fs.Max, fs.Scale)
+			}
+		}
+	}
+	for _, second := range []*fieldSpec{
+		{Name: "price", Type: fieldTypeDecimal, Min: 1, Max: 20, Scale: 2},
+		{Name: "price", Type: fieldTypeDecimal, Min: 1, Max: 10, Scale: 3},
+	} {
+		if err := newIndex(second).Cleanup(&Config{OutputDir: "out"}); err == nil || !strings.Contains(err.Error(), "incompatible") {
+			t.Fatalf("redeclaring %d/%d at scale %d: expected incompatible specifiers, got %v", second.Min, second.Max, second.Scale, err)
+		}
+	}
+}
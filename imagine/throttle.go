@@ -0,0 +1,122 @@
+package imagine
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+// throttleMinSleep is the shortest time a throttledIterator sleeps. Short
+// sleeps take much longer than requested, so at high rates, records are
+// produced in small bursts, keeping to the target rate on average.
+const throttleMinSleep = 10 * time.Millisecond
+
+// throttleUpdatePeriod is how often a throttledIterator reports its rate.
+const throttleUpdatePeriod = time.Second
+
+// throttledIterator limits the rate at which a generator's records are
+// produced, and how long it runs for, so a task can simulate a steady feed
+// of data rather than a bulk load. Records are scheduled from the time of
+// the first record, so a slow import catches up afterwards, rather than
+// falling further behind. When the time limit is reached, the iterator
+// stops, even if the generator has more records.
+type throttledIterator struct {
+	CountingIterator
+	rate       float64 // records per second, or 0 for no limit
+	limit      time.Duration
+	start, end time.Time
+	deadline   time.Time
+	nextUpdate time.Time
+	records    int64
+	expired    bool
+	updateChan chan taskUpdate
+	updateID   string
+}
+
+func newThrottledIterator(itr CountingIterator, rate float64, limit *duration, updateChan chan taskUpdate, updateID string) *throttledIterator {
+	t := &throttledIterator{CountingIterator: itr, rate: rate, updateChan: updateChan, updateID: updateID}
+	if limit != nil {
+		t.limit = time.Duration(*limit)
+	}
+	return t
+}
+
+func (t *throttledIterator) NextRecord() (pilosa.Record, error) {
+	now := time.Now()
+	if t.start.IsZero() {
+		t.start = now
+		if t.limit != 0 {
+			t.deadline = now.Add(t.limit)
+		}
+		t.nextUpdate = now.Add(throttleUpdatePeriod)
+	}
+	if !t.end.IsZero() {
+		return nil, io.EOF
+	}
+	if t.rate > 0 {
+		due := t.start.Add(time.Duration(float64(t.records) / t.rate * float64(time.Second)))
+		if !t.deadline.IsZero() && due.After(t.deadline) {
+			// no more records fit before the deadline.
+			time.Sleep(t.deadline.Sub(now))
+			return t.expire()
+		}
+		if wait := due.Sub(now); wait >= throttleMinSleep {
+			time.Sleep(wait)
+			now = time.Now()
+		}
+	}
+	if !t.deadline.IsZero() && !now.Before(t.deadline) {
+		return t.expire()
+	}
+	rec, err := t.CountingIterator.NextRecord()
+	if err != nil {
+		t.end = now
+		return rec, err
+	}
+	t.records++
+	if t.updateChan != nil && !now.Before(t.nextUpdate) {
+		t.updateChan <- taskUpdate{id: t.updateID, colCount: t.records, rate: t.achieved(now), target: t.rate}
+		t.nextUpdate = now.Add(throttleUpdatePeriod)
+	}
+	return rec, nil
+}
+
+// expire stops the iterator when it runs out of time.
+func (t *throttledIterator) expire() (pilosa.Record, error) {
+	t.expired = true
+	t.end = time.Now()
+	return nil, io.EOF
+}
+
+// achieved computes the average rate so far, in records per second.
+func (t *throttledIterator) achieved(now time.Time) float64 {
+	elapsed := now.Sub(t.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(t.records) / elapsed
+}
+
+// Expired reports whether the iterator stopped because it ran out of
+// time, rather than because the generator was done.
+func (t *throttledIterator) Expired() bool {
+	return t.expired
+}
+
+// Summary describes the records produced and the rate achieved.
+func (t *throttledIterator) Summary() string {
+	end := t.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	summary := fmt.Sprintf("%d records in %v, %.0f/s", t.records, end.Sub(t.start).Round(time.Millisecond), t.achieved(end))
+	if t.rate > 0 {
+		summary += fmt.Sprintf(" (target %.0f/s)", t.rate)
+	}
+	if t.expired {
+		summary += ", stopped at time limit"
+	}
+	return summary
+}
@@ -0,0 +1,53 @@
+package imagine
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottledIterator(t *testing.T) {
+	fs := &fieldSpec{Type: fieldTypeMutex, Max: 10, Density: 1.0, DensityScale: uint64p(2097152), Chance: float64p(1.0)}
+	for _, c := range []struct {
+		columns uint64
+		rate    float64
+		limit   time.Duration
+		records int64
+		expired bool
+	}{
+		{columns: 100000, rate: 5000, limit: 200 * time.Millisecond, records: 1000, expired: true},
+		{columns: 100, rate: 1000, records: 100},
+		{columns: 1 << 30, limit: 50 * time.Millisecond, expired: true},
+	} {
+		spec := &taskSpec{FieldSpec: fs, Parent: &workloadSpec{}, Columns: uint64p(c.columns), Seed: int64p(1)}
+		itr, _, err := NewGenerator(spec, nil, "")
+		if err != nil {
+			t.Fatalf("creating generator: %v", err)
+		}
+		limit := duration(c.limit)
+		th := newThrottledIterator(itr, c.rate, &limit, nil, "")
+		if c.limit == 0 {
+			th = newThrottledIterator(itr, c.rate, nil, nil, "")
+		}
+		before := time.Now()
+		for _, err := th.NextRecord(); err != io.EOF; _, err = th.NextRecord() {
+			if err != nil {
+				t.Fatalf("generating: %v", err)
+			}
+		}
+		elapsed := time.Since(before)
+		if th.Expired() != c.expired {
+			t.Fatalf("%+v: expected expired %t, got %t", c, c.expired, th.Expired())
+		}
+		if c.limit != 0 && (elapsed < c.limit || elapsed > c.limit+100*time.Millisecond) {
+			t.Fatalf("%+v: expected to run for %v, took %v", c, c.limit, elapsed)
+		}
+		// allow for bursts between sleeps, and for sleeps running long.
+		if c.records != 0 && (th.records < c.records-c.records/5 || th.records > c.records+c.records/10) {
+			t.Fatalf("%+v: expected about %d records, got %d", c, c.records, th.records)
+		}
+		if c.rate != 0 && th.achieved(th.end) > c.rate*1.1 {
+			t.Fatalf("%+v: rate %.0f/s, over target", c, th.achieved(th.end))
+		}
+	}
+}
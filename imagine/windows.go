@@ -0,0 +1,140 @@
+package imagine
+
+import (
+	"fmt"
+	"time"
+)
+
+// checkWindows verifies a workload's rolling window settings, and fills
+// in the default start, which puts the end of the last window at the
+// current time.
+func (ws *workloadSpec) checkWindows() error {
+	if ws.Windows == 0 {
+		if ws.Window != nil || ws.Retention != nil || ws.StampStart != nil {
+			return fmt.Errorf("workload %s: window, retention, and stampStart only apply with windows", ws.Name)
+		}
+		return nil
+	}
+	if ws.Windows < 0 {
+		return fmt.Errorf("workload %s: invalid window count %d, must be positive", ws.Name, ws.Windows)
+	}
+	if ws.Window == nil || *ws.Window <= 0 {
+		return fmt.Errorf("workload %s: windows need a positive window length", ws.Name)
+	}
+	if ws.Retention != nil && *ws.Retention < *ws.Window {
+		return fmt.Errorf("workload %s: retention [%v] must be at least one window [%v]",
+			ws.Name, time.Duration(*ws.Retention), time.Duration(*ws.Window))
+	}
+	if ws.StampStart == nil {
+		start := time.Now().Add(-time.Duration(*ws.Window) * time.Duration(ws.Windows))
+		ws.StampStart = &start
+	}
+	return nil
+}
+
+// checkWindowed verifies that a task can be run in each of its workload's
+// windows, and gives it the first window's stamps. Each window appends
+// new columns, so the task has to append, and the window determines the
+// stamps, so the task can't specify them.
+func (ts *taskSpec) checkWindowed() error {
+	if ts.Replay != "" {
+		return fmt.Errorf("task replaying '%s': tasks in windowed workloads can't replay other tasks", ts.Replay)
+	}
+	if ts.ColumnOffset != -1 {
+		return fmt.Errorf("field %s: tasks in windowed workloads must use columnOffset = \"append\"", ts.Field)
+	}
+	if ts.ColumnOrder == valueOrderZipf {
+		return fmt.Errorf("field %s: zipf column order can't be used in windowed workloads", ts.Field)
+	}
+	if ts.StampRange != nil || ts.StampStart != nil {
+		return fmt.Errorf("field %s: tasks in windowed workloads get their stamps from the windows", ts.Field)
+	}
+	if ts.Stamp != stampTypeNone {
+		ts.StampRange = ts.Parent.Window
+		ts.StampStart = ts.Parent.StampStart
+	}
+	return nil
+}
+
+// retained is the number of windows which are kept, or 0 if windows are
+// never cleared. A window is cleared once all of it is older than the
+// retention period, measured from the end of the latest window.
+func (ws *workloadSpec) retained() int {
+	if ws.Retention == nil {
+		return 0
+	}
+	window := int64(*ws.Window)
+	return int((int64(*ws.Retention) + window - 1) / window)
+}
+
+// windowTasks is the number of tasks run in all of a workload's windows,
+// including the ones which clear windows.
+func (ws *workloadSpec) windowTasks() int {
+	if ws.Windows == 0 {
+		return len(ws.Tasks)
+	}
+	runs := ws.Windows
+	if keep := ws.retained(); keep > 0 && ws.Windows > keep {
+		runs += ws.Windows - keep
+	}
+	return runs * len(ws.Tasks)
+}
+
+// windows describes a workload's window settings.
+func (ws *workloadSpec) windows() string {
+	desc := fmt.Sprintf("%d of %v, from %s", ws.Windows, time.Duration(*ws.Window), ws.StampStart.Format(time.RFC3339))
+	if keep := ws.retained(); keep > 0 {
+		desc += fmt.Sprintf(", keeping %d", keep)
+	}
+	return desc
+}
+
+// eachWindow calls fn with the tasks to run in each of a workload's
+// windows, in order. Without windows, there's a single call with the
+// workload's tasks. Otherwise, each window gets copies of the tasks,
+// which append columns after the previous window's, with stamps spread
+// over the window. Once a window is older than the retention period,
+// copies of its tasks which clear the same bits are added to a later
+// window's. Each window's tasks have a copy of the workload, named for the
+// window, as their parent, so they're told apart in journals, metrics,
+// and output files.
+func (ws *workloadSpec) eachWindow(fn func(window int, tasks []*taskSpec) error) error {
+	if ws.Windows == 0 {
+		return fn(0, ws.Tasks)
+	}
+	keep := ws.retained()
+	windows := make([][]*taskSpec, 0, ws.Windows)
+	for i := 0; i < ws.Windows; i++ {
+		parent := *ws
+		parent.Name = fmt.Sprintf("%s-w%03d", ws.Name, i)
+		start := ws.StampStart.Add(time.Duration(*ws.Window) * time.Duration(i))
+		tasks := make([]*taskSpec, 0, 2*len(ws.Tasks))
+		for _, task := range ws.Tasks {
+			t := *task
+			t.Parent = &parent
+			// like an append, but with the offset fixed now, so it can
+			// be cleared later.
+			fs := t.FieldSpec
+			t.ColumnOffset = columnOffset(fs.HighestColumn + 1)
+			fs.HighestColumn = int64(t.ColumnOffset) + int64(*t.Columns)
+			if t.Stamp != stampTypeNone {
+				t.StampStart = &start
+			}
+			tasks = append(tasks, &t)
+		}
+		windows = append(windows, tasks)
+		if keep > 0 && i >= keep {
+			for _, task := range windows[i-keep] {
+				t := *task
+				t.Parent = &parent
+				t.Operation = taskOperationClear
+				tasks = append(tasks, &t)
+			}
+			windows[i-keep] = nil
+		}
+		if err := fn(i, tasks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
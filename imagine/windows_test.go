@@ -0,0 +1,63 @@
+package imagine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWorkloadWindows(t *testing.T) {
+	conf := NewConfig()
+	conf.vars = map[string]string{"columns": "100"}
+	conf.NewSpecsFiles([]string{"samples/events.toml"})
+	if err := conf.ReadSpecs(); err != nil {
+		t.Fatalf("reading spec: %v", err)
+	}
+	wl := conf.workloads[0].Workloads[0]
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ran int
+	var cleared []columnOffset
+	err := wl.eachWindow(func(window int, tasks []*taskSpec) error {
+		ran += len(tasks)
+		for _, task := range tasks {
+			if task.Operation == taskOperationClear {
+				if task.Field == "kind" {
+					cleared = append(cleared, task.ColumnOffset)
+				}
+				continue
+			}
+			// each window appends 100 columns after the previous
+			// window's, leaving the usual gap of one column.
+			if offset := columnOffset(1 + window*101); task.ColumnOffset != offset {
+				t.Fatalf("window %d: %s: expected offset %d", window, task, offset)
+			}
+			if task.Parent.Name != fmt.Sprintf("daily-w%03d", window) {
+				t.Fatalf("window %d: unexpected workload name %s", window, task.Parent.Name)
+			}
+			if task.Field == "kind" && !task.StampStart.Equal(start.Add(time.Duration(window)*24*time.Hour)) {
+				t.Fatalf("window %d: unexpected stamp start %v", window, task.StampStart)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("running windows: %v", err)
+	}
+	if ran != wl.windowTasks() || ran != 34 {
+		t.Fatalf("expected 34 tasks, counted %d, ran %d", wl.windowTasks(), ran)
+	}
+	// 3 windows are kept, so the last 7 windows each clear one.
+	if len(cleared) != 7 || cleared[0] != 1 || cleared[6] != columnOffset(1+6*101) {
+		t.Fatalf("unexpected cleared windows %v", cleared)
+	}
+	week, day := duration(7*24*time.Hour), duration(24*time.Hour)
+	for _, ws := range []*workloadSpec{
+		{Name: "short", Windows: 2, Window: &week, Retention: &day},
+		{Name: "lengthless", Windows: 2},
+		{Name: "windowless", Window: &day},
+	} {
+		if err := ws.checkWindows(); err == nil {
+			t.Errorf("%s: expected error", ws.Name)
+		}
+	}
+}